@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+//Base58Check编码的地址：1字节版本号 + 20字节公钥hash + 4字节校验和
+type Address struct{
+	Version    byte
+	PubKeyHash []byte
+}
+
+const (
+	pubKeyHashLen = 20
+	addressLen    = 1 + pubKeyHashLen + addressChecksumLen
+)
+
+//公钥hash在params网络上的地址
+func NewAddress(pubkeyhash []byte,params ChainParams) Address{
+	return Address{Version: params.PubKeyHashAddrID,PubKeyHash: pubkeyhash}
+}
+
+//解析字符串形式的地址，依次检查字符、长度、校验和以及是不是params网络的版本号，
+//不合法时返回ErrInvalidAddress，并说明是哪一项不对
+func DecodeAddress(s string,params ChainParams) (Address,error){
+	if s == ""{
+		return Address{},fmt.Errorf("%w: empty address",ErrInvalidAddress)
+	}
+	data,err := Base58Decode([]byte(s))
+	if err != nil{
+		return Address{},fmt.Errorf("%w %q: %v",ErrInvalidAddress,s,err)
+	}
+	if len(data) != addressLen{
+		return Address{},fmt.Errorf("%w %q: decoded to %d bytes, want %d",ErrInvalidAddress,s,len(data),addressLen)
+	}
+	payload := data[:len(data)-addressChecksumLen]
+	if !bytes.Equal(CheckSum(payload),data[len(data)-addressChecksumLen:]){
+		return Address{},fmt.Errorf("%w %q: checksum mismatch, check for typos",ErrInvalidAddress,s)
+	}
+	if payload[0] != params.PubKeyHashAddrID{
+		return Address{},fmt.Errorf("%w %q: version 0x%02x belongs to another network, want 0x%02x",
+			ErrInvalidAddress,s,payload[0],params.PubKeyHashAddrID)
+	}
+	return Address{Version: payload[0],PubKeyHash: payload[1:]},nil
+}
+
+//Base58Check编码的字符串
+func (a Address) String() string{
+	payload := append([]byte{a.Version},a.PubKeyHash...)
+	return string(Base58Encode(append(payload,CheckSum(payload)...)))
+}
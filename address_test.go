@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBase58KnownAnswers(t *testing.T){
+	tests := []struct{
+		hex,b58 string
+	}{
+		{"",""},
+		{"00","1"},
+		{"000001","112"},
+		{hex.EncodeToString([]byte("Hello World!")),"2NEpo7TZRRrLZSi2U"},
+		{"00eb15231dfceb60925886b67d065299925915aeb172c06647","1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L"},
+	}
+	for _,tt := range tests{
+		data,_ := hex.DecodeString(tt.hex)
+		if got := string(Base58Encode(data)); got != tt.b58{
+			t.Errorf("Base58Encode(%s) = %s, want %s",tt.hex,got,tt.b58)
+		}
+		back,err := Base58Decode([]byte(tt.b58))
+		if err != nil || !bytes.Equal(back,data){
+			t.Errorf("Base58Decode(%s) = %x, %v, want %s",tt.b58,back,err,tt.hex)
+		}
+	}
+
+	//0、O、I、l不在字母表中
+	for _,s := range []string{"0","1O","Il","abc-"}{
+		if _,err := Base58Decode([]byte(s)); err == nil{
+			t.Errorf("Base58Decode(%q) accepted an invalid character",s)
+		}
+	}
+}
+
+//公钥hash 010966776006953D5567439E5E39F86A0D273BEE 在主网和测试网版本号下的地址
+func TestAddressKnownAnswers(t *testing.T){
+	hash,_ := hex.DecodeString("010966776006953D5567439E5E39F86A0D273BEE")
+	testnet := chainParams
+	testnet.PubKeyHashAddrID = 0x6f
+
+	tests := []struct{
+		params  ChainParams
+		address string
+	}{
+		{chainParams,"16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM"},
+		{testnet,"mfcSEPR8EkJrpX91YkTJ9iscdAzppJrG9j"},
+	}
+	for _,tt := range tests{
+		if got := NewAddress(hash,tt.params).String(); got != tt.address{
+			t.Errorf("NewAddress(version 0x%02x) = %s, want %s",tt.params.PubKeyHashAddrID,got,tt.address)
+		}
+		a,err := DecodeAddress(tt.address,tt.params)
+		if err != nil || a.Version != tt.params.PubKeyHashAddrID || !bytes.Equal(a.PubKeyHash,hash){
+			t.Errorf("DecodeAddress(%s) = %+v, %v",tt.address,a,err)
+		}
+	}
+
+	//另一个网络的地址说明是版本号不对
+	_,err := DecodeAddress("mfcSEPR8EkJrpX91YkTJ9iscdAzppJrG9j",chainParams)
+	if !errors.Is(err,ErrInvalidAddress) || !strings.Contains(err.Error(),"version"){
+		t.Errorf("testnet address on mainnet: err = %v, want a version error",err)
+	}
+}
+
+func TestDecodeAddressRejects(t *testing.T){
+	valid := "16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM"
+	tests := []struct{
+		address,reason string
+	}{
+		{"","empty"},
+		{"0OIl","character"},
+		{"1","bytes"},
+		{valid[:len(valid)-1],"bytes"},
+		{valid + "1","checksum"},
+		{strings.Repeat("z",60),"bytes"},
+		{"16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvN","checksum"},
+		{"16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvm","checksum"},
+	}
+	for _,tt := range tests{
+		_,err := DecodeAddress(tt.address,chainParams)
+		if !errors.Is(err,ErrInvalidAddress) || !strings.Contains(err.Error(),tt.reason){
+			t.Errorf("DecodeAddress(%q): err = %v, want ErrInvalidAddress mentioning %q",tt.address,err,tt.reason)
+		}
+		if IsValidAdress([]byte(tt.address)){
+			t.Errorf("IsValidAdress(%q) = true",tt.address)
+		}
+		if _,err := GetPubKeyHash(tt.address); !errors.Is(err,ErrInvalidAddress){
+			t.Errorf("GetPubKeyHash(%q): err = %v, want ErrInvalidAddress",tt.address,err)
+		}
+	}
+}
+
+//命令行参数的错误信息说明是哪个参数
+func TestCheckAddressFlag(t *testing.T){
+	if err := checkAddressFlag("to","16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvM"); err != nil{
+		t.Errorf("valid address: %v",err)
+	}
+	err := checkAddressFlag("to","16UwLL9Risc3QfPqBUvKofHmBQ7wMtjvN")
+	if !errors.Is(err,ErrInvalidAddress) || !strings.HasPrefix(err.Error(),"-to: "){
+		t.Errorf("bad address: err = %v, want ErrInvalidAddress prefixed with -to",err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//金额：以最小单位计数的定点数，1个币等于Coin个最小单位，小数点后有AmountDecimals位。
+//交易输出、挖矿奖励、手续费和余额都用这个类型，不再用没有单位的int
+type Amount int64
+
+const (
+	AmountDecimals        = 8
+	Coin           Amount = 100000000       //1个币
+	MaxMoney       Amount = 21000000 * Coin //金额的上限，任何输出、输入或输出的总额都不能超过它
+)
+
+//金额是否在 0..MaxMoney 范围内
+func (a Amount) Valid() bool{
+	return a >= 0 && a <= MaxMoney
+}
+
+//检查过的加法：两个加数和结果都必须在 0..MaxMoney 范围内，否则返回ErrInvalidAmount。
+//MaxMoney远小于int64的上限，两个合法金额相加不会溢出
+func (a Amount) Add(b Amount) (Amount,error){
+	if !a.Valid() || !b.Valid() || a+b > MaxMoney{
+		return 0,fmt.Errorf("%w: %s + %s is out of range",ErrInvalidAmount,a,b)
+	}
+	return a + b,nil
+}
+
+//检查过的减法：结果不能是负数
+func (a Amount) Sub(b Amount) (Amount,error){
+	if !a.Valid() || !b.Valid() || a < b{
+		return 0,fmt.Errorf("%w: %s - %s is out of range",ErrInvalidAmount,a,b)
+	}
+	return a - b,nil
+}
+
+//按 整数.小数 格式化，去掉小数末尾的0，例如125000000 --> "1.25"
+func (a Amount) String() string{
+	sign := ""
+	n := int64(a)
+	if n < 0{
+		sign = "-"
+		n = -n
+	}
+	whole := n / int64(Coin)
+	frac := n % int64(Coin)
+	if frac == 0{
+		return fmt.Sprintf("%s%d",sign,whole)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d",AmountDecimals,frac),"0")
+	return fmt.Sprintf("%s%d.%s",sign,whole,fracStr)
+}
+
+//解析 整数.小数 格式的金额，例如"1.25" --> 125000000。
+//小数超过AmountDecimals位、负数或者超过MaxMoney都返回ErrInvalidAmount
+func ParseAmount(s string) (Amount,error){
+	s = strings.TrimSpace(s)
+	whole,frac := s,""
+	if pos := strings.Index(s,"."); pos >= 0{
+		whole,frac = s[:pos],s[pos+1:]
+	}
+	if whole == "" && frac == "" || len(frac) > AmountDecimals || strings.ContainsAny(whole+frac,"+-"){
+		return 0,fmt.Errorf("%w: %q",ErrInvalidAmount,s)
+	}
+	if whole == ""{
+		whole = "0"
+	}
+	frac += strings.Repeat("0",AmountDecimals-len(frac))
+
+	//整数部分太大时直接判为超出范围，避免乘Coin时溢出
+	w,err := strconv.ParseInt(whole,10,64)
+	if err != nil || w > int64(MaxMoney/Coin){
+		return 0,fmt.Errorf("%w: %q",ErrInvalidAmount,s)
+	}
+	f,err := strconv.ParseInt(frac,10,64)
+	if err != nil{
+		return 0,fmt.Errorf("%w: %q",ErrInvalidAmount,s)
+	}
+	a := Amount(w)*Coin + Amount(f)
+	if !a.Valid(){
+		return 0,fmt.Errorf("%w: %q exceeds the maximum %s",ErrInvalidAmount,s,MaxMoney)
+	}
+	return a,nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T){
+	tests := []struct{
+		s    string
+		want Amount
+	}{
+		{"1.25",125000000},
+		{"0.00000001",1},
+		{".5",50000000},
+		{"3",3 * Coin},
+		{"3.",3 * Coin},
+		{" 7.1 ",710000000},
+		{"0",0},
+		{"21000000",MaxMoney},
+		{"20999999.99999999",MaxMoney - 1},
+	}
+	for _,tt := range tests{
+		got,err := ParseAmount(tt.s)
+		if err != nil || got != tt.want{
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d",tt.s,got,err,tt.want)
+		}
+	}
+
+	for _,s := range []string{"",".","-1","+1","1.123456789","21000000.00000001","21000001",
+		"abc","1e5","0x10","1.2.3","99999999999999999999","92233720368.54775807"}{
+		if got,err := ParseAmount(s); !errors.Is(err,ErrInvalidAmount){
+			t.Errorf("ParseAmount(%q) = %d, %v, want ErrInvalidAmount",s,got,err)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T){
+	tests := []struct{
+		a    Amount
+		want string
+	}{
+		{125000000,"1.25"},
+		{1,"0.00000001"},
+		{0,"0"},
+		{Coin,"1"},
+		{MaxMoney,"21000000"},
+		{-1,"-0.00000001"},
+		{-150000000,"-1.5"},
+	}
+	for _,tt := range tests{
+		if got := tt.a.String(); got != tt.want{
+			t.Errorf("Amount(%d).String() = %q, want %q",int64(tt.a),got,tt.want)
+		}
+		if tt.a < 0{
+			continue
+		}
+		if back,err := ParseAmount(tt.want); err != nil || back != tt.a{
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d",tt.want,back,err,int64(tt.a))
+		}
+	}
+}
+
+func TestAmountAddSub(t *testing.T){
+	if sum,err := Amount(Coin).Add(MaxMoney - Coin); err != nil || sum != MaxMoney{
+		t.Errorf("Add up to MaxMoney = %s, %v",sum,err)
+	}
+	for _,tt := range []struct{ a,b Amount }{{MaxMoney,1},{-1,1},{1,-1},{MaxMoney + 1,0}}{
+		if _,err := tt.a.Add(tt.b); !errors.Is(err,ErrInvalidAmount){
+			t.Errorf("%d + %d: err = %v, want ErrInvalidAmount",int64(tt.a),int64(tt.b),err)
+		}
+	}
+
+	if diff,err := Amount(5).Sub(5); err != nil || diff != 0{
+		t.Errorf("5 - 5 = %s, %v",diff,err)
+	}
+	for _,tt := range []struct{ a,b Amount }{{1,2},{-1,0},{MaxMoney + 1,1}}{
+		if _,err := tt.a.Sub(tt.b); !errors.Is(err,ErrInvalidAmount){
+			t.Errorf("%d - %d: err = %v, want ErrInvalidAmount",int64(tt.a),int64(tt.b),err)
+		}
+	}
+}
+
+//输出金额为正，总额不超过MaxMoney，也不超过输入的总额
+func TestCheckTransationAmounts(t *testing.T){
+	tx := func(values ...Amount) *Transation{
+		tx := &Transation{}
+		for _,v := range values{
+			tx.Vout = append(tx.Vout,TXOutput{v,nil})
+		}
+		return tx
+	}
+	prev := func(values ...Amount) []TXOutput{
+		var outs []TXOutput
+		for _,v := range values{
+			outs = append(outs,TXOutput{v,nil})
+		}
+		return outs
+	}
+
+	fee,err := checkTransationAmounts(tx(3*Coin,Coin),prev(5*Coin))
+	if err != nil || fee != Coin{
+		t.Errorf("fee = %s, %v, want 1",fee,err)
+	}
+
+	tests := []struct{
+		name string
+		tx   *Transation
+		prev []TXOutput
+	}{
+		{"zero output",tx(0),prev(Coin)},
+		{"negative output",tx(-1,2),prev(Coin)},
+		{"outputs exceed inputs",tx(2 * Coin),prev(Coin)},
+		{"output total over MaxMoney",tx(MaxMoney,MaxMoney),prev(MaxMoney,MaxMoney)},
+		{"input total over MaxMoney",tx(1),prev(MaxMoney,1)},
+	}
+	for _,tt := range tests{
+		if _,err := checkTransationAmounts(tt.tx,tt.prev); !errors.Is(err,ErrInvalidTransation){
+			t.Errorf("%s: err = %v, want ErrInvalidTransation",tt.name,err)
+		}
+	}
+}
+
+func TestParseAmountFlag(t *testing.T){
+	if got,err := parseAmountFlag("amount","0.1",false); err != nil || got != Coin/10{
+		t.Errorf("parseAmountFlag(0.1) = %s, %v",got,err)
+	}
+	if _,err := parseAmountFlag("amount","0",false); !errors.Is(err,ErrInvalidAmount){
+		t.Errorf("zero amount: err = %v, want ErrInvalidAmount",err)
+	}
+	if got,err := parseAmountFlag("feerate","0",true); err != nil || got != 0{
+		t.Errorf("zero fee rate = %s, %v",got,err)
+	}
+	if _,err := parseAmountFlag("amount","1,5",false); !errors.Is(err,ErrInvalidAmount){
+		t.Errorf("1,5: err = %v, want ErrInvalidAmount",err)
+	}
+}
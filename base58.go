@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"math/big"
 )
 
@@ -53,7 +54,8 @@ func Base58Encode(input []byte) []byte{
 
 
 
-func Base58Decode(input []byte) []byte{
+//把base58编码的字节数组还原，遇到字母表以外的字符返回错误
+func Base58Decode(input []byte) ([]byte,error){
 	result :=  big.NewInt(0)
 	zeroBytes :=0
 	for _,b :=range input{
@@ -66,8 +68,12 @@ func Base58Decode(input []byte) []byte{
 	payload:= input[zeroBytes:]
 
 	//这个乘58+余数的方法太巧妙了
-	for _,b := range payload{
+	for i,b := range payload{
 		charIndex := bytes.IndexByte(b58Alphabet,b)  //反推出余数
+		if charIndex < 0{
+			//0、O、I、l以及其他字符都不在字母表中，不能当成-1继续算
+			return nil,fmt.Errorf("invalid base58 character %q at position %d",b,zeroBytes+i)
+		}
 
 		result.Mul(result,big.NewInt(58))   //之前的结果乘以58
 
@@ -77,5 +83,5 @@ func Base58Decode(input []byte) []byte{
 
 	decoded :=result.Bytes()
 	decoded =  append(bytes.Repeat([]byte{0x00},zeroBytes),decoded...)
-	return decoded
+	return decoded,nil
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"strings"
+)
+
+//BIP39助记词：用一串单词表示随机数（熵），方便抄写备份。每个单词编码11位，
+//熵后面加上sha256(熵)的前 熵位数/32 位作为校验，128位熵对应12个单词，256位熵对应24个单词。
+//助记词经过PBKDF2得到64字节的种子，再由种子按BIP32派生出全部私钥
+
+const (
+	mnemonicIterations = 2048
+	mnemonicSaltPrefix = "mnemonic"
+)
+
+//生成entropyBits位随机熵对应的助记词，entropyBits是128到256之间32的倍数
+func NewMnemonic(entropyBits int) (string,error){
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0{
+		return "",fmt.Errorf("%w: entropy must be 128..256 bits in steps of 32",ErrInvalidMnemonic)
+	}
+	entropy := make([]byte,entropyBits/8)
+	_,err := rand.Read(entropy)
+	if err != nil{
+		return "",err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+//把熵编码成助记词，单词之间用一个空格分隔
+func EntropyToMnemonic(entropy []byte) (string,error){
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0{
+		return "",fmt.Errorf("%w: entropy must be 128..256 bits in steps of 32",ErrInvalidMnemonic)
+	}
+	checksum := sha256.Sum256(entropy)
+	data := append(append([]byte{},entropy...),checksum[0])
+
+	//从高位开始，每11位取一个单词
+	count := (bits + bits/32) / 11
+	words := make([]string,count)
+	for i := 0; i < count; i++{
+		index := 0
+		for j := 0; j < 11; j++{
+			pos := i*11 + j
+			bit := data[pos/8] >> (7 - uint(pos%8)) & 1
+			index = index<<1 | int(bit)
+		}
+		words[i] = bip39WordList[index]
+	}
+	return strings.Join(words," "),nil
+}
+
+//把助记词解码成熵，检查单词个数、单词是否在单词表中以及校验位。不合法返回ErrInvalidMnemonic
+func MnemonicToEntropy(mnemonic string) ([]byte,error){
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0{
+		return nil,fmt.Errorf("%w: %d words, expected 12, 15, 18, 21 or 24",ErrInvalidMnemonic,len(words))
+	}
+
+	totalBits := len(words) * 11
+	data := make([]byte,(totalBits+7)/8)
+	for i,word := range words{
+		index,ok := bip39Index[strings.ToLower(word)]
+		if !ok{
+			return nil,fmt.Errorf("%w: unknown word %q",ErrInvalidMnemonic,word)
+		}
+		for j := 0; j < 11; j++{
+			if index>>(10-uint(j))&1 == 1{
+				pos := i*11 + j
+				data[pos/8] |= 1 << (7 - uint(pos%8))
+			}
+		}
+	}
+
+	checksumBits := totalBits / 33
+	entropy := data[:(totalBits-checksumBits)/8]
+	checksum := sha256.Sum256(entropy)
+	if data[len(entropy)]>>(8-uint(checksumBits)) != checksum[0]>>(8-uint(checksumBits)){
+		return nil,fmt.Errorf("%w: checksum mismatch",ErrInvalidMnemonic)
+	}
+	return entropy,nil
+}
+
+//由助记词和可选的口令（第25个单词）计算64字节的种子。
+//口令不同得到完全不同的种子，所以口令错了不会报错，只是恢复出别的地址
+func MnemonicToSeed(mnemonic,passphrase string) ([]byte,error){
+	_,err := MnemonicToEntropy(mnemonic)
+	if err != nil{
+		return nil,err
+	}
+	normalized := strings.Join(strings.Fields(strings.ToLower(mnemonic))," ")
+	return pbkdf2.Key([]byte(normalized),[]byte(mnemonicSaltPrefix+passphrase),mnemonicIterations,64,sha512.New),nil
+}
+
+//单词 --> 在单词表中的序号
+var bip39Index = func() map[string]int{
+	index := make(map[string]int,len(bip39WordList))
+	for i,word := range bip39WordList{
+		index[word] = i
+	}
+	return index
+}()
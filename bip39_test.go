@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//BIP39的测试向量，种子的口令是TREZOR
+func TestBIP39Vectors(t *testing.T){
+	tests := []struct{
+		entropy,mnemonic,seed string
+	}{
+		{"00000000000000000000000000000000",
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"},
+		{"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607"},
+		{"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad"},
+	}
+	for _,tt := range tests{
+		entropy,_ := hex.DecodeString(tt.entropy)
+		mnemonic,err := EntropyToMnemonic(entropy)
+		if err != nil || mnemonic != tt.mnemonic{
+			t.Errorf("EntropyToMnemonic(%s) = %q, %v, want %q",tt.entropy,mnemonic,err,tt.mnemonic)
+		}
+		back,err := MnemonicToEntropy(tt.mnemonic)
+		if err != nil || !bytes.Equal(back,entropy){
+			t.Errorf("MnemonicToEntropy(%q) = %x, %v",tt.mnemonic,back,err)
+		}
+		seed,err := MnemonicToSeed(tt.mnemonic,"TREZOR")
+		if err != nil || hex.EncodeToString(seed) != tt.seed{
+			t.Errorf("MnemonicToSeed(%q) = %x, %v, want %s",tt.mnemonic,seed,err,tt.seed)
+		}
+	}
+}
+
+func TestMnemonicRejects(t *testing.T){
+	tests := []string{
+		"",
+		"abandon abandon abandon",
+		strings.Repeat("abandon ",12), //校验位不对
+		strings.Repeat("abandon ",11) + "bitcoins", //不在单词表中
+		strings.Repeat("abandon ",13) + "about",    //单词个数不是3的倍数
+	}
+	for _,mnemonic := range tests{
+		if _,err := MnemonicToSeed(mnemonic,""); !errors.Is(err,ErrInvalidMnemonic){
+			t.Errorf("MnemonicToSeed(%q): err = %v, want ErrInvalidMnemonic",mnemonic,err)
+		}
+	}
+	if _,err := EntropyToMnemonic(make([]byte,17)); !errors.Is(err,ErrInvalidMnemonic){
+		t.Errorf("136 bit entropy: err = %v, want ErrInvalidMnemonic",err)
+	}
+	if _,err := NewMnemonic(100); !errors.Is(err,ErrInvalidMnemonic){
+		t.Errorf("NewMnemonic(100): err = %v, want ErrInvalidMnemonic",err)
+	}
+}
+
+//大小写和多余的空白不影响种子
+func TestMnemonicNormalized(t *testing.T){
+	mnemonic,err := NewMnemonic(256)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if n := len(strings.Fields(mnemonic)); n != 24{
+		t.Fatalf("NewMnemonic(256) has %d words, want 24",n)
+	}
+	seed,_ := MnemonicToSeed(mnemonic,"")
+	messy,err := MnemonicToSeed("  "+strings.ToUpper(strings.ReplaceAll(mnemonic," ","  \t"))+"\n","")
+	if err != nil || !bytes.Equal(seed,messy){
+		t.Errorf("seed of the unnormalized mnemonic differs: %v",err)
+	}
+}
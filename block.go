@@ -9,6 +9,9 @@ import (
 	"time"
 )
 
+//计算重量用的区块头字节数：版本、前一区块hash、默克尔根、时间戳、难度、随机数
+const blockHeaderSize = 80
+
 //确定nonce随机数的最大值，用无符号整数防止溢出
 var maxnonce uint32 = math.MaxUint32
 
@@ -51,16 +54,30 @@ func (block *Block) Serialize() []byte{
 	return encoded.Bytes()
 }
 
-//区块数据反序列化
-func DeserializeBlock(d []byte) *Block{
+//区块数据反序列化，数据损坏时返回ErrInvalidBlock
+func DeserializeBlock(d []byte) (*Block,error){
 	var block Block
 	decode := gob.NewDecoder(bytes.NewReader(d))
 	err := decode.Decode(&block)
 
 	if err !=nil{
-		log.Panic(err)
+		return nil,fmt.Errorf("%w: %v",ErrInvalidBlock,err)
+	}
+	return &block,nil
+}
+
+//区块的重量：区块头按blockHeaderSize字节计算，加上全部交易的重量，不能超过chainParams.MaxBlockWeight
+func (block *Block) Weight() int{
+	return blockWeight(block.Transations)
+}
+
+//由这些交易组成的区块的重量，挖矿之前就能算出来
+func blockWeight(transations []*Transation) int{
+	weight := blockHeaderSize*chainParams.WitnessScaleFactor
+	for _,tx := range transations{
+		weight += tx.Weight()
 	}
-	return &block
+	return weight
 }
 
 //格式化打印交易完整信息
@@ -74,6 +91,7 @@ func (block *Block) ToString() {
 	fmt.Printf("	Bites:%d\n",block.Bits)
 	fmt.Printf("	Nonce:%x\n",block.Nonce)
 	fmt.Printf("	number of Transations:%d\n",len(block.Transations))
+	fmt.Printf("	Weight:%d\n",block.Weight())
 
 }
 
@@ -7,12 +7,19 @@ import (
 	"errors"
 	"fmt"
 	"github.com/boltdb/bolt-master"
-	"log"
+	"time"
 )
 
 const dbFile = "blockchain.db"
 const blockBucket ="blocks"
 const genesisdata ="Tom blockChain"
+const dbOpenTimeout = 3*time.Second  //打开数据库时等待文件锁的最长时间
+
+//区块链数据格式的版本，新建区块链时写在区块桶的"V"中，打开时检查。
+//没有版本号的旧数据库不兼容：金额以个为单位（挖矿奖励是100），现在以1e-8个为单位，
+//旧区块中的余额会显示成0.00000100；交易ID和签名也是按gob序列化计算的，和现在的格式不同。
+//旧数据没有可靠的迁移办法（改动金额会让旧交易的ID和签名都对不上），只能删除blockchain.db重新建链
+const chainFormatVersion = 1
 
 // 注意，矿工的钱包地址一定要在钱包集中，不然以后转账时在钱包集中找不到矿工钱包地址，会出现map容器返回空指针。
 const minneraddress = "14npxLBj8eGwCcGJPiuqoG4U6ssW7KA3hs"
@@ -41,27 +48,34 @@ func (bc *BlockChain) iterator() * BlockChainIterator{
 }
 
 //获取迭代器所指的当前块, 读完后就指向前一个区块的hash值。 根据每个hash值在数据库中找到对应的区块序列化数据。
-func (bci *BlockChainIterator) Next() *Block{
+func (bci *BlockChainIterator) Next() (*Block,error){
 	var block *Block
 	err := bci.db.View(func(tx *bolt.Tx) error{
 		b:=tx.Bucket([]byte(blockBucket))
 		data := b.Get(bci.currenthash)
-		block = DeserializeBlock(data)
-		return nil
+		if data == nil{
+			return fmt.Errorf("%w: %x",ErrBlockNotFound,bci.currenthash)
+		}
+		var err error
+		block,err = DeserializeBlock(data)
+		return err
 	})
 	if err!=nil{
-		log.Panic(err)
+		return nil,err
 	}
 	bci.currenthash = block.PrevBlockHash
-	return block
+	return block,nil
 }
 
 //遍历打印区块链
-func (bc *BlockChain) PrintBlockChain(){
+func (bc *BlockChain) PrintBlockChain() error{
 	bci := bc.iterator()
 
 	for{
-		block := bci.Next()
+		block,err := bci.Next()
+		if err != nil{
+			return err
+		}
 		block.ToString()
 		fmt.Println()
 
@@ -70,15 +84,17 @@ func (bc *BlockChain) PrintBlockChain(){
 			break
 		}
 	}
+	return nil
 }
 
 //创建一个区块链. 不存在就创建，存在就获取最新的区块信息, 参数是矿工地址:base58编码的字符串，不是字节数组
-func NewBlockChain(address string) *BlockChain{
+func NewBlockChain(address string) (*BlockChain,error){
 	var tip []byte
 
-	db,err := bolt.Open(dbFile,0600,nil)
+	//节点程序运行时数据库被它锁住，等一会儿还打不开就报错，不要一直卡住
+	db,err := bolt.Open(dbFile,0600,&bolt.Options{Timeout: dbOpenTimeout})
 	if err !=nil{
-		log.Panic(err)
+		return nil,err
 	}
 	err = db.Update(func(tx *bolt.Tx) error{
 
@@ -87,32 +103,46 @@ func NewBlockChain(address string) *BlockChain{
 			fmt.Println("区块链不存在，建立创世区块，建立新的区块链")
 			b,err:=tx.CreateBucket([]byte(blockBucket))
 			if err !=nil{
-				log.Panic(err)
+				return err
 			}
 
 			//建立CoinBase挖矿奖励交易
-			transation := NewCoinbaseTX(address, genesisdata)
+			transation,err := NewCoinbaseTX(address, genesisdata, 0)
+			if err !=nil{
+				return err
+			}
 			genesis := NewGensisBlock([]*Transation{transation})   //建立创世区块
 
 			err = b.Put(genesis.Hash, genesis.Serialize())  //区块数据写入数据库桶中
 			if err !=nil{
-				log.Panic(err)
+				return err
 			}
 			err = b.Put([]byte("L"),genesis.Hash)  //新区块与“L”关联， L表示last，以后方便的寻找到区块链的最新头部
 			if err !=nil{
-				log.Panic(err)
+				return err
 			}
 			tip = genesis.Hash
+			err = b.Put([]byte("V"),[]byte{chainFormatVersion})
+			if err !=nil{
+				return err
+			}
 		}else{
-			//区块链存在，获取“L”对应的区块数据
+			//区块链存在，先检查数据格式的版本，再获取“L”对应的区块数据
+			version := b.Get([]byte("V"))
+			if !bytes.Equal(version,[]byte{chainFormatVersion}){
+				return fmt.Errorf("%w: %s was created by an older version (amounts in whole coins, gob transation hashes); delete it to create a new chain",ErrChainFormat,dbFile)
+			}
 			tip = b.Get([]byte("L"))
 		}
 
-		return nil
+		//交易池的桶，旧的数据库文件中没有，这里补上
+		_,err := tx.CreateBucketIfNotExists([]byte(mempoolBucket))
+		return err
 	})
 
 	if err !=nil{
-		log.Panic(err)
+		db.Close()
+		return nil,err
 	}
 
 	//根据tip和db建立区块链对象
@@ -120,61 +150,93 @@ func NewBlockChain(address string) *BlockChain{
 
 	//重新创建UTXO数据库桶，从数据库文件中恢复UTXO
 	set := UTXOSet{&bc}
-	set.Reindex()
+	err = set.Reindex()
+	if err !=nil{
+		db.Close()
+		return nil,err
+	}
 
-	return &bc
+	return &bc,nil
+}
+
+//关闭区块链数据库
+func (bc *BlockChain) Close() error{
+	return bc.db.Close()
 }
 
 //这个就是链上的挖矿动作，链上添加一个区块，记录到数据库中
-func (bc *BlockChain) MineBlock(transations []*Transation) *Block{
-	//先检查输入的交易签名是否正确
-	for _,tx := range transations {
-		if bc.VerifyTransation(tx) == false {
-			log.Panic("BlockChain.MineBlock() : ERROR: Invalid transation!")
-		} else {
-			fmt.Println("BlockChain.MineBlock() :transation verify success!")
-		}
+func (bc *BlockChain) MineBlock(transations []*Transation) (*Block,error){
+	//先检查区块大小，再检查输入的交易签名是否正确，所有签名并行验证
+	err := checkBlockLimits(transations)
+	if err != nil {
+		return nil,fmt.Errorf("BlockChain.MineBlock(): %w: %v",ErrInvalidBlock,err)
 	}
+	err = bc.VerifyTransations(transations)
+	if err != nil {
+		return nil,fmt.Errorf("BlockChain.MineBlock(): %w",err)
+	}
+	fmt.Println("BlockChain.MineBlock() :transation verify success!")
 
 	//从数据库中找到最新区块
 	var lasthash []byte
 	var lastheight  int32
-	err := bc.db.View(func(tx * bolt.Tx)error{
+	err = bc.db.View(func(tx * bolt.Tx)error{
 		b:= tx.Bucket([]byte(blockBucket))
 		lasthash = b.Get([]byte("L"))
 		blockdata := b.Get(lasthash)
-		block := DeserializeBlock(blockdata)
+		if blockdata == nil{
+			return fmt.Errorf("%w: %x",ErrBlockNotFound,lasthash)
+		}
+		block,err := DeserializeBlock(blockdata)
+		if err != nil{
+			return err
+		}
 		lastheight = block.Height
 		return nil
 	})
 	if err!=nil{
-		log.Panic(err)
+		return nil,err
 	}
 	newBlock := NewBlock(transations, lasthash,lastheight+1)
 
 	//把新区块写入数据库中
-	bc.db.Update(func(tx *bolt.Tx) error{
+	err = bc.db.Update(func(tx *bolt.Tx) error{
 		b:=tx.Bucket([]byte(blockBucket))
 		err:=b.Put(newBlock.Hash,newBlock.Serialize())
 		if err !=nil{
-			log.Panic(err)
+			return err
 		}
 		//把“L”关联新区块hash值
 		err = b.Put([]byte("L"),newBlock.Hash)
 		if err !=nil{
-			log.Panic(err)
+			return err
 		}
 
 		bc.tip = newBlock.Hash
 		return nil
 	})
-	return newBlock
+	if err!=nil{
+		return nil,err
+	}
+
+	//新区块接在最新区块后面，更新UTXO集，下一个区块验证时要用
+	err = UTXOSet{bc}.update(newBlock)
+	if err!=nil{
+		return nil,err
+	}
+
+	//已经打包的交易从交易池中删除
+	err = Mempool{bc}.removeForBlock(newBlock)
+	if err!=nil{
+		return nil,err
+	}
+	return newBlock,nil
 }
 
 //================这段代码3个函数是老师视频中定义的，我认为有bug，改进带代码在下一段 ==================================================================
 
 //找出指定用户address的所有未花费输出，需要遍历整个区块链
-func (bc *BlockChain) FindUnspentTransations(pubkeyhash []byte) []Transation{
+func (bc *BlockChain) FindUnspentTransations(pubkeyhash []byte) ([]Transation,error){
 	var unspentTXs []Transation  //所有未花费的交易记录
 
 	/*定义映射关系:
@@ -186,7 +248,10 @@ func (bc *BlockChain) FindUnspentTransations(pubkeyhash []byte) []Transation{
 	// 第一层循环：遍历区块链的区块
 	bci :=bc.iterator()
 	for{
-		block := bci.Next()
+		block,err := bci.Next()
+		if err != nil{
+			return nil,err
+		}
 
 		//第二层循环：遍历该区块中的每一笔交易
 		for _,tx := range block.Transations{
@@ -231,12 +296,15 @@ func (bc *BlockChain) FindUnspentTransations(pubkeyhash []byte) []Transation{
 
 	}
 	//fmt.Println(unspentTXs)
-	return unspentTXs
+	return unspentTXs,nil
 }
 
-func (bc *BlockChain) FindUTXO(pubkeyhash []byte) []TXOutput{
+func (bc *BlockChain) FindUTXO(pubkeyhash []byte) ([]TXOutput,error){
 	var UTXOs []TXOutput
-	unspentTXs:= bc.FindUnspentTransations(pubkeyhash)
+	unspentTXs,err := bc.FindUnspentTransations(pubkeyhash)
+	if err != nil{
+		return nil,err
+	}
 
 	for _,tx :=range unspentTXs{
 		for _,out := range tx.Vout{
@@ -246,14 +314,17 @@ func (bc *BlockChain) FindUTXO(pubkeyhash []byte) []TXOutput{
 		}
 	}
 
-	return UTXOs
+	return UTXOs,nil
 }
 
 //找出能满足指定（地址+金额）的 未花费交易输出，用这些交易作为输入够转账了
-func (bc *BlockChain) FindSpendableOutputs(pubkeyhash []byte, amount int) (int,map[string][]int){
+func (bc *BlockChain) FindSpendableOutputs(pubkeyhash []byte, amount Amount) (Amount,map[string][]int,error){
 	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransations(pubkeyhash)
-	accumulated :=0   //检查累计金额
+	unspentTXs,err := bc.FindUnspentTransations(pubkeyhash)
+	if err != nil{
+		return 0,nil,err
+	}
+	var accumulated Amount   //检查累计金额
 
 breakPoint: for _,tx := range unspentTXs{
 	txID := hex.EncodeToString(tx.ID)
@@ -269,14 +340,14 @@ breakPoint: for _,tx := range unspentTXs{
 	}
 }
 
-	return accumulated,unspentOutputs
+	return accumulated,unspentOutputs,nil
 }
 
 //==================自己改进的代码=======================================================
 //找出指定用户address的所有未花费输出，需要遍历整个区块链
 //改进了bug：当发现交易中的一笔未花费输出时没有记录下输出的序号Voutindex，而是添加这条交易。应该要保存这条交易和输出序号。
 //返回：多了一个每条交易的输出序号数组
-func (bc *BlockChain) FindUnspentTransations2(pubkeyhash []byte) ([]Transation, map[string][]int){
+func (bc *BlockChain) FindUnspentTransations2(pubkeyhash []byte) ([]Transation, map[string][]int, error){
 	var unspentTXs []Transation  //所有未花费的交易记录
 	var unspendTXOs = make(map[string][]int)   //未花费交易输出序号， key是交易的ID字符串，value是输出序号数组
 
@@ -289,7 +360,10 @@ func (bc *BlockChain) FindUnspentTransations2(pubkeyhash []byte) ([]Transation,
 	// 第一层循环：遍历区块链的区块
 	bci :=bc.iterator()
 	for{
-		block := bci.Next()
+		block,err := bci.Next()
+		if err != nil{
+			return nil,nil,err
+		}
 
 		//第二层循环：遍历该区块中的每一笔交易
 		for _,tx := range block.Transations{
@@ -335,12 +409,15 @@ func (bc *BlockChain) FindUnspentTransations2(pubkeyhash []byte) ([]Transation,
 
 	}
 	//fmt.Println(unspentTXs)
-	return unspentTXs,unspendTXOs
+	return unspentTXs,unspendTXOs,nil
 }
 
-func (bc *BlockChain) FindUTXO2(pubkeyhash []byte) []TXOutput{
+func (bc *BlockChain) FindUTXO2(pubkeyhash []byte) ([]TXOutput,error){
 	var UTXOs []TXOutput
-	unspentTXs,unspendTXOs := bc.FindUnspentTransations2(pubkeyhash)
+	unspentTXs,unspendTXOs,err := bc.FindUnspentTransations2(pubkeyhash)
+	if err != nil{
+		return nil,err
+	}
 
 	for _,tx :=range unspentTXs{
 		txID := hex.EncodeToString(tx.ID)  //交易的hash值转成字符串形式
@@ -351,14 +428,17 @@ func (bc *BlockChain) FindUTXO2(pubkeyhash []byte) []TXOutput{
 			}
 		}
 	}
-	return UTXOs
+	return UTXOs,nil
 }
 
 //找出能满足指定（地址+金额）的 未花费交易输出，用这些交易作为输入够转账了
-func (bc *BlockChain) FindSpendableOutputs2(pubkeyhash []byte, amount int) (int,map[string][]int){
+func (bc *BlockChain) FindSpendableOutputs2(pubkeyhash []byte, amount Amount) (Amount,map[string][]int,error){
 	unspentOutputs := make(map[string][]int)
-	unspentTXs,unspendTXOs := bc.FindUnspentTransations2(pubkeyhash)
-	accumulated :=0   //检查累计金额
+	unspentTXs,unspendTXOs,err := bc.FindUnspentTransations2(pubkeyhash)
+	if err != nil{
+		return 0,nil,err
+	}
+	var accumulated Amount   //检查累计金额
 
 	breakPoint: for _,tx := range unspentTXs{
 		txID := hex.EncodeToString(tx.ID)  //交易的hash值转成字符串形式
@@ -374,11 +454,16 @@ func (bc *BlockChain) FindSpendableOutputs2(pubkeyhash []byte, amount int) (int,
 		}
 	}
 
-	return accumulated,unspentOutputs
+	return accumulated,unspentOutputs,nil
 }
 
 //查找链上所有未花费交易输出，用于计算各个钱包的余额
-func (bc *BlockChain) FindAllUTXO() map[string]TXOutputs{
+func (bc *BlockChain) FindAllUTXO() (map[string]TXOutputs,error){
+	return bc.findUTXOFrom(bc.tip)
+}
+
+//从hash指定的区块往前遍历到创世区块，找出这条链上所有的未花费交易输出。hash为空时没有输出
+func (bc *BlockChain) findUTXOFrom(hash []byte) (map[string]TXOutputs,error){
 	var utxo = make(map[string]TXOutputs)   //未花费交易输出集合， key是交易的ID字符串，value是TXOutput切片
 
 	/*定义映射关系:
@@ -387,10 +472,17 @@ func (bc *BlockChain) FindAllUTXO() map[string]TXOutputs{
 	表示这笔交易（hash）的输出序号，已经被花费了。 */
 	spendTXOs := make(map[string][]int)   //已花费交易记录
 
+	if len(hash) == 0{
+		return utxo,nil
+	}
+
 	// 第一层循环：遍历区块链的区块
-	bci :=bc.iterator()
+	bci := &BlockChainIterator{hash,bc.db}
 	for{
-		block := bci.Next()
+		block,err := bci.Next()
+		if err != nil{
+			return nil,err
+		}
 
 		//第二层循环：遍历该区块中的每一笔交易
 		for _,tx := range block.Transations{
@@ -410,7 +502,10 @@ func (bc *BlockChain) FindAllUTXO() map[string]TXOutputs{
 
 				// 程序跑到这里说明这笔输出未被花费，写入未花费交易记录。注意检查指定地址
 				outs :=utxo[txID]
-				outs.Outputs = append(outs.Outputs, out)
+				if outs.Outputs == nil{
+					outs.Outputs = make(map[int]TXOutput)
+				}
+				outs.Outputs[outIdx] = out
 				utxo[txID] = outs
 			}
 
@@ -431,33 +526,43 @@ func (bc *BlockChain) FindAllUTXO() map[string]TXOutputs{
 
 	}
 
-	return utxo
+	return utxo,nil
 }
 
 //================================================================================
-func (bc * BlockChain) SignTransation(tx *Transation,prikey ecdsa.PrivateKey) {
+func (bc * BlockChain) SignTransation(tx *Transation,prikey ecdsa.PrivateKey,hashType SigHashType) error{
 
 	//定义映射，ID-->Transation， 保存所有的vin
 	prevTXs := make(map[string]Transation)
 	for _,vin :=range tx.Vin{
-		//根据ID在之前的区块中找到这笔交易
+		//根据ID在之前的区块中找到这笔交易，链上没有就到交易池中找（花费还没有确认的找零）
 		prevTX, err := bc.FindTransationById(vin.TXid)
+		if errors.Is(err,ErrTxNotFound){
+			var pooled *Transation
+			pooled,err = Mempool{bc}.Get(vin.TXid)
+			if err == nil{
+				prevTX = *pooled
+			}
+		}
 		if err!=nil{
-			log.Panic(err)
+			return err
 		}
 		prevTXs[hex.EncodeToString(vin.TXid)]=prevTX
 	}
 
 	//再次封装，真实的签名动作。
-	tx.Sign(prikey,prevTXs)
+	return tx.Sign(prikey,prevTXs,hashType)
 }
 
 
-//在链中查找指定ID的交易，不存在就返回错误
+//在链中查找指定ID的交易，不存在就返回ErrTxNotFound
 func (bc *BlockChain) FindTransationById(ID []byte)(Transation,error){
 	bci := bc.iterator()
 	for{
-		block :=bci.Next()
+		block,err :=bci.Next()
+		if err != nil{
+			return Transation{},err
+		}
 		for _,tx := range block.Transations{
 			if bytes.Compare(tx.ID,ID)==0{
 				return *tx, nil
@@ -469,59 +574,68 @@ func (bc *BlockChain) FindTransationById(ID []byte)(Transation,error){
 		}
 	}
 
-	return Transation{},errors.New("error: transation is not find!")
+	return Transation{},fmt.Errorf("%w: %x",ErrTxNotFound,ID)
 }
 
-//校验交易的数据签名是否正确
-func (bc *BlockChain) VerifyTransation(tx *Transation) bool{
-	//得到Vin中所有的引用交易，对这些引用的交易每一笔都进行检验
-	prevTXs := make(map[string]Transation)
-
-	for _,vin := range tx.Vin{
-		prevTX,err := bc.FindTransationById(vin.TXid)
-		checkErr(err)
-		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
+//校验交易的数据签名是否正确，签名错误返回ErrInvalidTransation，引用的输出不存在或已经花费返回ErrOutputSpent
+func (bc *BlockChain) VerifyTransation(tx *Transation) error{
+	//coinbase交易没有引用的交易，不用到链上查找
+	if tx.isCoinBase(){
+		return nil
 	}
-	return tx.Verify(prevTXs)
+
+	//在UTXO集中找到Vin引用的输出，各个输入的签名分给worker并行检验
+	return bc.VerifyTransations([]*Transation{tx})
 }
 
 //获取最高高度
-func (bc *BlockChain) GetBestHeight() int32{
-	var lastBlock Block
+func (bc *BlockChain) GetBestHeight() (int32,error){
+	var lastBlock *Block
 	err := bc.db.View(func(tx *bolt.Tx) error{
 		b:=tx.Bucket([]byte(blockBucket))
 		lastHash:=b.Get([]byte("L"))
 		blockdata := b.Get(lastHash)
-		lastBlock = *DeserializeBlock(blockdata)
-
-		return nil
+		if blockdata == nil{
+			return fmt.Errorf("%w: %x",ErrBlockNotFound,lastHash)
+		}
+		var err error
+		lastBlock,err = DeserializeBlock(blockdata)
+		return err
 	})
-	checkErr(err)
-	return lastBlock.Height
+	if err != nil{
+		return 0,err
+	}
+	return lastBlock.Height,nil
 }
 
 //获取全部区块的Hash，返回的是hash数组
-func (bc *BlockChain) GetBlockHash() [][]byte {
+func (bc *BlockChain) GetBlockHash() ([][]byte,error) {
 	var blocks [][]byte
 	bci := bc.iterator()
 	for{
-		block:=bci.Next()
+		block,err:=bci.Next()
+		if err != nil{
+			return nil,err
+		}
 		blocks = append(blocks,block.Hash)
 
 		if len(block.PrevBlockHash)==0{
 			break
 		}
 	}
-	return blocks
+	return blocks,nil
 }
 
 //获取指定区块范围的Hash，返回的是hash数组
-func (bc *BlockChain) GetBlockHashScope(low int32, high int32) [][]byte {
+func (bc *BlockChain) GetBlockHashScope(low int32, high int32) ([][]byte,error) {
 	var blocks [][]byte
 	bci := bc.iterator()
 	fmt.Printf("GetBlockHashScope: low=%d, high=%d\n", low,high)
 	for{
-		block:=bci.Next()
+		block,err:=bci.Next()
+		if err != nil{
+			return nil,err
+		}
 
 		if (block.Height >= high) && (block.Height <= high) {
 			blocks = append(blocks,block.Hash)
@@ -535,7 +649,7 @@ func (bc *BlockChain) GetBlockHashScope(low int32, high int32) [][]byte {
 			break
 		}
 	}
-	return blocks
+	return blocks,nil
 }
 
 //从数据库中找出指定区块数据
@@ -545,42 +659,142 @@ func (bc *BlockChain) GetBlock(blockHash []byte) (Block, error) {
 		b := tx.Bucket([]byte(blockBucket))
 		blockData := b.Get(blockHash)
 		if blockData == nil{
-			return errors.New("GetBlock(): Block is not Found in Bucket!")
+			return fmt.Errorf("GetBlock(): %w: %x",ErrBlockNotFound,blockHash)
+		}
+		pblock,err := DeserializeBlock(blockData)
+		if err != nil{
+			return err
 		}
-		block = *DeserializeBlock(blockData)
+		block = *pblock
 		return nil
 	})
 
 	return block,err
 }
 
-//把区块写入数据库中
-func (bc *BlockChain) AddBlock(block *Block){
-	err := bc.db.Update(func(tx *bolt.Tx) error{
-		b := tx.Bucket([]byte(blockBucket))
+//把区块写入数据库中，写入前验证区块中的全部交易签名
+func (bc *BlockChain) AddBlock(block *Block) error{
+	//添加前先在桶中查找下这个区块Hash， 检查是否已经存在，不存在才验证和添加
+	var exists bool
+	err := bc.db.View(func(tx *bolt.Tx) error{
+		exists = tx.Bucket([]byte(blockBucket)).Get(block.Hash) != nil
+		return nil
+	})
+	if err != nil{
+		return err
+	}
+	if exists{
+		fmt.Printf("AddBlock(): Block is already exist in Bucket!\n")
+		return nil
+	}
 
-		//添加前先在桶中查找下这个区块Hash， 检查是否已经存在，不存在才添加
-		blockIndb := b.Get(block.Hash)
-		if blockIndb != nil{
-			fmt.Printf("AddBlock(): Block is already exist in Bucket!\n")
-			return nil
-		}
+	err = bc.VerifyBlock(block)
+	if err != nil{
+		return fmt.Errorf("AddBlock(): %w",err)
+	}
+
+	var newTip,extendsTip bool
+	var disconnected,connected []*Block
+	err = bc.db.Update(func(tx *bolt.Tx) error{
+		b := tx.Bucket([]byte(blockBucket))
 		blockdata := block.Serialize()
 		err  := b.Put(block.Hash,blockdata)
-		checkErr(err)
+		if err != nil{
+			return err
+		}
 
 		//检查区块链上的最新区块高度与新添加的区块高度， 更新最新区块映射
 		lastHash := b.Get([]byte("L"))
-		lastBlockData := b.Get(lastHash)
-		lastBlock := DeserializeBlock(lastBlockData)
+		lastBlock,err := DeserializeBlock(b.Get(lastHash))
+		if err != nil{
+			return err
+		}
 		if block.Height > lastBlock.Height {
 			err:= b.Put([]byte("L"), block.Hash)
-			checkErr(err)
+			if err != nil{
+				return err
+			}
 			bc.tip = block.Hash
+			newTip = true
+			extendsTip = bytes.Equal(block.PrevBlockHash,lastHash)
+			if !extendsTip{
+				disconnected,connected,err = reorgBranches(b,lastBlock,block)
+				if err != nil{
+					return err
+				}
+			}
 		}
 
 		return nil
 	})
+	if err != nil || !newTip{
+		return err
+	}
+
+	//接在原来的最新区块后面时只更新这个区块的UTXO，切换到分叉时整个重建
+	set := UTXOSet{bc}
+	if extendsTip{
+		err = set.update(block)
+	}else{
+		err = set.Reindex()
+	}
+	if err != nil{
+		return err
+	}
+
+	//区块成为最新区块后，它包含的交易和与之冲突的交易从交易池中删除。
+	//切换到分叉时，分叉上新接入的每个区块都要这样处理
+	pool := Mempool{bc}
+	if extendsTip{
+		connected = []*Block{block}
+	}
+	for _,b := range connected{
+		err = pool.removeForBlock(b)
+		if err != nil{
+			return err
+		}
+	}
+
+	//被切换掉的区块中的交易重新放入交易池，从最老的区块开始，父交易先进池。
+	//已经在新链上、和新链冲突或者引用了被切换掉的挖矿奖励的交易放不进去，直接丢弃
+	for _,b := range disconnected{
+		for _,tx := range b.Transations{
+			if tx.isCoinBase(){
+				continue
+			}
+			err = pool.Add(tx)
+			if err != nil{
+				fmt.Printf("AddBlock(): transation %x from disconnected block dropped: %v\n",tx.ID,err)
+			}
+		}
+	}
+	return nil
+}
 
-	checkErr(err)
+//切换到分叉时，从原来的最新区块oldTip和新的最新区块newTip往回找到共同的祖先区块，
+//返回原链上被切换掉的区块和分叉上新接入的区块，都按从老到新的顺序排列
+func reorgBranches(b *bolt.Bucket, oldTip, newTip *Block) ([]*Block,[]*Block,error){
+	parent := func(block *Block) (*Block,error){
+		data := b.Get(block.PrevBlockHash)
+		if data == nil{
+			return nil,fmt.Errorf("%w: missing parent of block %x",ErrBlockNotFound,block.Hash)
+		}
+		return DeserializeBlock(data)
+	}
+
+	var disconnected,connected []*Block
+	var err error
+	for !bytes.Equal(oldTip.Hash,newTip.Hash){
+		if oldTip.Height >= newTip.Height{
+			disconnected = append([]*Block{oldTip},disconnected...)
+			oldTip,err = parent(oldTip)
+		}else{
+			connected = append([]*Block{newTip},connected...)
+			newTip,err = parent(newTip)
+		}
+		if err != nil{
+			return nil,nil,err
+		}
+	}
+	return disconnected,connected,nil
 }
@@ -1,16 +1,50 @@
 package main
 
 import (
+	"bufio"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
 )
 
+//命令行程序。区块链数据库在第一次用到时才打开，
+//这样只有钱包文件的离线机器也可以执行签名等不需要区块链的命令
 type CLI struct{
 	bc * BlockChain
 }
 
+//返回区块链对象，还没有打开时打开数据库
+func (cli *CLI) chain() (*BlockChain,error){
+	if cli.bc == nil{
+		bc,err := NewBlockChain(minneraddress)
+		if err != nil{
+			return nil,err
+		}
+		cli.bc = bc
+	}
+	return cli.bc,nil
+}
+
+//关闭打开过的区块链数据库
+func (cli *CLI) Close() error{
+	if cli.bc == nil{
+		return nil
+	}
+	err := cli.bc.Close()
+	cli.bc = nil
+	return err
+}
+
 //检查命令行参数个数
 func (cli *CLI) validateArgs(){
 	if len(os.Args) <=1 {
@@ -20,16 +54,72 @@ func (cli *CLI) validateArgs(){
 	//println(os.Args)
 }
 
+//解析命令行中 整数.小数 格式的金额参数。allowZero为false时金额必须大于0
+func parseAmountFlag(name, s string, allowZero bool) (Amount,error){
+	amount,err := ParseAmount(s)
+	if err != nil{
+		return 0,fmt.Errorf("-%s: %w",name,err)
+	}
+	if amount == 0 && !allowZero{
+		return 0,fmt.Errorf("-%s: %w: must be positive",name,ErrInvalidAmount)
+	}
+	return amount,nil
+}
+
+//检查命令行中的地址参数，错误信息说明是哪个参数、哪里不对
+func checkAddressFlag(name, s string) error{
+	_,err := DecodeAddress(s,chainParams)
+	if err != nil{
+		return fmt.Errorf("-%s: %w",name,err)
+	}
+	return nil
+}
+
 func (cli *CLI) printUsage(){
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-wallet NAME] COMMAND ...  -wallet选择已加载的命名钱包，不写时使用默认钱包wallet.dat")
 	fmt.Println("	addBlock: 增加区块")
 	fmt.Println("	printChain:打印所有区块")
-	fmt.Println("	getBalance -address Tom: 查询Tom的账户余额")
-	fmt.Println("	send -from  Tom  -to Jerry -amount 20: Tom转账给Jerry 20")
-	fmt.Println("	createWallet :创建一个钱包地址")
-	fmt.Println("	listAddress :显示所有钱包地址")
+	fmt.Println("	getBalance [-address Tom]: 查询Tom的账户余额，不给-address时列出钱包中每个地址（包括只读地址）的余额和总额")
+	fmt.Println("	send -from  Tom  -to Jerry -amount 1.25 [-selector largest|smallest|bnb|random] [-seed N] [-sighash ALL|NONE|SINGLE[|ANYONECANPAY]] [-feerate 0.00001] [-rbf] [-mine]: Tom转账给Jerry 1.25个币，手续费为每1000字节0.00001个币，交易放入交易池并转发给其他节点，-mine表示由Tom立即挖矿确认")
+	fmt.Println("	createWallet [-curve secp256k1|P256] [-name NAME] :创建一个钱包地址，默认使用比特币的secp256k1曲线；给了-name时创建并加载一个新的命名钱包")
+	fmt.Println("	loadWallet -name NAME: 加载命名钱包，之后可以用 -wallet NAME 选择")
+	fmt.Println("	unloadWallet -name NAME: 卸载命名钱包，钱包文件保留")
+	fmt.Println("	listWallets: 列出默认钱包、已加载和未加载的命名钱包")
+	fmt.Println("	listAddress :显示所有钱包地址，HD钱包的地址后面是派生路径，找零地址标记所属的发送地址，只读地址标记为watch-only")
+	fmt.Println("	getNewAddress: 从密钥池取一个新的收款地址，钱包锁定时也可以用")
+	fmt.Println("	vanityAddress -prefix 1Tom [-ignorecase] [-threads N]: 生成以指定前缀开头的地址并加入钱包，显示难度和进度，按Ctrl-C中止。靓号地址不是助记词派生的，要单独用dumpPrivKey备份")
+	fmt.Println("	keypoolRefill [-size 100]: 把收款和找零的密钥池补满，加密的钱包要先解锁")
+	fmt.Println("	importAddress -address A: 导入只读地址，可以查看余额，不能花费")
+	fmt.Println("	importPubkey -pubkey HEX: 导入公钥作为只读地址")
+	fmt.Println("	listTransactions [-count 20]: 显示钱包最近的交易记录：对方地址、金额、手续费、区块高度、确认数、标签和备注")
+	fmt.Println("	setLabel -address A [-label L]: 给地址加标签，-label为空时删除")
+	fmt.Println("	setNote -txid TXID [-note N]: 给钱包的交易加备注，-note为空时删除")
+	fmt.Println("	dumpPrivKey -address A: 显示地址的私钥（WIF格式），加密的钱包要先解锁")
+	fmt.Println("	backupWallet -dest PATH: 把钱包文件复制到PATH，PATH是目录时复制到目录下的同名文件。每次保存钱包时也会把旧内容自动备份到钱包目录下的wallet_backups中，保留最近10份")
+	fmt.Println("	signMessage -address A -message M: 用地址的私钥签名消息，证明拥有这个地址，加密的钱包要先解锁")
+	fmt.Println("	verifyMessage -address A -signature SIG -message M: 验证消息签名是不是这个地址的私钥签的")
+	fmt.Println("	importPrivKey [-key WIF] [-rescan]: 导入WIF格式的私钥，没给-key时从标准输入读取，-rescan重新扫描整个区块链")
+	fmt.Println("	restoreWallet -mnemonic \"word1 word2 ...\" [-mnemonicpassphrase P] [-gaplimit 20] [-name NAME]: 用助记词恢复HD钱包，扫描区块链找回用过的地址和交易记录，要求钱包文件还不存在；给了-name时恢复成命名钱包并加载")
+	fmt.Println("	rescanBlockchain [-from 0] [-to -1]: 重新扫描指定高度范围的区块，重建钱包的交易记录和未花费输出，-to -1表示到最高区块，按Ctrl-C中止")
 	fmt.Println("	getBestHeight :显示区块高度")
-	fmt.Println("	startNode -minner Tom: 启动节点，设置矿工钱包地址")
+	fmt.Println("	startNode -minner Tom [-maxmempool BYTES] [-mempoolexpiry 336h] [-minrelayfee 0.00001]: 启动节点，设置矿工钱包地址和交易池策略")
+	fmt.Println("	createPSBT -from Tom -to Jerry -amount 1.25 [-selector S] [-seed N] [-feerate 0.00001] [-rbf] -out tx.psbt: 创建未签名的部分签名交易，不需要私钥")
+	fmt.Println("	signPSBT -in tx.psbt [-out signed.psbt] [-sighash ALL]: 用钱包中的私钥签名，签名前显示输入、输出和手续费，不需要区块链数据库")
+	fmt.Println("	combinePSBT -in a.psbt,b.psbt -out tx.psbt: 合并多方的签名")
+	fmt.Println("	finalizePSBT -in tx.psbt [-out final.psbt]: 检查全部输入都已签名且签名正确")
+	fmt.Println("	broadcastPSBT -in final.psbt: 把检查过的交易放入交易池并转发给其他节点")
+	fmt.Println("	createRawTransaction -inputs txid:vout,... -outputs address:amount,... [-rbf]: 创建指定输入输出的未签名交易，输入比输出多出的部分是手续费")
+	fmt.Println("	decodeRawTransaction -hex HEX: 显示交易内容")
+	fmt.Println("	signRawTransaction -hex HEX [-sighash ALL]: 用钱包中的私钥签名能签的输入")
+	fmt.Println("	sendRawTransaction -hex HEX: 把签好名的交易放入交易池并转发给其他节点")
+	fmt.Println("	bumpFee -txid TXID [-feerate 0.00001]: 提高交易池中还没确认的交易的手续费，交易必须允许替换（send时加上-rbf）")
+	fmt.Println("	mine -address Tom: 用交易池中的全部交易挖一个新区块，奖励给Tom")
+	fmt.Println("	getMempoolInfo: 显示交易池中的交易数、总字节数、手续费和策略")
+	fmt.Println("	getRawMempool [-verbose]: 列出交易池中的交易ID，-verbose显示手续费、费率、祖先和后代")
+	fmt.Println("	encryptWallet [-passphrase P]: 用口令加密钱包中的私钥，加密后钱包是锁定的，没给-passphrase时从标准输入读取")
+	fmt.Println("	walletPassphrase [-passphrase P] [-timeout 5m]: 解锁钱包，超时之前从标准输入逐行读取命令执行，需要私钥时不再提示输入口令")
+	fmt.Println("	walletLock: 立即锁定钱包，在walletPassphrase中输入时结束解锁")
+	fmt.Println("	changePassphrase [-old P] [-new Q]: 修改钱包口令")
 
 }
 
@@ -42,7 +132,20 @@ func (cli *CLI) Run(){
 		fmt.Printf("NODE_ID is not set， please set system ENV ： NODE_ID=3000")
 		os.Exit(1)
 	}
+	nodeAddress = fmt.Sprintf("localhost:%s",nodeID)  //转发交易时跳过本节点
+
+	cli.validateArgs()
 
+	//全局参数 -wallet NAME 写在命令前面，选择命令使用的钱包
+	walletName,args,err := parseWalletSelector(os.Args[1:])
+	if err == nil{
+		err = SelectWallet(walletName)
+	}
+	if err != nil{
+		fmt.Printf("Error: %v\n",err)
+		os.Exit(1)
+	}
+	os.Args = append(os.Args[:1],args...)
 	cli.validateArgs()
 
 	addBlockCmd  := flag.NewFlagSet("addBlock"  ,flag.ExitOnError)
@@ -54,16 +157,139 @@ func (cli *CLI) Run(){
 	sendCmd := flag.NewFlagSet("send",flag.ExitOnError)
 	send_From   := sendCmd.String("from","","Source wallet address")
 	send_To     := sendCmd.String("to","","Destination wallet address")
-	send_Amount   := sendCmd.Int("amount",0,"Amount to send")
+	send_Amount   := sendCmd.String("amount","","Amount to send, e.g. 1.25")
+	send_Selector := sendCmd.String("selector","largest","Coin selection: largest|smallest|bnb|random")
+	send_Seed     := sendCmd.Int64("seed",0,"Random seed for -selector random, 0 means current time")
+	send_SigHash  := sendCmd.String("sighash","ALL","Signature hash type: ALL|NONE|SINGLE, optionally |ANYONECANPAY")
+	send_FeeRate  := sendCmd.String("feerate","0","Fee per 1000 bytes, 0 means the minimum relay fee rate")
+	send_RBF      := sendCmd.Bool("rbf",false,"Allow replacing the transation with bumpFee while it is unconfirmed")
+	send_Mine     := sendCmd.Bool("mine",false,"Mine a block from the mempool right away, rewarding -from")
 
 	//创建钱包，查看钱包地址
 	createWalletCmd := flag.NewFlagSet("createWallet",flag.ExitOnError)
+	createWallet_Curve := createWalletCmd.String("curve","secp256k1","Elliptic curve: secp256k1|P256")
+	createWallet_Name  := createWalletCmd.String("name","","Create a new named wallet instead of an address")
+	loadWalletCmd := flag.NewFlagSet("loadWallet",flag.ExitOnError)
+	loadWallet_Name := loadWalletCmd.String("name","","Wallet name")
+	unloadWalletCmd := flag.NewFlagSet("unloadWallet",flag.ExitOnError)
+	unloadWallet_Name := unloadWalletCmd.String("name","","Wallet name")
+	listWalletsCmd := flag.NewFlagSet("listWallets",flag.ExitOnError)
 	listAddressCmd := flag.NewFlagSet("listAddress",flag.ExitOnError)
+	getNewAddressCmd := flag.NewFlagSet("getNewAddress",flag.ExitOnError)
+	vanityAddressCmd := flag.NewFlagSet("vanityAddress",flag.ExitOnError)
+	vanityAddress_Prefix     := vanityAddressCmd.String("prefix","","Address prefix, starting with 1")
+	vanityAddress_IgnoreCase := vanityAddressCmd.Bool("ignorecase",false,"Match the prefix case-insensitively")
+	vanityAddress_Threads    := vanityAddressCmd.Int("threads",runtime.NumCPU(),"Number of goroutines generating keys")
+	keypoolRefillCmd := flag.NewFlagSet("keypoolRefill",flag.ExitOnError)
+	keypoolRefill_Size := keypoolRefillCmd.Int("size",0,"Keypool size, keep the current size if 0")
+	importAddressCmd := flag.NewFlagSet("importAddress",flag.ExitOnError)
+	importAddress_Address := importAddressCmd.String("address","","Address to watch")
+	importPubkeyCmd := flag.NewFlagSet("importPubkey",flag.ExitOnError)
+	importPubkey_Pubkey := importPubkeyCmd.String("pubkey","","Hex encoded public key to watch")
+	listTransactionsCmd := flag.NewFlagSet("listTransactions",flag.ExitOnError)
+	listTransactions_Count := listTransactionsCmd.Int("count",20,"Number of most recent transations to show, 0 for all")
+	setLabelCmd := flag.NewFlagSet("setLabel",flag.ExitOnError)
+	setLabel_Address := setLabelCmd.String("address","","Address to label")
+	setLabel_Label   := setLabelCmd.String("label","","Label, empty removes it")
+	setNoteCmd := flag.NewFlagSet("setNote",flag.ExitOnError)
+	setNote_TxID := setNoteCmd.String("txid","","Wallet transation ID")
+	setNote_Note := setNoteCmd.String("note","","Note, empty removes it")
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpPrivKey",flag.ExitOnError)
+	dumpPrivKey_Address := dumpPrivKeyCmd.String("address","","Address whose private key to print")
+	backupWalletCmd := flag.NewFlagSet("backupWallet",flag.ExitOnError)
+	backupWallet_Dest := backupWalletCmd.String("dest","","Backup file or directory")
+	signMessageCmd := flag.NewFlagSet("signMessage",flag.ExitOnError)
+	signMessage_Address := signMessageCmd.String("address","","Address whose private key signs the message")
+	signMessage_Message := signMessageCmd.String("message","","Message to sign")
+	verifyMessageCmd := flag.NewFlagSet("verifyMessage",flag.ExitOnError)
+	verifyMessage_Address   := verifyMessageCmd.String("address","","Address that should have signed the message")
+	verifyMessage_Signature := verifyMessageCmd.String("signature","","Base64 signature printed by signMessage")
+	verifyMessage_Message   := verifyMessageCmd.String("message","","Message that was signed")
+	importPrivKeyCmd := flag.NewFlagSet("importPrivKey",flag.ExitOnError)
+	importPrivKey_Key    := importPrivKeyCmd.String("key","","Private key in WIF, read from stdin if empty")
+	importPrivKey_Rescan := importPrivKeyCmd.Bool("rescan",false,"Scan the blockchain for outputs of the imported key")
+	rescanBlockchainCmd := flag.NewFlagSet("rescanBlockchain",flag.ExitOnError)
+	rescanBlockchain_From := rescanBlockchainCmd.Int("from",0,"First block height to scan")
+	rescanBlockchain_To   := rescanBlockchainCmd.Int("to",-1,"Last block height to scan, -1 for the best block")
+	restoreWalletCmd := flag.NewFlagSet("restoreWallet",flag.ExitOnError)
+	restoreWallet_Mnemonic   := restoreWalletCmd.String("mnemonic","","BIP39 mnemonic words, read from stdin if empty")
+	restoreWallet_Passphrase := restoreWalletCmd.String("mnemonicpassphrase","","Optional BIP39 passphrase used when the wallet was created")
+	restoreWallet_GapLimit   := restoreWalletCmd.Int("gaplimit",DefaultGapLimit,"Stop after this many consecutive unused addresses")
+	restoreWallet_Name       := restoreWalletCmd.String("name","","Restore into a new named wallet")
 
 	getBestHeightCmd:= flag.NewFlagSet("getBestHeight",flag.ExitOnError)
 
 	startNodeCmd:= flag.NewFlagSet("startNode",flag.ExitOnError)
 	startNodeMinner := startNodeCmd.String("minner","","startNode --minner Tom")
+	startNode_MaxMempool  := startNodeCmd.Int("maxmempool",mempoolPolicy.MaxBytes,"Mempool size limit in bytes")
+	startNode_Expiry      := startNodeCmd.Duration("mempoolexpiry",mempoolPolicy.Expiry,"Drop unconfirmed transations older than this, 0 keeps them")
+	startNode_MinRelayFee := startNodeCmd.String("minrelayfee",mempoolPolicy.MinRelayFeeRate.String(),"Minimum fee per 1000 bytes for accepting transations")
+
+	//部分签名交易，离线签名
+	createPSBTCmd := flag.NewFlagSet("createPSBT",flag.ExitOnError)
+	createPSBT_From     := createPSBTCmd.String("from","","Source wallet address")
+	createPSBT_To       := createPSBTCmd.String("to","","Destination wallet address")
+	createPSBT_Amount   := createPSBTCmd.String("amount","","Amount to send, e.g. 1.25")
+	createPSBT_Selector := createPSBTCmd.String("selector","largest","Coin selection: largest|smallest|bnb|random")
+	createPSBT_Seed     := createPSBTCmd.Int64("seed",0,"Random seed for -selector random, 0 means current time")
+	createPSBT_FeeRate  := createPSBTCmd.String("feerate","0","Fee per 1000 bytes, 0 means the minimum relay fee rate")
+	createPSBT_RBF      := createPSBTCmd.Bool("rbf",false,"Allow replacing the transation with bumpFee while it is unconfirmed")
+	createPSBT_Out      := createPSBTCmd.String("out","tx.psbt","Output PSBT file")
+
+	signPSBTCmd := flag.NewFlagSet("signPSBT",flag.ExitOnError)
+	signPSBT_In      := signPSBTCmd.String("in","","PSBT file to sign")
+	signPSBT_Out     := signPSBTCmd.String("out","","Output PSBT file, default overwrites -in")
+	signPSBT_SigHash := signPSBTCmd.String("sighash","ALL","Signature hash type: ALL|NONE|SINGLE, optionally |ANYONECANPAY")
+
+	combinePSBTCmd := flag.NewFlagSet("combinePSBT",flag.ExitOnError)
+	combinePSBT_In  := combinePSBTCmd.String("in","","Comma separated PSBT files to combine")
+	combinePSBT_Out := combinePSBTCmd.String("out","tx.psbt","Output PSBT file")
+
+	finalizePSBTCmd := flag.NewFlagSet("finalizePSBT",flag.ExitOnError)
+	finalizePSBT_In  := finalizePSBTCmd.String("in","","PSBT file to finalize")
+	finalizePSBT_Out := finalizePSBTCmd.String("out","","Output PSBT file, default overwrites -in")
+
+	broadcastPSBTCmd := flag.NewFlagSet("broadcastPSBT",flag.ExitOnError)
+	broadcastPSBT_In := broadcastPSBTCmd.String("in","","Finalized PSBT file")
+
+	//原始交易
+	createRawCmd := flag.NewFlagSet("createRawTransaction",flag.ExitOnError)
+	createRaw_Inputs  := createRawCmd.String("inputs","","Comma separated inputs txid:vout")
+	createRaw_Outputs := createRawCmd.String("outputs","","Comma separated outputs address:amount")
+	createRaw_RBF     := createRawCmd.Bool("rbf",false,"Allow replacing the transation while it is unconfirmed")
+
+	decodeRawCmd := flag.NewFlagSet("decodeRawTransaction",flag.ExitOnError)
+	decodeRaw_Hex := decodeRawCmd.String("hex","","Hex encoded transation")
+
+	signRawCmd := flag.NewFlagSet("signRawTransaction",flag.ExitOnError)
+	signRaw_Hex     := signRawCmd.String("hex","","Hex encoded transation")
+	signRaw_SigHash := signRawCmd.String("sighash","ALL","Signature hash type: ALL|NONE|SINGLE, optionally |ANYONECANPAY")
+
+	sendRawCmd := flag.NewFlagSet("sendRawTransaction",flag.ExitOnError)
+	sendRaw_Hex := sendRawCmd.String("hex","","Hex encoded signed transation")
+
+	//提高未确认交易的手续费
+	bumpFeeCmd := flag.NewFlagSet("bumpFee",flag.ExitOnError)
+	bumpFee_TXid    := bumpFeeCmd.String("txid","","Unconfirmed transation to replace")
+	bumpFee_FeeRate := bumpFeeCmd.String("feerate","0","Fee per 1000 bytes of the replacement, 0 means the lowest rate the replacement rules allow")
+
+	//交易池
+	mineCmd := flag.NewFlagSet("mine",flag.ExitOnError)
+	mine_Address := mineCmd.String("address","","Miner reward address")
+	getMempoolInfoCmd := flag.NewFlagSet("getMempoolInfo",flag.ExitOnError)
+	getRawMempoolCmd := flag.NewFlagSet("getRawMempool",flag.ExitOnError)
+	getRawMempool_Verbose := getRawMempoolCmd.Bool("verbose",false,"Print every transation")
+
+	//加密钱包
+	encryptWalletCmd := flag.NewFlagSet("encryptWallet",flag.ExitOnError)
+	encryptWallet_Passphrase := encryptWalletCmd.String("passphrase","","New wallet passphrase, read from stdin if empty")
+	walletPassphraseCmd := flag.NewFlagSet("walletPassphrase",flag.ExitOnError)
+	walletPassphrase_Passphrase := walletPassphraseCmd.String("passphrase","","Wallet passphrase, read from stdin if empty")
+	walletPassphrase_Timeout    := walletPassphraseCmd.Duration("timeout",5*time.Minute,"Keep the wallet unlocked this long")
+	walletLockCmd := flag.NewFlagSet("walletLock",flag.ExitOnError)
+	changePassphraseCmd := flag.NewFlagSet("changePassphrase",flag.ExitOnError)
+	changePassphrase_Old := changePassphraseCmd.String("old","","Current passphrase, read from stdin if empty")
+	changePassphrase_New := changePassphraseCmd.String("new","","New passphrase, read from stdin if empty")
 
 
 	switch os.Args[1]{
@@ -92,11 +318,101 @@ func (cli *CLI) Run(){
 		if err != nil{
 			log.Panic(err)
 		}
+	case "loadWallet":
+		err :=loadWalletCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "unloadWallet":
+		err :=unloadWalletCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "listWallets":
+		err :=listWalletsCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
 	case "listAddress":
 		err :=listAddressCmd.Parse(os.Args[2:])
 		if err != nil{
 			log.Panic(err)
 		}
+	case "getNewAddress":
+		err :=getNewAddressCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "vanityAddress":
+		err :=vanityAddressCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "keypoolRefill":
+		err :=keypoolRefillCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "importAddress":
+		err :=importAddressCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "importPubkey":
+		err :=importPubkeyCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "listTransactions":
+		err :=listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "setLabel":
+		err :=setLabelCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "setNote":
+		err :=setNoteCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "dumpPrivKey":
+		err :=dumpPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "backupWallet":
+		err :=backupWalletCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "signMessage":
+		err :=signMessageCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "verifyMessage":
+		err :=verifyMessageCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "importPrivKey":
+		err :=importPrivKeyCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "rescanBlockchain":
+		err :=rescanBlockchainCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "restoreWallet":
+		err :=restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
 	case "getBestHeight":
 		err :=getBestHeightCmd.Parse(os.Args[2:])
 		if err != nil{
@@ -107,6 +423,91 @@ func (cli *CLI) Run(){
 		if err != nil{
 			log.Panic(err)
 		}
+	case "createPSBT":
+		err :=createPSBTCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "signPSBT":
+		err :=signPSBTCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "combinePSBT":
+		err :=combinePSBTCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "finalizePSBT":
+		err :=finalizePSBTCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "broadcastPSBT":
+		err :=broadcastPSBTCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "createRawTransaction":
+		err :=createRawCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "decodeRawTransaction":
+		err :=decodeRawCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "signRawTransaction":
+		err :=signRawCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "sendRawTransaction":
+		err :=sendRawCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "bumpFee":
+		err :=bumpFeeCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "mine":
+		err :=mineCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "getMempoolInfo":
+		err :=getMempoolInfoCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "getRawMempool":
+		err :=getRawMempoolCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "encryptWallet":
+		err :=encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "walletPassphrase":
+		err :=walletPassphraseCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "walletLock":
+		err :=walletLockCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
+	case "changePassphrase":
+		err :=changePassphraseCmd.Parse(os.Args[2:])
+		if err != nil{
+			log.Panic(err)
+		}
 
 	default:
 		cli.printUsage()
@@ -115,38 +516,203 @@ func (cli *CLI) Run(){
 
 	//addBlockCmd参数解析成功，该执行相关处理了
 	if addBlockCmd.Parsed(){
-		cli.addBlock()
+		err = cli.addBlock()
 	}
 	if printChainCmd.Parsed(){
-		cli.printChain()
+		err = cli.printChain()
 	}
-	if getBalanceCmd.Parsed(){
-		//检查地址参数是否正确，如果为空表示错误，强制停止运行
-		if *getBalanceAddress == ""{
-			os.Exit(1)
+	if getBalanceCmd.Parsed() && *getBalanceAddress == ""{
+		err = cli.getWalletBalance()
+	}else if getBalanceCmd.Parsed(){
+		var account Amount
+		err = checkAddressFlag("address",*getBalanceAddress)
+		if err == nil{
+			account,err = cli.GetBalance(*getBalanceAddress)
+		}
+		if err == nil{
+			fmt.Printf("钱包地址:%s， 余额:%s\n",*getBalanceAddress, account)
+			var unconfirmed Amount
+			unconfirmed,err = cli.getUnconfirmedBalance(*getBalanceAddress)
+			if err == nil && unconfirmed > 0{
+				fmt.Printf("未确认:+%s\n",unconfirmed)
+			} else if err == nil && unconfirmed < 0{
+				fmt.Printf("未确认:%s\n",unconfirmed)
+			}
 		}
-		account := cli.GetBalance(*getBalanceAddress)
-		fmt.Printf("钱包地址:%s， 余额:%d\n",*getBalanceAddress, account)
 	}
 	if sendCmd.Parsed(){
 		//检查from/to/amount参数是否正确，如果为空表示错误，强制停止运行
-		if *send_From=="" || *send_To=="" || *send_Amount<=0 {
+		if *send_From=="" || *send_To=="" || *send_Amount=="" {
 			os.Exit(1)
 		}
-		cli.send(*send_From, *send_To, *send_Amount)
-
-		fmt.Printf("转账完成。。。\n")
+		var amount Amount
+		opts := SendOptions{Replaceable: *send_RBF}
+		err = checkAddressFlag("from",*send_From)
+		if err == nil{
+			err = checkAddressFlag("to",*send_To)
+		}
+		if err == nil{
+			amount,err = parseAmountFlag("amount",*send_Amount,false)
+		}
+		if err == nil{
+			opts.FeeRate,err = parseAmountFlag("feerate",*send_FeeRate,true)
+		}
+		if err == nil{
+			opts.Selector,err = NewCoinSelector(*send_Selector,*send_Seed)
+		}
+		if err == nil{
+			opts.HashType,err = ParseSigHashType(*send_SigHash)
+		}
+		if err == nil{
+			err = cli.send(*send_From, *send_To, amount, opts, *send_Mine)
+		}
+		if err == nil{
+			fmt.Printf("转账完成。。。\n")
+		}
 	}
 
-	if createWalletCmd.Parsed(){
-		cli.createWallet()
+	if createWalletCmd.Parsed() && *createWallet_Name != ""{
+		err = cli.createNamedWallet(*createWallet_Name)
+	}else if createWalletCmd.Parsed(){
+		var curve CurveID
+		curve,err = ParseCurveID(*createWallet_Curve)
+		if err == nil{
+			err = cli.createWallet(curve)
+		}
+	}
+	if loadWalletCmd.Parsed(){
+		err = LoadWallet(*loadWallet_Name)
+		if err == nil{
+			fmt.Printf("wallet %s loaded\n",*loadWallet_Name)
+		}
+	}
+	if unloadWalletCmd.Parsed(){
+		err = UnloadWallet(*unloadWallet_Name)
+		if err == nil{
+			fmt.Printf("wallet %s unloaded\n",*unloadWallet_Name)
+		}
+	}
+	if listWalletsCmd.Parsed(){
+		err = cli.listWallets()
 	}
 	if listAddressCmd.Parsed(){
-		cli.listAddress()
+		err = cli.listAddress()
+	}
+	if getNewAddressCmd.Parsed(){
+		err = cli.getNewAddress()
+	}
+	if vanityAddressCmd.Parsed(){
+		if *vanityAddress_Prefix == ""{
+			vanityAddressCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.vanityAddress(VanityOptions{Prefix: *vanityAddress_Prefix, IgnoreCase: *vanityAddress_IgnoreCase,
+			Threads: *vanityAddress_Threads, Curve: DefaultCurve})
+	}
+	if keypoolRefillCmd.Parsed(){
+		if *keypoolRefill_Size < 0{
+			err = fmt.Errorf("-size must not be negative")
+		}else{
+			err = cli.keypoolRefill(*keypoolRefill_Size)
+		}
+	}
+	if importAddressCmd.Parsed(){
+		if *importAddress_Address == ""{
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*importAddress_Address)
+		if err == nil{
+			err = cli.importAddress(*importAddress_Address)
+		}
+	}
+	if importPubkeyCmd.Parsed(){
+		if *importPubkey_Pubkey == ""{
+			importPubkeyCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.importPubkey(*importPubkey_Pubkey)
+	}
+	if listTransactionsCmd.Parsed(){
+		err = cli.listTransactions(*listTransactions_Count)
+	}
+	if setLabelCmd.Parsed(){
+		if *setLabel_Address == ""{
+			setLabelCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*setLabel_Address)
+		if err == nil{
+			err = cli.setLabel(*setLabel_Address,*setLabel_Label)
+		}
+	}
+	if setNoteCmd.Parsed(){
+		if *setNote_TxID == ""{
+			setNoteCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.setNote(*setNote_TxID,*setNote_Note)
+	}
+	if dumpPrivKeyCmd.Parsed(){
+		if *dumpPrivKey_Address == ""{
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*dumpPrivKey_Address)
+		if err == nil{
+			err = cli.dumpPrivKey(*dumpPrivKey_Address)
+		}
+	}
+	if backupWalletCmd.Parsed(){
+		if *backupWallet_Dest == ""{
+			backupWalletCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.backupWallet(*backupWallet_Dest)
+	}
+	if signMessageCmd.Parsed(){
+		if *signMessage_Address == ""{
+			signMessageCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*signMessage_Address)
+		if err == nil{
+			err = cli.signMessage(*signMessage_Address,*signMessage_Message)
+		}
+	}
+	if verifyMessageCmd.Parsed(){
+		if *verifyMessage_Address == "" || *verifyMessage_Signature == ""{
+			verifyMessageCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*verifyMessage_Address)
+		if err == nil{
+			err = VerifyMessage(*verifyMessage_Address,*verifyMessage_Signature,*verifyMessage_Message)
+		}
+		if err == nil{
+			fmt.Printf("signature is valid, message was signed by %s\n",*verifyMessage_Address)
+		}
+	}
+	if importPrivKeyCmd.Parsed(){
+		var key string
+		key,err = readPassphrase(*importPrivKey_Key,"Private key (WIF): ")
+		if err == nil{
+			err = cli.importPrivKey(key,*importPrivKey_Rescan)
+		}
+	}
+	if rescanBlockchainCmd.Parsed(){
+		err = cli.rescanBlockchain(int32(*rescanBlockchain_From),int32(*rescanBlockchain_To))
+	}
+	if restoreWalletCmd.Parsed(){
+		var mnemonic string
+		mnemonic,err = readPassphrase(*restoreWallet_Mnemonic,"Mnemonic: ")
+		if err == nil{
+			err = cli.restoreWallet(mnemonic,*restoreWallet_Passphrase,*restoreWallet_GapLimit,*restoreWallet_Name)
+		}
 	}
 
 	if getBestHeightCmd.Parsed(){
-		cli.getBestHeight()
+		err = cli.getBestHeight()
 	}
 
 	if startNodeCmd.Parsed(){
@@ -160,91 +726,1434 @@ func (cli *CLI) Run(){
 			fmt.Printf("Error: minner address is null! \n")
 			os.Exit(1)
 		}
-		cli.startNode(nodeID, *startNodeMinner)
+		mempoolPolicy.MaxBytes = *startNode_MaxMempool
+		mempoolPolicy.Expiry = *startNode_Expiry
+		err = checkAddressFlag("minner",*startNodeMinner)
+		if err == nil{
+			mempoolPolicy.MinRelayFeeRate,err = parseAmountFlag("minrelayfee",*startNode_MinRelayFee,true)
+		}
+		if err == nil{
+			err = cli.startNode(nodeID, *startNodeMinner)
+		}
 	}
-}
 
-//根据命令行参数添加区块
-func (cli *CLI) addBlock(){
-	cli.bc.MineBlock([]*Transation{})   //先添加一个空的交易列表
-}
+	if createPSBTCmd.Parsed(){
+		if *createPSBT_From=="" || *createPSBT_To=="" || *createPSBT_Amount=="" {
+			createPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		var amount,feeRate Amount
+		var selector CoinSelector
+		err = checkAddressFlag("from",*createPSBT_From)
+		if err == nil{
+			err = checkAddressFlag("to",*createPSBT_To)
+		}
+		if err == nil{
+			amount,err = parseAmountFlag("amount",*createPSBT_Amount,false)
+		}
+		if err == nil{
+			feeRate,err = parseAmountFlag("feerate",*createPSBT_FeeRate,true)
+		}
+		if err == nil{
+			selector,err = NewCoinSelector(*createPSBT_Selector,*createPSBT_Seed)
+		}
+		if err == nil{
+			err = cli.createPSBT(*createPSBT_From,*createPSBT_To,amount,feeRate,*createPSBT_RBF,selector,*createPSBT_Out)
+		}
+	}
+	if signPSBTCmd.Parsed(){
+		if *signPSBT_In == ""{
+			signPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		var hashType SigHashType
+		hashType,err = ParseSigHashType(*signPSBT_SigHash)
+		if err == nil{
+			err = cli.signPSBT(*signPSBT_In,*signPSBT_Out,hashType)
+		}
+	}
+	if combinePSBTCmd.Parsed(){
+		if *combinePSBT_In == ""{
+			combinePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.combinePSBT(strings.Split(*combinePSBT_In,","),*combinePSBT_Out)
+	}
+	if finalizePSBTCmd.Parsed(){
+		if *finalizePSBT_In == ""{
+			finalizePSBTCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.finalizePSBT(*finalizePSBT_In,*finalizePSBT_Out)
+	}
+	if broadcastPSBTCmd.Parsed(){
+		if *broadcastPSBT_In == ""{
+			broadcastPSBTCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.broadcastPSBT(*broadcastPSBT_In)
+	}
 
-//打印链上的区块信息
-func (cli *CLI) printChain(){
-	cli.bc.PrintBlockChain()
-}
+	if createRawCmd.Parsed(){
+		if *createRaw_Inputs == "" || *createRaw_Outputs == ""{
+			createRawCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.createRawTransaction(*createRaw_Inputs,*createRaw_Outputs,*createRaw_RBF)
+	}
+	if decodeRawCmd.Parsed(){
+		if *decodeRaw_Hex == ""{
+			decodeRawCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.decodeRawTransaction(*decodeRaw_Hex)
+	}
+	if signRawCmd.Parsed(){
+		if *signRaw_Hex == ""{
+			signRawCmd.Usage()
+			os.Exit(1)
+		}
+		var hashType SigHashType
+		hashType,err = ParseSigHashType(*signRaw_SigHash)
+		if err == nil{
+			err = cli.signRawTransaction(*signRaw_Hex,hashType)
+		}
+	}
+	if sendRawCmd.Parsed(){
+		if *sendRaw_Hex == ""{
+			sendRawCmd.Usage()
+			os.Exit(1)
+		}
+		err = cli.sendRawTransaction(*sendRaw_Hex)
+	}
 
-//计算指定账户的余额,不再是遍历链上的交易，而是从数据桶中找出指定用户的余额。
-func (cli *CLI) GetBalance(address string) int{
-	balance :=0
-	pubkeyhash := GetPubKeyHash(address)
+	if bumpFeeCmd.Parsed(){
+		if *bumpFee_TXid == ""{
+			bumpFeeCmd.Usage()
+			os.Exit(1)
+		}
+		var feeRate Amount
+		feeRate,err = parseAmountFlag("feerate",*bumpFee_FeeRate,true)
+		if err == nil{
+			err = cli.bumpFee(*bumpFee_TXid,feeRate)
+		}
+	}
 
-	//UTXOs := cli.bc.FindUTXO2(pubkeyhash)
-	set := UTXOSet{cli.bc}
-	UTXOs := set.FindUTXObyPubkeyHash(pubkeyhash)
+	if mineCmd.Parsed(){
+		if *mine_Address == ""{
+			mineCmd.Usage()
+			os.Exit(1)
+		}
+		err = checkAddressFlag("address",*mine_Address)
+		if err == nil{
+			err = cli.mine(*mine_Address)
+		}
+	}
+	if getMempoolInfoCmd.Parsed(){
+		err = cli.getMempoolInfo()
+	}
+	if getRawMempoolCmd.Parsed(){
+		err = cli.getRawMempool(*getRawMempool_Verbose)
+	}
 
-	for _,out :=range UTXOs{
-		balance += out.Value
+	if encryptWalletCmd.Parsed(){
+		var passphrase string
+		passphrase,err = readPassphrase(*encryptWallet_Passphrase,"New passphrase: ")
+		if err == nil{
+			err = cli.encryptWallet(passphrase)
+		}
+	}
+	if walletPassphraseCmd.Parsed(){
+		var passphrase string
+		passphrase,err = readPassphrase(*walletPassphrase_Passphrase,"Passphrase: ")
+		if err == nil{
+			err = cli.walletPassphrase(passphrase,*walletPassphrase_Timeout)
+		}
+	}
+	if walletLockCmd.Parsed(){
+		err = cli.walletLock()
+	}
+	if changePassphraseCmd.Parsed(){
+		var oldPassphrase,newPassphrase string
+		oldPassphrase,err = readPassphrase(*changePassphrase_Old,"Current passphrase: ")
+		if err == nil{
+			newPassphrase,err = readPassphrase(*changePassphrase_New,"New passphrase: ")
+		}
+		if err == nil{
+			err = cli.changePassphrase(oldPassphrase,newPassphrase)
+		}
 	}
 
-	return balance
+	//命令执行出错，打印错误信息后退出，不再panic
+	if err != nil{
+		fmt.Printf("Error: %v\n",err)
+		os.Exit(1)
+	}
+}
+
+//根据命令行参数添加区块
+func (cli *CLI) addBlock() error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	_,err = bc.MineBlock([]*Transation{})   //先添加一个空的交易列表
+	return err
+}
+
+//打印链上的区块信息
+func (cli *CLI) printChain() error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	return bc.PrintBlockChain()
+}
+
+//计算指定账户的余额,不再是遍历链上的交易，而是从数据桶中找出指定用户的余额。
+func (cli *CLI) GetBalance(address string) (Amount,error){
+	var balance Amount
+	pubkeyhashes,err := accountPubKeyHashes(address)
+	if err != nil{
+		return 0,err
+	}
+
+	bc,err := cli.chain()
+	if err != nil{
+		return 0,err
+	}
+
+	//UTXOs := cli.bc.FindUTXO2(pubkeyhash)
+	set := UTXOSet{bc}
+	for _,pubkeyhash := range pubkeyhashes{
+		UTXOs,err := set.FindUTXObyPubkeyHash(pubkeyhash)
+		if err != nil{
+			return 0,err
+		}
+
+		for _,out :=range UTXOs{
+			balance += out.Value
+		}
+	}
+
+	return balance,nil
 }
 
-//转账操作，先生成一笔新交易， 存入挖矿所得的新区块中
-func (cli *CLI) send(from, to string, amount int){
-	tx := NewUTXOTransation(from,to,amount,cli.bc)  //会进行交易签名
-	newblock := cli.bc.MineBlock([]*Transation{tx}) //会验证交易签名
+//查询余额时要统计的公钥hash：钱包中的发送地址还包括转账时给它生成的找零地址
+func accountPubKeyHashes(address string) ([][]byte,error){
+	addresses := []string{address}
+	//没有钱包文件时不创建，只查这个地址
+	if _,err := os.Stat(walletFile); err == nil{
+		wallets,err := NewWallets()
+		if err != nil{
+			return nil,err
+		}
+		defer wallets.Close()
+		addresses = wallets.AccountAddresses(address)
+	}
+	var pubkeyhashes [][]byte
+	for _,a := range addresses{
+		pubkeyhash,err := GetPubKeyHash(a)
+		if err != nil{
+			return nil,err
+		}
+		pubkeyhashes = append(pubkeyhashes,pubkeyhash)
+	}
+	return pubkeyhashes,nil
+}
+
+//交易池中还没有确认的余额变化
+func (cli *CLI) getUnconfirmedBalance(address string) (Amount,error){
+	pubkeyhashes,err := accountPubKeyHashes(address)
+	if err != nil{
+		return 0,err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return 0,err
+	}
+	var balance Amount
+	for _,pubkeyhash := range pubkeyhashes{
+		change,err := Mempool{bc}.UnconfirmedBalance(pubkeyhash)
+		if err != nil{
+			return 0,err
+		}
+		balance += change
+	}
+	return balance,nil
+}
 
-	//把新区块的交易数据更新到数据桶中
-	set := UTXOSet{cli.bc}
-	set.update(newblock)
+//转账操作，先生成一笔新交易，放入交易池并转发给其他节点。mineNow为true时发送方立即挖矿确认
+func (cli *CLI) send(from, to string, amount Amount, opts SendOptions, mineNow bool) error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	tx,err := NewUTXOTransation(from,to,amount,opts,bc)  //会进行交易签名
+	if err != nil{
+		return err
+	}
+	err = cli.submitTransation(tx)
+	if err != nil{
+		return err
+	}
+	if mineNow{
+		err = cli.mine(from)
+		if err != nil{
+			return err
+		}
+	}
 
 	fmt.Printf("send success!\n")
+	return nil
+}
+
+//把签好名的交易放入本地交易池（会验证签名和金额），再转发给其他节点，由矿工打包
+func (cli *CLI) submitTransation(tx *Transation) error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	err = Mempool{bc}.Add(tx)
+	if err != nil{
+		return err
+	}
+	relayTransation(tx,"")
+	return nil
+}
+
+//用更高的手续费替换交易池中还没确认的交易，新交易放入交易池并转发
+func (cli *CLI) bumpFee(txidHex string, feeRate Amount) error{
+	txid,err := hex.DecodeString(txidHex)
+	if err != nil{
+		return fmt.Errorf("%w: bad txid: %v",ErrInvalidTransation,err)
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	tx,err := NewBumpFeeTransation(txid,feeRate,bc)
+	if err != nil{
+		return err
+	}
+	err = cli.submitTransation(tx)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("transation %x replaced by %x\n",txid,tx.ID)
+	return nil
+}
+
+//用交易池中的交易挖一个新区块
+func (cli *CLI) mine(address string) error{
+	_,err := GetPubKeyHash(address)
+	if err != nil{
+		return err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	newBlock,err := Mempool{bc}.MineBlock(address)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("mined block %x with %d transations\n",newBlock.Hash,len(newBlock.Transations))
+	return nil
+}
+
+//显示交易池的概况
+func (cli *CLI) getMempoolInfo() error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	info,err := Mempool{bc}.Info()
+	if err != nil{
+		return err
+	}
+	fmt.Printf("transations: %d\nbytes: %d/%d\nfees: %s\nminrelayfee: %s per 1000 bytes\n",info.Count,info.Bytes,info.MaxBytes,info.Fees,info.MinRelayFeeRate)
+	return nil
+}
+
+//列出交易池中的交易，按依赖顺序排列
+func (cli *CLI) getRawMempool(verbose bool) error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	entries,err := Mempool{bc}.Entries()
+	if err != nil{
+		return err
+	}
+	for _,entry := range entries{
+		if !verbose{
+			fmt.Printf("%x\n",entry.Tx.ID)
+			continue
+		}
+		fmt.Println(entry.Tx.ToString())
+		fmt.Printf("   Size: %d, Weight: %d, Fee: %s, FeeRate: %.2f, Age: %v\n",entry.Size,entry.Tx.Weight(),entry.Fee,feeRate(entry.Fee,entry.Size),time.Since(time.Unix(entry.Time,0)).Round(time.Second))
+		fmt.Printf("   Ancestors: %d, AncestorFeeRate: %.2f, Descendants: %d, DescendantFeeRate: %.2f\n",
+			entry.Ancestors,feeRate(entry.AncestorFee,entry.AncestorSize),entry.Descendants,feeRate(entry.DescendantFee,entry.DescendantSize))
+	}
+	return nil
 }
 
 // 新建钱包
-func (cli *CLI) createWallet(){
-	wallets,_ :=NewWallets()
-	add := wallets.CreateWallet()
+func (cli *CLI) createWallet(curve CurveID) error{
+	wallets,err :=NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	add,err := wallets.CreateWallet(curve)
+	if errors.Is(err,ErrWalletLocked){
+		//新的私钥要用主密钥加密
+		err = unlockWallets(wallets)
+		if err == nil{
+			add,err = wallets.CreateWallet(curve)
+		}
+	}
+	if err != nil{
+		return err
+	}
 	fmt.Printf("your address:%s\n",add)
 
 	//钱包集重新写入文件
-	wallets.SaveToFile2()
+	return wallets.SaveToFile2()
+}
+
+//解析命令前面的全局参数 -wallet NAME 或 -wallet=NAME，返回钱包名和剩下的参数
+func parseWalletSelector(args []string) (string,[]string,error){
+	if len(args) == 0{
+		return "",args,nil
+	}
+	switch{
+	case args[0] == "-wallet" || args[0] == "--wallet":
+		if len(args) < 2{
+			return "",nil,fmt.Errorf("-wallet needs a wallet name")
+		}
+		return args[1],args[2:],nil
+	case strings.HasPrefix(args[0],"-wallet="):
+		return strings.TrimPrefix(args[0],"-wallet="),args[1:],nil
+	case strings.HasPrefix(args[0],"--wallet="):
+		return strings.TrimPrefix(args[0],"--wallet="),args[1:],nil
+	}
+	return "",args,nil
+}
+
+//创建并加载命名钱包
+func (cli *CLI) createNamedWallet(name string) error{
+	wallets,mnemonic,err := CreateNamedWallet(name)
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	fmt.Printf("wallet %s created and loaded, file %s\n",name,wallets.path())
+	fmt.Printf("your address:%s\n",wallets.GetAllAddress()[0])
+	fmt.Printf("钱包的助记词（请抄写下来妥善保管，丢失后无法恢复，泄露后币会被盗）：\n%s\n",mnemonic)
+	return nil
+}
+
+//列出默认钱包和命名钱包，命名钱包包括目录中还没有加载的钱包文件
+func (cli *CLI) listWallets() error{
+	loaded,err := LoadedWallets()
+	if err != nil{
+		return err
+	}
+	files,err := filepath.Glob(walletFileName("*"))
+	if err != nil{
+		return err
+	}
+	status := make(map[string]string)
+	for _,file := range files{
+		name := strings.TrimSuffix(strings.TrimPrefix(file,"wallet_"),".dat")
+		if checkWalletName(name) == nil{
+			status[name] = "unloaded"
+		}
+	}
+	for _,name := range loaded{
+		status[name] = "loaded"
+	}
+	var names []string
+	for name := range status{
+		names = append(names,name)
+	}
+	sort.Strings(names)
+
+	selected := ""
+	if walletFile == defaultWalletFile{
+		selected = "  *"
+	}
+	fmt.Printf("(default)  %s  loaded%s\n",defaultWalletFile,selected)
+	for _,name := range names{
+		selected = ""
+		if walletFile == walletFileName(name){
+			selected = "  *"
+		}
+		fmt.Printf("%s  %s  %s%s\n",name,walletFileName(name),status[name],selected)
+	}
+	return nil
 }
 
 // 查看钱包集中所有的地址
-func (cli *CLI) listAddress(){
+func (cli *CLI) listAddress() error{
 	wallets,err:=NewWallets()
 	if err!=nil{
-		log.Panic(err)
+		return err
 	}
+	defer wallets.Close()
 	alladdress := wallets.GetAllAddress()
 	for _,add := range alladdress{
-		fmt.Println(add)
+		line := add
+		if path := wallets.Store[add].hdPath; path != nil{
+			line += "  "+FormatDerivationPath(path)
+		}
+		if label,ok := wallets.Labels[add]; ok{
+			line += fmt.Sprintf("  %q",label)
+		}
+		fmt.Println(line)
+	}
+	changes := make([]string,0,len(wallets.Change))
+	for add := range wallets.Change{
+		changes = append(changes,add)
+	}
+	sort.Strings(changes)
+	for _,add := range changes{
+		fmt.Printf("%s  change of %s\n",add,wallets.Change[add])
+	}
+	for _,add := range wallets.GetWatchOnlyAddress(){
+		line := add+"  watch-only"
+		if label,ok := wallets.Labels[add]; ok{
+			line += fmt.Sprintf("  %q",label)
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("keypool: %d receive, %d change\n",len(wallets.KeyPool),len(wallets.ChangePool))
+	return nil
+}
+
+//从密钥池取一个新的收款地址
+func (cli *CLI) getNewAddress() error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	address,err := wallets.GetNewAddress()
+	if errors.Is(err,ErrWalletLocked){
+		//密钥池空了，要生成新的私钥
+		err = unlockWallets(wallets)
+		if err == nil{
+			address,err = wallets.GetNewAddress()
+		}
+	}
+	if err != nil{
+		return err
+	}
+	err = wallets.SaveToFile2()
+	if err != nil{
+		return err
 	}
+	fmt.Printf("your new address:%s\n",address)
+	return nil
 }
 
-func (cli *CLI) getBestHeight() {
-	height := cli.bc.GetBestHeight()
+//搜索靓号地址，找到后加入钱包。每秒显示已经试过的私钥数、速度和找到的概率，按Ctrl-C中止
+func (cli *CLI) vanityAddress(opts VanityOptions) error{
+	difficulty,err := VanityDifficulty(opts.Prefix,opts.IgnoreCase)
+	if err != nil{
+		return err
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	//加密的钱包先解锁再搜索，免得找到了却存不进去
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("searching for %s with %d threads, difficulty %.0f\n",opts.Prefix,opts.Threads,difficulty)
+
+	interrupt := make(chan os.Signal,1)
+	signal.Notify(interrupt,os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	wallet,tried,err := FindVanityAddress(opts,func(tried uint64, elapsed time.Duration) bool{
+		select{
+		case <-interrupt:
+			return false
+		default:
+		}
+		rate := float64(tried)/elapsed.Seconds()
+		//试了n个私钥至少找到一个的概率 1-(1-1/difficulty)^n，一半的把握需要 ln2×difficulty 个
+		chance := -math.Expm1(float64(tried)*math.Log1p(-1/difficulty))
+		remaining := time.Duration((math.Ln2*difficulty-float64(tried))/rate*float64(time.Second))
+		fmt.Printf("tried %d keys, %.0f keys/s, %.2f%% chance so far",tried,rate,chance*100)
+		if remaining > 0{
+			fmt.Printf(", 50%% chance in %v",remaining.Round(time.Second))
+		}
+		fmt.Println()
+		return true
+	})
+	if err != nil{
+		return err
+	}
+	address,err := wallets.AddVanityWallet(wallet)
+	if err != nil{
+		return err
+	}
+	err = wallets.SaveToFile2()
+	if err != nil{
+		return err
+	}
+	fmt.Printf("found %s after %d keys, added to the wallet\n",address,tried)
+	fmt.Printf("this key is not derived from the mnemonic, back it up with dumpPrivKey -address %s\n",address)
+	return nil
+}
+
+//设置密钥池大小并补满，size为0时保持原来的大小
+func (cli *CLI) keypoolRefill(size int) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	if size > 0{
+		wallets.KeyPoolSize = size
+	}
+	err = wallets.TopUpKeyPool()
+	if errors.Is(err,ErrWalletLocked){
+		err = unlockWallets(wallets)
+		if err == nil{
+			err = wallets.TopUpKeyPool()
+		}
+	}
+	if err != nil{
+		return err
+	}
+	fmt.Printf("keypool: %d receive, %d change\n",len(wallets.KeyPool),len(wallets.ChangePool))
+	return wallets.SaveToFile2()
+}
+
+//同步并显示钱包最近count笔交易记录，count<=0时显示全部
+func (cli *CLI) listTransactions(count int) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	changed,err := wallets.SyncHistory(bc)
+	if err != nil{
+		return err
+	}
+	if changed{
+		err = wallets.SaveToFile2()
+		if err != nil{
+			return err
+		}
+	}
+	height,err := bc.GetBestHeight()
+	if err != nil{
+		return err
+	}
+
+	txs := wallets.ListTransactions()
+	if count > 0 && len(txs) > count{
+		txs = txs[len(txs)-count:]
+	}
+	for _,wtx := range txs{
+		txid := hex.EncodeToString(wtx.TxID)
+		fmt.Printf("%s  %-8s  amount:%s  fee:%s  height:%d  confirmations:%d",txid,wtx.Category(),wtx.Amount(),wtx.Fee,wtx.Height,wtx.Confirmations(height))
+		if wtx.Counterparty != ""{
+			fmt.Printf("  counterparty:%s",wtx.Counterparty)
+			if label,ok := wallets.Labels[wtx.Counterparty]; ok{
+				fmt.Printf(" %q",label)
+			}
+		}
+		if wtx.WatchOnly{
+			fmt.Print("  watch-only")
+		}
+		if note,ok := wallets.Notes[txid]; ok{
+			fmt.Printf("  note:%q",note)
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+//给地址加标签
+func (cli *CLI) setLabel(address, label string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = wallets.SetLabel(address,label)
+	if err != nil{
+		return err
+	}
+	return wallets.SaveToFile2()
+}
+
+//给钱包的交易加备注，先同步交易记录，刚确认的交易也能加
+func (cli *CLI) setNote(txid, note string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	_,err = wallets.SyncHistory(bc)
+	if err != nil{
+		return err
+	}
+	err = wallets.SetNote(strings.ToLower(txid),note)
+	if err != nil{
+		return err
+	}
+	return wallets.SaveToFile2()
+}
+
+//钱包中每个地址的余额和总额，只读地址也计算在内
+func (cli *CLI) getWalletBalance() error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	addresses := wallets.GetAllAddress()
+	sort.Strings(addresses)
+	addresses = append(addresses,wallets.GetWatchOnlyAddress()...)
+
+	var total,watchTotal Amount
+	for _,address := range addresses{
+		balance,err := cli.GetBalance(address)
+		if err != nil{
+			return err
+		}
+		if wallets.IsWatchOnly(address){
+			fmt.Printf("钱包地址:%s， 余额:%s （watch-only）\n",address,balance)
+			watchTotal += balance
+			continue
+		}
+		fmt.Printf("钱包地址:%s， 余额:%s\n",address,balance)
+		total += balance
+	}
+	fmt.Printf("总额:%s，只读地址总额:%s\n",total,watchTotal)
+	return nil
+}
+
+//导入只读地址
+func (cli *CLI) importAddress(address string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = wallets.ImportAddress(address)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("watching %s\n",address)
+	return wallets.SaveToFile2()
+}
+
+//导入公钥作为只读地址
+func (cli *CLI) importPubkey(pubkeyHex string) error{
+	pubkey,err := hex.DecodeString(pubkeyHex)
+	if err != nil{
+		return fmt.Errorf("%w: %v",errInvalidPubKey,err)
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	address,err := wallets.ImportPubKey(pubkey)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("watching %s\n",address)
+	return wallets.SaveToFile2()
+}
+
+//显示地址的WIF私钥
+func (cli *CLI) dumpPrivKey(address string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	wif,err := wallets.DumpPrivKey(address)
+	if err != nil{
+		return err
+	}
+	fmt.Println(wif)
+	return nil
+}
+
+//把钱包文件复制一份到dest
+func (cli *CLI) backupWallet(dest string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	path,err := wallets.BackupWallet(dest)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("wallet backed up to %s\n",path)
+	return nil
+}
+
+//用地址的私钥签名消息，只读取钱包文件，不打开区块链数据库
+func (cli *CLI) signMessage(address, message string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	signature,err := wallets.SignMessage(address,message)
+	if err != nil{
+		return err
+	}
+	fmt.Println(signature)
+	return nil
+}
+
+//导入WIF私钥，rescan时遍历区块链找出这个私钥的未花费输出
+func (cli *CLI) importPrivKey(wif string, rescan bool) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	address,err := wallets.ImportPrivKey(strings.TrimSpace(wif))
+	if err != nil{
+		return err
+	}
+	err = wallets.SaveToFile2()
+	if err != nil{
+		return err
+	}
+	fmt.Printf("imported %s\n",address)
+	if !rescan{
+		return nil
+	}
+	return cli.rescanBlockchain(0,-1)
+}
+
+//重新扫描区块链，重建钱包的交易记录和未花费输出。每秒显示一次进度，
+//按Ctrl-C在处理完当前区块后中止，已经扫描的部分也保存下来
+func (cli *CLI) rescanBlockchain(from, to int32) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+
+	interrupt := make(chan os.Signal,1)
+	signal.Notify(interrupt,os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	start := time.Now()
+	lastReport := start
+	height,err := wallets.RescanBlockchain(bc,from,to,func(height, from, to int32) bool{
+		select{
+		case <-interrupt:
+			return false
+		default:
+		}
+		if height == to || time.Since(lastReport) >= time.Second{
+			lastReport = time.Now()
+			fmt.Printf("rescanning height %d/%d (%d%%)\n",height,to,int64(height-from+1)*100/int64(to-from+1))
+		}
+		return true
+	})
+	if err != nil && !errors.Is(err,ErrRescanAborted){
+		return err
+	}
+	saveErr := wallets.SaveToFile2()
+	if err != nil{
+		if saveErr == nil{
+			fmt.Printf("rescan stopped, blocks %d-%d saved, continue with -from %d\n",from,height,height+1)
+		}
+		return err
+	}
+	if saveErr != nil{
+		return saveErr
+	}
+
+	UTXOs := wallets.ListUnspent()
+	var balance Amount
+	for _,utxo := range UTXOs{
+		balance += utxo.Output.Value
+	}
+	fmt.Printf("rescanned blocks %d-%d in %v: %d transations, %d unspent outputs, balance %s\n",
+		from,height,time.Since(start).Round(time.Millisecond),wallets.historyCount(from,height),len(UTXOs),balance)
+	return nil
+}
+
+//用助记词恢复HD钱包：扫描区块链找出用过的地址，写入新的钱包文件。已有钱包文件时拒绝覆盖
+func (cli *CLI) restoreWallet(mnemonic, passphrase string, gapLimit int, name string) error{
+	file := walletFile
+	if name != ""{
+		err := checkWalletName(name)
+		if err != nil{
+			return err
+		}
+		file = walletFileName(name)
+	}
+	_,err := os.Stat(file)
+	if err == nil{
+		return fmt.Errorf("wallet file %s already exists, move it away before restoring",file)
+	}
+	if !os.IsNotExist(err){
+		return err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	used,err := bc.usedPubKeyHashes()
+	if err != nil{
+		return err
+	}
+	wallets,err := RestoreHDWallets(mnemonic,passphrase,gapLimit,used)
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	wallets.file = file
+	err = wallets.SaveToFile2()
+	if err != nil{
+		return err
+	}
+	if name != ""{
+		err = LoadWallet(name)
+		if err == nil{
+			err = SelectWallet(name)
+		}
+		if err != nil{
+			return err
+		}
+	}
+	fmt.Printf("restored %d addresses (next receive %d, next change %d)\n",len(wallets.GetAllAddress()),wallets.HDChain.NextReceive,wallets.HDChain.NextChange)
+	err = cli.rescanBlockchain(0,-1)
+	if err != nil{
+		return err
+	}
+	return cli.listAddress()
+}
+
+//加密钱包，加密后钱包是锁定的
+func (cli *CLI) encryptWallet(passphrase string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = wallets.Encrypt(passphrase)
+	if err != nil{
+		return err
+	}
+	fmt.Println("wallet encrypted, commands that need a private key will ask for the passphrase, or run them in walletPassphrase")
+	return nil
+}
+
+//CLI的每个命令是单独的进程，主密钥不写入文件，命令结束就没有了。
+//需要私钥的命令遇到锁定的钱包时提示输入口令，在本进程的内存中解锁
+func unlockWallets(wallets *Wallets) error{
+	if !wallets.IsLocked(){
+		return nil
+	}
+	passphrase,err := readPassphrase("","Wallet passphrase: ")
+	if err != nil{
+		return err
+	}
+	//命令中再次打开同一个钱包文件时（比如签名交易）也是解锁的
+	return wallets.UnlockFor(passphrase,cliUnlockTimeout)
+}
+
+//CLI命令解锁钱包的时间，命令结束时进程退出，主密钥随之清除
+const cliUnlockTimeout = time.Minute
+
+//解锁钱包timeout这么长时间。主密钥只在本进程的内存中，所以解锁期间从标准输入逐行读取命令，
+//在本进程中执行，需要私钥的命令不再提示输入口令。输入walletLock或exit、超时、
+//读到输入结束时锁定钱包并返回；命令出错时进程退出，主密钥随之清除
+func (cli *CLI) walletPassphrase(passphrase string, timeout time.Duration) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	err = wallets.UnlockFor(passphrase,timeout)
+	if err == nil{
+		//锁定期间密钥池可能用掉了一些，解锁后补满
+		err = wallets.TopUpKeyPool()
+	}
+	if err == nil{
+		err = wallets.SaveToFile2()
+	}
+	wallets.Close()
+	if err != nil{
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	fmt.Printf("wallet unlocked until %s, enter commands, walletLock or exit to lock\n",deadline.Format(time.RFC3339))
+	program := os.Args[0]
+	for{
+		fmt.Print("> ")
+		line,err := stdinReader.ReadString('\n')
+		if err != nil && line == ""{
+			fmt.Println()
+			return cli.walletLock()
+		}
+		if time.Now().After(deadline){
+			fmt.Println("unlock timed out")
+			return cli.walletLock()
+		}
+		args := strings.Fields(line)
+		if len(args) == 0{
+			continue
+		}
+		switch args[0]{
+		case "walletLock","exit","quit":
+			return cli.walletLock()
+		case "walletPassphrase":
+			fmt.Println("wallet is already unlocked")
+			continue
+		}
+		os.Args = append([]string{program},args...)
+		cli.Run()
+	}
+}
+
+//立即锁定钱包：清除本进程内存中UnlockFor保存的主密钥和解密出来的私钥
+func (cli *CLI) walletLock() error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	if !wallets.IsEncrypted(){
+		return ErrNotEncrypted
+	}
+	key,err := filepath.Abs(wallets.path())
+	if err != nil{
+		return err
+	}
+	walletUnlocks.Lock()
+	forgetUnlock(key)
+	walletUnlocks.Unlock()
+	wallets.Lock()
+	fmt.Println("wallet locked")
+	return nil
+}
+
+//修改钱包口令
+func (cli *CLI) changePassphrase(oldPassphrase, newPassphrase string) error{
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = wallets.ChangePassphrase(oldPassphrase,newPassphrase)
+	if err != nil{
+		return err
+	}
+	fmt.Println("wallet passphrase changed")
+	return nil
+}
+
+//读取口令用的标准输入，多次读取共用一个缓冲，不会丢掉已经读进缓冲的下一行
+var stdinReader = bufio.NewReader(os.Stdin)
+
+//口令参数为空时从标准输入读一行，避免口令留在命令行历史中
+func readPassphrase(value, prompt string) (string,error){
+	if value != ""{
+		return value,nil
+	}
+	fmt.Print(prompt)
+	line,err := stdinReader.ReadString('\n')
+	if err != nil && line == ""{
+		return "",fmt.Errorf("cannot read passphrase: %w",err)
+	}
+	return strings.TrimRight(line,"\r\n"),nil
+}
+
+func (cli *CLI) getBestHeight() error{
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	height,err := bc.GetBestHeight()
+	if err != nil{
+		return err
+	}
 
 	fmt.Printf("last height= %d\n",height)
+	return nil
 }
 
 //启动节点
-func (cli *CLI) startNode(nodeID string, minnerAddress string) {
+func (cli *CLI) startNode(nodeID string, minnerAddress string) error{
 	fmt.Printf("Starting node:  port=%s\n",nodeID)
 
 	if len(minnerAddress)>0{
 		if IsValidAdress([]byte(minnerAddress)){
 			fmt.Println("minner address is ok ",minnerAddress)
 		}else{
-			log.Panic("Error: minner address")
+			return fmt.Errorf("minner address: %w: %s",ErrInvalidAddress,minnerAddress)
+		}
+	}
+
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	return StartServer(nodeID,minnerAddress, bc)
+}
+
+//创建未签名的部分签名交易，不需要私钥，钱包锁定时也可以创建。和NewUTXOTransation一样，
+//发送方找零地址上的余额也可以花，找零付给密钥池中新的找零地址。手续费按签好名后的最大大小估算
+func (cli *CLI) createPSBT(from, to string, amount, feeRate Amount, replaceable bool, selector CoinSelector, out string) error{
+	_,err := GetPubKeyHash(to)
+	if err != nil{
+		return err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	_,err = wallets.GetWallet(from)
+	if err != nil{
+		return err
+	}
+
+	pool := Mempool{bc}
+	var utxos []UTXO
+	for _,address := range wallets.AccountAddresses(from){
+		accountWallet,err := wallets.GetWallet(address)
+		if err != nil{
+			return err
+		}
+		spendable,err := pool.FindSpendableUTXOs(HashPubKey(accountWallet.PublicKey))
+		if err != nil{
+			return err
 		}
+		utxos = append(utxos,spendable...)
+	}
+	if feeRate == 0{
+		feeRate = mempoolPolicy.MinRelayFeeRate
+	}
+	change,err := wallets.GetChangeAddress(from)
+	if err != nil{
+		return err
 	}
 
-	StartServer(nodeID,minnerAddress, cli.bc)
+	var psbt *PSBT
+	var fee Amount
+	for{
+		target,err := amount.Add(fee)
+		if err != nil{
+			return err
+		}
+		selected,acc,err := selector.Select(utxos,target)
+		if err != nil{
+			return err
+		}
+		psbt,err = NewPSBT(change,to,amount,fee,costOfChange(feeRate),selected,acc,inputSequence(replaceable))
+		if err != nil{
+			return err
+		}
+		need := feeForSize(feeRate,psbt.Tx.estimateSignedSize())
+		if fee >= need{
+			break
+		}
+		fee = need
+	}
+	//用到了找零地址才保存钱包
+	if len(psbt.Tx.Vout) > 1{
+		err = wallets.SaveToFile2()
+		if err != nil{
+			return err
+		}
+	}
+	err = psbt.SaveToFile(out)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("PSBT with %d inputs and fee %s written to %s\n",len(psbt.Tx.Vin),fee,out)
+	return nil
 }
 
+//用钱包中的私钥给PSBT签名，只读取钱包文件，不打开区块链数据库
+func (cli *CLI) signPSBT(in, out string, hashType SigHashType) error{
+	if out == ""{
+		out = in
+	}
+	psbt,err := LoadPSBT(in)
+	if err != nil{
+		return err
+	}
+	//签名前先显示交易的金额和手续费，让签名的人核对
+	fee,err := psbt.Fee()
+	if err != nil{
+		return err
+	}
+	for i,prevOut := range psbt.PrevOuts{
+		fmt.Printf("input %d: %s from %s\n",i,prevOut.Value,NewAddress(prevOut.PubkeyHash,chainParams))
+	}
+	for i,out := range psbt.Tx.Vout{
+		fmt.Printf("output %d: %s to %s\n",i,out.Value,NewAddress(out.PubkeyHash,chainParams))
+	}
+	fmt.Printf("fee: %s (%.2f per 1000 bytes)\n",fee,feeRate(fee,psbt.Tx.estimateSignedSize()))
 
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	signed,err := psbt.Sign(wallets,hashType)
+	if err != nil{
+		return err
+	}
+	if signed == 0{
+		return fmt.Errorf("%w: no inputs can be signed with this wallet",ErrUnknownAddress)
+	}
+	err = psbt.SaveToFile(out)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("signed %d inputs, written to %s\n",signed,out)
+	return nil
+}
 
+//合并多个PSBT文件中的签名
+func (cli *CLI) combinePSBT(ins []string, out string) error{
+	var combined *PSBT
+	for _,in := range ins{
+		psbt,err := LoadPSBT(strings.TrimSpace(in))
+		if err != nil{
+			return err
+		}
+		if combined == nil{
+			combined = psbt
+			continue
+		}
+		err = combined.Combine(psbt)
+		if err != nil{
+			return fmt.Errorf("%s: %w",in,err)
+		}
+	}
+	err := combined.SaveToFile(out)
+	if err != nil{
+		return err
+	}
+	fmt.Println(combined.ToString())
+	return nil
+}
 
+//检查PSBT的全部签名，通过后标记为可以广播
+func (cli *CLI) finalizePSBT(in, out string) error{
+	if out == ""{
+		out = in
+	}
+	psbt,err := LoadPSBT(in)
+	if err != nil{
+		return err
+	}
+	err = psbt.Finalize()
+	if err != nil{
+		return err
+	}
+	err = psbt.SaveToFile(out)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("PSBT finalized, transation %x written to %s\n",psbt.Tx.ID,out)
+	return nil
+}
+
+//广播检查过的PSBT：确认引用的输出还没有花费，且和文件中带的输出一致，再放入交易池并转发
+func (cli *CLI) broadcastPSBT(in string) error{
+	psbt,err := LoadPSBT(in)
+	if err != nil{
+		return err
+	}
+	if !psbt.Final{
+		return fmt.Errorf("%w: run finalizePSBT first",ErrInvalidPSBT)
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+
+	prevOuts,err := Mempool{bc}.FindPrevOutputs(&psbt.Tx)
+	if err != nil{
+		return err
+	}
+	for inID,out := range prevOuts{
+		prevOut := psbt.PrevOuts[inID]
+		if out.Value != prevOut.Value || !out.CanBeUnlockedWith(prevOut.PubkeyHash){
+			return fmt.Errorf("%w: input %d does not match the chain",ErrInvalidPSBT,inID)
+		}
+	}
+
+	err = cli.submitTransation(&psbt.Tx)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("transation %x broadcast\n",psbt.Tx.ID)
+	return nil
+}
+
+//按指定的输入和输出创建未签名的原始交易，打印十六进制编码
+func (cli *CLI) createRawTransaction(inputs, outputs string, replaceable bool) error{
+	vin,err := ParseRawInputs(inputs)
+	if err != nil{
+		return err
+	}
+	for i := range vin{
+		vin[i].Sequence = inputSequence(replaceable)
+	}
+	vout,err := ParseRawOutputs(outputs)
+	if err != nil{
+		return err
+	}
+	tx := NewRawTransation(vin,vout)
+	fmt.Println(tx.RawHex())
+	return nil
+}
+
+//解码原始交易并打印
+func (cli *CLI) decodeRawTransaction(rawhex string) error{
+	tx,err := DecodeRawTransation(rawhex)
+	if err != nil{
+		return err
+	}
+	fmt.Println(tx.ToString())
+	fmt.Printf("   Complete: %v\n",tx.isComplete())
+	return nil
+}
+
+//用钱包中的私钥签名原始交易，引用的输出从UTXO数据桶和交易池中查找，打印签名后的十六进制编码
+func (cli *CLI) signRawTransaction(rawhex string, hashType SigHashType) error{
+	tx,err := DecodeRawTransation(rawhex)
+	if err != nil{
+		return err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	prevOuts,err := Mempool{bc}.FindPrevOutputs(tx)
+	if err != nil{
+		return err
+	}
+
+	wallets,err := NewWallets()
+	if err != nil{
+		return err
+	}
+	defer wallets.Close()
+	err = unlockWallets(wallets)
+	if err != nil{
+		return err
+	}
+	signed,err := signWithWallets(tx,prevOuts,wallets,hashType)
+	if err != nil{
+		return err
+	}
+	if signed > 0{
+		tx.ID = tx.unsignedID()
+	}
+	fmt.Println(tx.RawHex())
+	fmt.Printf("signed %d inputs, complete: %v\n",signed,tx.isComplete())
+	return nil
+}
+
+//发送签好名的原始交易：输入必须都还没有花费，签名和金额检查通过后放入交易池并转发
+func (cli *CLI) sendRawTransaction(rawhex string) error{
+	tx,err := DecodeRawTransation(rawhex)
+	if err != nil{
+		return err
+	}
+	if !tx.isComplete(){
+		return fmt.Errorf("%w: transation is not fully signed",ErrInvalidTransation)
+	}
+	err = tx.checkID()
+	if err != nil{
+		return err
+	}
+	bc,err := cli.chain()
+	if err != nil{
+		return err
+	}
+	_,err = Mempool{bc}.FindPrevOutputs(tx)
+	if err != nil{
+		return err
+	}
+
+	err = cli.submitTransation(tx)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("transation %x sent\n",tx.ID)
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+//一笔未花费输出，带上所在交易的hash和输出序号，可以直接作为新交易的Vin
+type UTXO struct{
+	TXid      []byte   //所在交易的hash值
+	Voutindex int      //输出序号
+	Output    TXOutput //输出内容，金额+公钥hash
+}
+
+//选币策略：从可用的UTXO中挑出一组作为交易输入，总金额要够amount。
+//返回选中的UTXO和它们的总金额，选不出来就返回错误。
+//注意实现不能修改传入的utxos切片，调用方可能还要用。
+type CoinSelector interface{
+	Select(utxos []UTXO,amount Amount) ([]UTXO,Amount,error)
+}
+
+//默认的选币策略
+var DefaultCoinSelector CoinSelector = LargestFirstSelector{}
+
+//根据名字创建选币策略，命令行参数用
+func NewCoinSelector(name string,seed int64) (CoinSelector,error){
+	switch name{
+	case "","largest":
+		return LargestFirstSelector{},nil
+	case "smallest":
+		return SmallestFirstSelector{},nil
+	case "bnb":
+		//手续费按交易大小计算，正好凑出金额的组合很少，差一点的也接受，实在没有就按大额优先
+		return &BranchAndBoundSelector{CostOfChange: costOfChange(mempoolPolicy.MinRelayFeeRate),Fallback: LargestFirstSelector{}},nil
+	case "random":
+		return NewRandomSelector(seed),nil
+	}
+	return nil,fmt.Errorf("Error: unknown coin selector %q, use largest|smallest|bnb|random",name)
+}
+
+//大额优先：输入个数最少，但是大额的UTXO很快就会被拆碎
+type LargestFirstSelector struct{}
+
+func (LargestFirstSelector) Select(utxos []UTXO,amount Amount) ([]UTXO,Amount,error){
+	candidates := sortedUTXOs(utxos,true)
+	return accumulateUTXOs(candidates,amount)
+}
+
+//小额优先：顺便把零碎的UTXO合并掉，代价是交易的输入多
+type SmallestFirstSelector struct{}
+
+func (SmallestFirstSelector) Select(utxos []UTXO,amount Amount) ([]UTXO,Amount,error){
+	candidates := sortedUTXOs(utxos,false)
+	return accumulateUTXOs(candidates,amount)
+}
+
+//分支定界：寻找总金额正好等于amount的组合，这样交易就不需要找零输出。
+//总金额比amount多出不到CostOfChange也接受，多出的部分不值得找零，留给矿工。
+//搜索次数超过MaxTries还没找到，就交给Fallback；Fallback为空就返回错误。
+type BranchAndBoundSelector struct{
+	MaxTries     int          //最多尝试的搜索节点数，0表示默认值
+	CostOfChange Amount       //可以接受的超出金额，0表示只接受正好等于amount的组合
+	Fallback     CoinSelector //找不到精确组合时的备用策略
+}
+
+const defaultBnBMaxTries = 100000
+
+//找零输出和以后花掉它的输入的大致字节数，用来估算找零的代价
+const (
+	changeOutputSize = 34  //金额和公钥hash
+	changeSpendSize  = 180 //输出位置、DER签名和公钥
+)
+
+//找零的代价：多一个找零输出，以后花掉它还要多一个输入，按feeRate要多付的手续费。
+//找零不到这么多时不值得加找零输出，留给矿工
+func costOfChange(feeRate Amount) Amount{
+	return feeForSize(feeRate,changeOutputSize+changeSpendSize)
+}
+
+func (s *BranchAndBoundSelector) Select(utxos []UTXO,amount Amount) ([]UTXO,Amount,error){
+	maxTries := s.MaxTries
+	if maxTries <= 0{
+		maxTries = defaultBnBMaxTries
+	}
+
+	//从大到小排序，先试大额的能更快地逼近目标
+	candidates := sortedUTXOs(utxos,true)
+
+	//remaining[i]表示从第i个开始剩下的所有UTXO的总金额，用于剪枝
+	remaining := make([]Amount,len(candidates)+1)
+	for i := len(candidates) - 1; i >= 0; i--{
+		remaining[i] = remaining[i+1] + candidates[i].Output.Value
+	}
+
+	var selected []int
+	var best []int
+	var bestTotal Amount
+	tries := 0
+
+	//深度优先搜索，每个UTXO分选中和不选两个分支
+	var search func(i int,total Amount) bool
+	search = func(i int,total Amount) bool{
+		tries++
+		if total >= amount && total <= amount+s.CostOfChange{
+			best = append([]int{},selected...)
+			bestTotal = total
+			return true
+		}
+		//超过目标，或者剩下的全选也不够，或者搜索次数用完，都剪掉
+		if total > amount || total+remaining[i] < amount || i == len(candidates) || tries >= maxTries{
+			return false
+		}
+
+		selected = append(selected,i)
+		if search(i+1,total+candidates[i].Output.Value){
+			return true
+		}
+		selected = selected[:len(selected)-1]
+
+		//跳过和当前金额相同的UTXO，不选它们的结果一样，不用重复搜索
+		j := i + 1
+		for j < len(candidates) && candidates[j].Output.Value == candidates[i].Output.Value{
+			j++
+		}
+		return search(j,total)
+	}
+
+	if search(0,0){
+		var result []UTXO
+		for _,i := range best{
+			result = append(result,candidates[i])
+		}
+		return result,bestTotal,nil
+	}
+
+	if s.Fallback != nil{
+		return s.Fallback.Select(utxos,amount)
+	}
+	if remaining[0] < amount{
+		return nil,0,fmt.Errorf("%w: have %s, need %s",ErrInsufficientFunds,remaining[0],amount)
+	}
+	return nil,0,ErrNoExactMatch
+}
+
+//随机选择：打乱顺序后累加，让别人难以根据选币规律关联地址。
+//Rand可以指定种子，同样的种子和UTXO得到同样的结果，方便测试重现。
+type RandomSelector struct{
+	Rand *rand.Rand
+}
+
+//创建随机选币策略，seed为0时用当前时间作种子
+func NewRandomSelector(seed int64) *RandomSelector{
+	if seed == 0{
+		seed = time.Now().UnixNano()
+	}
+	return &RandomSelector{rand.New(rand.NewSource(seed))}
+}
+
+func (s *RandomSelector) Select(utxos []UTXO,amount Amount) ([]UTXO,Amount,error){
+	//先排序再打乱，保证结果只和种子有关，和UTXO的读取顺序无关
+	candidates := sortedUTXOs(utxos,false)
+	s.Rand.Shuffle(len(candidates),func(i,j int){
+		candidates[i],candidates[j] = candidates[j],candidates[i]
+	})
+	return accumulateUTXOs(candidates,amount)
+}
+
+//按顺序累加UTXO，直到金额够了为止
+func accumulateUTXOs(candidates []UTXO,amount Amount) ([]UTXO,Amount,error){
+	var result []UTXO
+	var accumulated Amount
+	for _,utxo := range candidates{
+		if accumulated >= amount{
+			break
+		}
+		result = append(result,utxo)
+		accumulated += utxo.Output.Value
+	}
+	if accumulated < amount{
+		return nil,0,fmt.Errorf("%w: have %s, need %s",ErrInsufficientFunds,accumulated,amount)
+	}
+	return result,accumulated,nil
+}
+
+//复制一份UTXO并按金额排序，金额相同时按交易hash和输出序号排序，保证结果是确定的
+func sortedUTXOs(utxos []UTXO,descending bool) []UTXO{
+	candidates := append([]UTXO{},utxos...)
+	sort.SliceStable(candidates,func(i,j int) bool{
+		a,b := candidates[i],candidates[j]
+		if a.Output.Value != b.Output.Value{
+			if descending{
+				return a.Output.Value > b.Output.Value
+			}
+			return a.Output.Value < b.Output.Value
+		}
+		if c := bytes.Compare(a.TXid,b.TXid); c != 0{
+			return c < 0
+		}
+		return a.Voutindex < b.Voutindex
+	})
+	return candidates
+}
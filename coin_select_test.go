@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+//测试用的UTXO，id作为交易hash，金额相同时按id排序
+func testUTXO(id byte,value Amount) UTXO{
+	return UTXO{TXid: []byte{id},Voutindex: 0,Output: TXOutput{Value: value}}
+}
+
+//选中的UTXO的id，按选中的顺序
+func utxoIDs(utxos []UTXO) []byte{
+	var ids []byte
+	for _,utxo := range utxos{
+		ids = append(ids,utxo.TXid[0])
+	}
+	return ids
+}
+
+var testUTXOs = []UTXO{
+	testUTXO(1,5),
+	testUTXO(2,3),
+	testUTXO(3,8),
+	testUTXO(4,1),
+	testUTXO(5,10),
+	testUTXO(6,3),
+}
+
+func TestCoinSelectors(t *testing.T){
+	tests := []struct{
+		name     string
+		selector CoinSelector
+		amount   Amount
+		ids      []byte
+		total    Amount
+		err      error
+	}{
+		{"largest one input",LargestFirstSelector{},9,[]byte{5},10,nil},
+		{"largest two inputs",LargestFirstSelector{},15,[]byte{5,3},18,nil},
+		{"largest all",LargestFirstSelector{},30,[]byte{5,3,1,2,6,4},30,nil},
+		{"largest insufficient",LargestFirstSelector{},31,nil,0,ErrInsufficientFunds},
+		{"smallest",SmallestFirstSelector{},6,[]byte{4,2,6},7,nil},
+		{"smallest exact",SmallestFirstSelector{},7,[]byte{4,2,6},7,nil},
+		{"smallest insufficient",SmallestFirstSelector{},31,nil,0,ErrInsufficientFunds},
+		{"bnb exact single",&BranchAndBoundSelector{},8,[]byte{3},8,nil},
+		{"bnb exact pair",&BranchAndBoundSelector{},9,[]byte{3,4},9,nil},
+		{"bnb exact many",&BranchAndBoundSelector{},29,[]byte{5,3,1,2,6},29,nil},
+		{"bnb no exact match",&BranchAndBoundSelector{},31,nil,0,ErrInsufficientFunds},
+		{"bnb within cost of change",&BranchAndBoundSelector{CostOfChange: 1},12,[]byte{5,2},13,nil},
+		{"bnb fallback",&BranchAndBoundSelector{MaxTries: 1,Fallback: LargestFirstSelector{}},9,[]byte{5},10,nil},
+		{"bnb tries exhausted",&BranchAndBoundSelector{MaxTries: 1},9,nil,0,ErrNoExactMatch},
+		{"random insufficient",NewRandomSelector(1),31,nil,0,ErrInsufficientFunds},
+	}
+	for _,tt := range tests{
+		t.Run(tt.name,func(t *testing.T){
+			selected,total,err := tt.selector.Select(testUTXOs,tt.amount)
+			if !errors.Is(err,tt.err){
+				t.Fatalf("err = %v, want %v",err,tt.err)
+			}
+			if ids := utxoIDs(selected); !reflect.DeepEqual(ids,tt.ids){
+				t.Errorf("selected %v, want %v",ids,tt.ids)
+			}
+			if total != tt.total{
+				t.Errorf("total = %d, want %d",total,tt.total)
+			}
+		})
+	}
+}
+
+//没有全部金额都能凑出来的组合时返回ErrNoExactMatch，有Fallback时用Fallback的结果
+func TestBranchAndBoundNoExactMatch(t *testing.T){
+	utxos := []UTXO{testUTXO(1,4),testUTXO(2,6)}
+	_,_,err := (&BranchAndBoundSelector{}).Select(utxos,5)
+	if !errors.Is(err,ErrNoExactMatch){
+		t.Fatalf("err = %v, want %v",err,ErrNoExactMatch)
+	}
+	selected,total,err := (&BranchAndBoundSelector{Fallback: SmallestFirstSelector{}}).Select(utxos,5)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if ids := utxoIDs(selected); !reflect.DeepEqual(ids,[]byte{1,2}) || total != 10{
+		t.Errorf("fallback selected %v total %d",ids,total)
+	}
+}
+
+//命令行的bnb接受差一点的组合，找不到时按大额优先，不会因为手续费凑不整而失败
+func TestNewCoinSelectorBnB(t *testing.T){
+	selector,err := NewCoinSelector("bnb",0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	utxos := []UTXO{testUTXO(1,4*Coin),testUTXO(2,6*Coin),testUTXO(3,3*Coin)}
+	cost := costOfChange(mempoolPolicy.MinRelayFeeRate)
+	selected,total,err := selector.Select(utxos,7*Coin-cost)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if ids := utxoIDs(selected); !reflect.DeepEqual(ids,[]byte{1,3}) || total != 7*Coin{
+		t.Errorf("selected %v total %s, want [1 3] total %s",ids,total,7*Coin)
+	}
+	selected,total,err = selector.Select(utxos,5*Coin)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if ids := utxoIDs(selected); !reflect.DeepEqual(ids,[]byte{2}) || total != 6*Coin{
+		t.Errorf("fallback selected %v total %s",ids,total)
+	}
+}
+
+//同样的种子得到同样的结果，和UTXO的顺序无关；选择器不修改传入的切片
+func TestRandomSelectorSeed(t *testing.T){
+	reversed := make([]UTXO,len(testUTXOs))
+	for i,utxo := range testUTXOs{
+		reversed[len(testUTXOs)-1-i] = utxo
+	}
+	before := append([]UTXO{},testUTXOs...)
+
+	first,firstTotal,err := NewRandomSelector(42).Select(testUTXOs,12)
+	if err != nil{
+		t.Fatal(err)
+	}
+	second,secondTotal,err := NewRandomSelector(42).Select(reversed,12)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(utxoIDs(first),utxoIDs(second)) || firstTotal != secondTotal{
+		t.Errorf("seed 42 gave %v and %v",utxoIDs(first),utxoIDs(second))
+	}
+	if firstTotal < 12{
+		t.Errorf("total %d is less than the amount",firstTotal)
+	}
+	if !reflect.DeepEqual(testUTXOs,before){
+		t.Error("Select modified its input")
+	}
+
+	//全部选中时结果就是打乱后的顺序，不同的种子总有一个会打乱成不同的顺序
+	all,_,_ := NewRandomSelector(42).Select(testUTXOs,30)
+	for seed := int64(1); seed <= 20; seed++{
+		other,_,_ := NewRandomSelector(seed).Select(testUTXOs,30)
+		if !reflect.DeepEqual(utxoIDs(other),utxoIDs(all)){
+			return
+		}
+	}
+	t.Error("20 seeds all selected the same inputs")
+}
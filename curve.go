@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+//钱包支持的椭圆曲线。比特币用的是secp256k1，早期版本的钱包用的是P256（secp256r1）
+type CurveID byte
+
+const (
+	CurveP256      CurveID = 1
+	CurveSecp256k1 CurveID = 2
+)
+
+//新建钱包默认使用的曲线
+var DefaultCurve = CurveSecp256k1
+
+//验证签名时依次尝试的曲线，公钥编码中没有曲线信息
+var supportedCurves = []CurveID{CurveSecp256k1,CurveP256}
+
+//返回曲线的实现
+func (id CurveID) Curve() elliptic.Curve{
+	switch id{
+	case CurveP256:
+		return elliptic.P256()
+	case CurveSecp256k1:
+		return S256()
+	}
+	return nil
+}
+
+func (id CurveID) String() string{
+	switch id{
+	case CurveP256:
+		return "P256"
+	case CurveSecp256k1:
+		return "secp256k1"
+	}
+	return fmt.Sprintf("UNKNOWN(%d)",byte(id))
+}
+
+//解析命令行中的曲线名，不区分大小写
+func ParseCurveID(s string) (CurveID,error){
+	switch strings.ToLower(strings.TrimSpace(s)){
+	case "","secp256k1","k1":
+		return CurveSecp256k1,nil
+	case "p256","p-256","secp256r1":
+		return CurveP256,nil
+	}
+	return 0,fmt.Errorf("unknown curve %q, use secp256k1 or P256",s)
+}
+
+//根据曲线实现反查曲线编号，不支持的曲线返回0
+func curveIDOf(curve elliptic.Curve) CurveID{
+	if curve == nil{
+		return 0
+	}
+	switch curve.Params().Name{
+	case "P-256":
+		return CurveP256
+	case "secp256k1":
+		return CurveSecp256k1
+	}
+	return 0
+}
+
+//用私钥对hash签名，返回low-S的r、s。
+//secp256k1按RFC6979确定性地生成随机数k，相同的私钥和hash总是得到相同的签名，可以和比特币的测试向量对照；
+//P256继续使用标准库的签名
+func signHash(priv *ecdsa.PrivateKey,hash []byte) (*big.Int,*big.Int,error){
+	var r,s *big.Int
+	var err error
+	switch curveIDOf(priv.Curve){
+	case CurveSecp256k1:
+		r,s,err = signRFC6979(priv,hash)
+	case CurveP256:
+		r,s,err = ecdsa.Sign(rand.Reader,priv,hash)
+	default:
+		return nil,nil,fmt.Errorf("unsupported curve %s",priv.Curve.Params().Name)
+	}
+	if err != nil{
+		return nil,nil,err
+	}
+	return r,normalizeLowS(priv.Curve,s),nil
+}
+
+//验证签名：在支持的曲线上依次解析公钥并验证，任何一条曲线上验证通过即可。
+//旧格式（直接拼接x、y）的公钥只会出现在P256钱包中，ParsePubKey在secp256k1上找不到点时会跳过
+func verifySignature(pubkey []byte,hash []byte,r,s *big.Int) error{
+	var lastErr error = errInvalidPubKey
+	for _,id := range supportedCurves{
+		curve := id.Curve()
+		pub,err := ParsePubKey(curve,pubkey)
+		if err != nil{
+			continue
+		}
+		if !isLowS(curve,s){
+			lastErr = fmt.Errorf("signature is not low-S")
+			continue
+		}
+		if verifyECDSA(pub,hash,r,s){
+			return nil
+		}
+		lastErr = fmt.Errorf("bad signature")
+	}
+	return lastErr
+}
+
+//曲线提供CombinedMult时（secp256k1）自己完成ECDSA验证，u1*G + u2*Q一次算出，只求一次模逆；
+//其他曲线交给标准库
+func verifyECDSA(pub *ecdsa.PublicKey,hash []byte,r,s *big.Int) bool{
+	cm,ok := pub.Curve.(interface{
+		CombinedMult(Bx,By *big.Int,baseScalar,scalar []byte) (*big.Int,*big.Int)
+	})
+	if !ok{
+		return ecdsa.Verify(pub,hash,r,s)
+	}
+	n := pub.Curve.Params().N
+	if r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(n) >= 0 || s.Cmp(n) >= 0{
+		return false
+	}
+
+	//w = s⁻¹, u1 = e*w, u2 = r*w
+	w := new(big.Int).ModInverse(s,n)
+	u1 := hashToInt(hash,n)
+	u1.Mul(u1,w)
+	u1.Mod(u1,n)
+	u2 := w.Mul(r,w)
+	u2.Mod(u2,n)
+
+	x,y := cm.CombinedMult(pub.X,pub.Y,u1.Bytes(),u2.Bytes())
+	if x.Sign() == 0 && y.Sign() == 0{
+		return false
+	}
+	return x.Mod(x,n).Cmp(r) == 0
+}
+
+//按RFC6979用HMAC-SHA256生成k并签名
+func signRFC6979(priv *ecdsa.PrivateKey,hash []byte) (*big.Int,*big.Int,error){
+	params := priv.Curve.Params()
+	n := params.N
+	e := hashToInt(hash,n)
+
+	nextK := rfc6979Nonces(priv.D,hash,n)
+	for i := 0; i < 100; i++{
+		k := nextK()
+
+		//r = (k*G).x mod n
+		kx,_ := priv.Curve.ScalarBaseMult(k.Bytes())
+		r := new(big.Int).Mod(kx,n)
+		if r.Sign() == 0{
+			continue
+		}
+
+		//s = k⁻¹(e + r*d) mod n
+		s := new(big.Int).Mul(r,priv.D)
+		s.Add(s,e)
+		s.Mul(s,new(big.Int).ModInverse(k,n))
+		s.Mod(s,n)
+		if s.Sign() == 0{
+			continue
+		}
+		return r,s,nil
+	}
+	return nil,nil,fmt.Errorf("failed to find a valid nonce")
+}
+
+//把hash转换成整数，超过n的位数时只取高位（与ecdsa的做法一致）
+func hashToInt(hash []byte,n *big.Int) *big.Int{
+	orderBits := n.BitLen()
+	orderBytes := (orderBits + 7) / 8
+	if len(hash) > orderBytes{
+		hash = hash[:orderBytes]
+	}
+	ret := new(big.Int).SetBytes(hash)
+	excess := len(hash)*8 - orderBits
+	if excess > 0{
+		ret.Rsh(ret,uint(excess))
+	}
+	return ret
+}
+
+//RFC6979第3.2节：返回一个函数，每次调用生成下一个候选的k，保证 1 <= k < n
+func rfc6979Nonces(d *big.Int,hash []byte,n *big.Int) func() *big.Int{
+	size := (n.BitLen() + 7) / 8
+
+	x := make([]byte,size)
+	d.FillBytes(x)
+	h1 := make([]byte,size)
+	new(big.Int).Mod(hashToInt(hash,n),n).FillBytes(h1)
+
+	v := make([]byte,sha256.Size)
+	k := make([]byte,sha256.Size)
+	for i := range v{
+		v[i] = 0x01
+	}
+
+	mac := func(key []byte,data ...[]byte) []byte{
+		m := hmac.New(sha256.New,key)
+		for _,b := range data{
+			m.Write(b)
+		}
+		return m.Sum(nil)
+	}
+
+	k = mac(k,v,[]byte{0x00},x,h1)
+	v = mac(k,v)
+	k = mac(k,v,[]byte{0x01},x,h1)
+	v = mac(k,v)
+
+	first := true
+	return func() *big.Int{
+		for{
+			//上一个k不可用时，按规范更新K、V后再生成
+			if !first{
+				k = mac(k,v,[]byte{0x00})
+				v = mac(k,v)
+			}
+			first = false
+
+			var t []byte
+			for len(t) < size{
+				v = mac(k,v)
+				t = append(t,v...)
+			}
+			candidate := hashToInt(t[:size],n)
+			if candidate.Sign() > 0 && candidate.Cmp(n) < 0{
+				return candidate
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "errors"
+
+//库函数返回的错误类型，调用方可以用errors.Is判断具体是哪一种错误，
+//返回时一般会用fmt.Errorf("%w")包装上更详细的说明。
+var (
+	ErrInsufficientFunds = errors.New("not enough funds")                     //余额不足
+	ErrNoExactMatch      = errors.New("no exact coin match without change")   //分支定界选币找不到精确组合
+	ErrUnknownAddress    = errors.New("address is not in the wallet")         //钱包集中没有这个地址
+	ErrInvalidAddress    = errors.New("invalid address")                      //地址格式或校验和错误
+	ErrTxNotFound        = errors.New("transation not found")                 //链上找不到指定的交易
+	ErrInvalidTransation = errors.New("invalid transation")                   //交易不合法，例如签名错误
+	ErrBlockNotFound     = errors.New("block not found")                      //数据库中找不到指定的区块
+	ErrInvalidBlock      = errors.New("invalid block")                        //区块数据损坏或者包含不合法的交易
+	ErrInvalidMessage    = errors.New("invalid peer message")                 //其他节点发来的命令数据无法解析
+	ErrWalletFile        = errors.New("wallet file is corrupt or unreadable") //钱包文件读写失败
+	ErrInvalidPSBT       = errors.New("invalid psbt")                         //部分签名交易文件损坏或者还不能广播
+	ErrOutputSpent       = errors.New("output is spent or does not exist")    //UTXO集中找不到引用的输出
+	ErrTxInMempool       = errors.New("transation already known")             //交易已经在交易池中或者已经上链
+	ErrMempoolConflict   = errors.New("transation conflicts with mempool")    //和交易池中的交易花费同一个输出
+	ErrFeeTooLow         = errors.New("transation fee too low")               //手续费低于最低转发费率
+	ErrMempoolFull       = errors.New("mempool full")                         //交易池满了，这笔交易的费率不够挤掉别的交易
+	ErrMempoolChain      = errors.New("unconfirmed chain too long")           //池中未确认的交易，祖先或后代太多
+	ErrNotReplaceable    = errors.New("transation is not replaceable")        //池中的交易没有声明允许替换（RBF）
+	ErrInvalidAmount     = errors.New("invalid amount")                       //金额格式错误、为负数或超过MaxMoney
+	ErrNonStandard       = errors.New("transation is not standard")           //交易合法，但不符合本节点的转发标准，例如太大
+	ErrWalletLocked      = errors.New("wallet is locked")                     //钱包加密了，需要先用口令解锁
+	ErrWrongPassphrase   = errors.New("incorrect wallet passphrase")          //钱包口令错误
+	ErrWalletEncrypted   = errors.New("wallet is already encrypted")          //钱包已经加密过，要改口令用changePassphrase
+	ErrNotEncrypted      = errors.New("wallet is not encrypted")              //钱包没有加密，不需要解锁
+	ErrInvalidMnemonic   = errors.New("invalid mnemonic")                     //助记词的单词、个数或校验位不对
+	ErrInvalidKey        = errors.New("invalid key")                          //扩展密钥、派生路径或私钥格式不对
+	ErrWatchOnly         = errors.New("address is watch-only")                //钱包中只有这个地址或公钥，没有私钥，不能花费
+	ErrRescanAborted     = errors.New("rescan aborted")                       //重新扫描区块链被用户中止
+	ErrInvalidSignature  = errors.New("invalid message signature")            //消息签名格式错误，或者不是这个地址的私钥签的
+	ErrWalletInUse       = errors.New("wallet is in use by another process")  //别的进程打开了这个钱包，等它结束再试
+	ErrChainFormat       = errors.New("incompatible blockchain database")     //区块链数据库是旧版本建立的，数据格式不兼容
+)
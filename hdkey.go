@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+//BIP32分层确定性密钥：由种子得到主密钥，每个密钥加上链码可以派生出2^32个子密钥。
+//序号 >= HardenedKeyStart 的是强化派生，只能由私钥派生；普通派生也可以只用公钥派生出子公钥。
+//只支持secp256k1曲线
+type ExtendedKey struct{
+	Key       []byte //私钥是32字节，公钥是33字节的压缩格式
+	ChainCode []byte
+	Depth     byte
+	ParentFP  []byte //父密钥公钥hash的前4个字节
+	Index     uint32
+	Private   bool
+
+	pub []byte //私钥对应的压缩公钥，第一次用到时计算
+}
+
+const HardenedKeyStart uint32 = 0x80000000
+
+//扩展密钥序列化时的版本号，对应Base58编码后的xprv、xpub前缀
+var (
+	xprvVersion = []byte{0x04,0x88,0xad,0xe4}
+	xpubVersion = []byte{0x04,0x88,0xb2,0x1e}
+)
+
+//由种子计算主密钥：I = HMAC-SHA512("Bitcoin seed", 种子)，左32字节是私钥，右32字节是链码
+func NewMasterKey(seed []byte) (*ExtendedKey,error){
+	if len(seed) < 16 || len(seed) > 64{
+		return nil,fmt.Errorf("%w: seed must be 16..64 bytes",ErrInvalidKey)
+	}
+	mac := hmac.New(sha512.New,[]byte("Bitcoin seed"))
+	mac.Write(seed)
+	I := mac.Sum(nil)
+
+	k := new(big.Int).SetBytes(I[:32])
+	if k.Sign() == 0 || k.Cmp(S256().Params().N) >= 0{
+		return nil,fmt.Errorf("%w: unusable seed",ErrInvalidKey)
+	}
+	return &ExtendedKey{I[:32],I[32:],0,[]byte{0,0,0,0},0,true,nil},nil
+}
+
+//压缩格式的公钥
+func (k *ExtendedKey) PublicKeyBytes() []byte{
+	if !k.Private{
+		return k.Key
+	}
+	//点乘比较慢，同一个父密钥派生多个子密钥时只算一次
+	if k.pub == nil{
+		x,y := S256().ScalarBaseMult(k.Key)
+		k.pub = MarshalPubKey(&ecdsa.PublicKey{Curve: S256(),X: x,Y: y},true)
+	}
+	return k.pub
+}
+
+//派生第index个子密钥。私钥派生出子私钥，公钥只能普通派生出子公钥。
+//极少数情况下算出的子密钥无效（概率约2^-127），返回ErrInvalidKey，调用方跳过这个序号
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey,error){
+	hardened := index >= HardenedKeyStart
+	if hardened && !k.Private{
+		return nil,fmt.Errorf("%w: hardened derivation needs the private key",ErrInvalidKey)
+	}
+
+	//强化派生：0x00 + 私钥 + 序号；普通派生：压缩公钥 + 序号
+	var data []byte
+	if hardened{
+		data = append([]byte{0},k.Key...)
+	}else{
+		data = append([]byte{},k.PublicKeyBytes()...)
+	}
+	var indexBytes [4]byte
+	binary.BigEndian.PutUint32(indexBytes[:],index)
+	data = append(data,indexBytes[:]...)
+	mac := hmac.New(sha512.New,k.ChainCode)
+	mac.Write(data)
+	I := mac.Sum(nil)
+
+	curve := S256()
+	n := curve.Params().N
+	il := new(big.Int).SetBytes(I[:32])
+	if il.Cmp(n) >= 0{
+		return nil,fmt.Errorf("%w: child %d is invalid",ErrInvalidKey,index)
+	}
+
+	child := &ExtendedKey{
+		ChainCode: I[32:],
+		Depth:     k.Depth + 1,
+		ParentFP:  HashPubKey(k.PublicKeyBytes())[:4],
+		Index:     index,
+		Private:   k.Private,
+	}
+	if k.Private{
+		//子私钥 = (IL + 父私钥) mod n
+		key := new(big.Int).Add(il,new(big.Int).SetBytes(k.Key))
+		key.Mod(key,n)
+		if key.Sign() == 0{
+			return nil,fmt.Errorf("%w: child %d is invalid",ErrInvalidKey,index)
+		}
+		child.Key = key.FillBytes(make([]byte,32))
+		return child,nil
+	}
+
+	//子公钥 = IL*G + 父公钥
+	parent,err := ParsePubKey(curve,k.Key)
+	if err != nil{
+		return nil,fmt.Errorf("%w: %v",ErrInvalidKey,err)
+	}
+	x,y := curve.ScalarBaseMult(I[:32])
+	x,y = curve.Add(x,y,parent.X,parent.Y)
+	if x.Sign() == 0 && y.Sign() == 0{
+		return nil,fmt.Errorf("%w: child %d is invalid",ErrInvalidKey,index)
+	}
+	child.Key = MarshalPubKey(&ecdsa.PublicKey{Curve: curve,X: x,Y: y},true)
+	return child,nil
+}
+
+//按路径依次派生
+func (k *ExtendedKey) Derive(path []uint32) (*ExtendedKey,error){
+	key := k
+	for _,index := range path{
+		var err error
+		key,err = key.Child(index)
+		if err != nil{
+			return nil,err
+		}
+	}
+	return key,nil
+}
+
+//只保留公钥的扩展密钥
+func (k *ExtendedKey) Neuter() *ExtendedKey{
+	if !k.Private{
+		return k
+	}
+	return &ExtendedKey{k.PublicKeyBytes(),k.ChainCode,k.Depth,k.ParentFP,k.Index,false,nil}
+}
+
+//转换成ecdsa私钥，公钥扩展密钥返回ErrInvalidKey
+func (k *ExtendedKey) ECPrivateKey() (*ecdsa.PrivateKey,error){
+	if !k.Private{
+		return nil,fmt.Errorf("%w: not a private key",ErrInvalidKey)
+	}
+	curve := S256()
+	x,y := curve.ScalarBaseMult(k.Key)
+	return &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve,X: x,Y: y},D: new(big.Int).SetBytes(k.Key)},nil
+}
+
+//按BIP32的格式序列化成xprv...或xpub...：版本、深度、父指纹、序号、链码、密钥，再加4字节校验和做Base58编码
+func (k *ExtendedKey) String() string{
+	var buf bytes.Buffer
+	if k.Private{
+		buf.Write(xprvVersion)
+	}else{
+		buf.Write(xpubVersion)
+	}
+	buf.WriteByte(k.Depth)
+	buf.Write(k.ParentFP)
+	binary.Write(&buf,binary.BigEndian,k.Index)
+	buf.Write(k.ChainCode)
+	if k.Private{
+		buf.WriteByte(0)
+	}
+	buf.Write(k.Key)
+	buf.Write(CheckSum(buf.Bytes()))
+	return string(Base58Encode(buf.Bytes()))
+}
+
+//解析 m/44'/0'/0'/0/5 格式的派生路径，'或h表示强化派生
+func ParseDerivationPath(s string) ([]uint32,error){
+	parts := strings.Split(strings.TrimSpace(s),"/")
+	if len(parts) == 0 || parts[0] != "m"{
+		return nil,fmt.Errorf("%w: path %q must start with m",ErrInvalidKey,s)
+	}
+	var path []uint32
+	for _,part := range parts[1:]{
+		hardened := strings.HasSuffix(part,"'") || strings.HasSuffix(part,"h")
+		if hardened{
+			part = part[:len(part)-1]
+		}
+		index,err := strconv.ParseUint(part,10,32)
+		if err != nil || uint32(index) >= HardenedKeyStart{
+			return nil,fmt.Errorf("%w: bad path element %q in %q",ErrInvalidKey,part,s)
+		}
+		if hardened{
+			index += uint64(HardenedKeyStart)
+		}
+		path = append(path,uint32(index))
+	}
+	return path,nil
+}
+
+//把派生路径格式化成 m/44'/0'/0'/0/5
+func FormatDerivationPath(path []uint32) string{
+	var b strings.Builder
+	b.WriteString("m")
+	for _,index := range path{
+		if index >= HardenedKeyStart{
+			fmt.Fprintf(&b,"/%d'",index-HardenedKeyStart)
+		}else{
+			fmt.Fprintf(&b,"/%d",index)
+		}
+	}
+	return b.String()
+}
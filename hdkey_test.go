@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+//BIP32的测试向量1
+func TestBIP32Vector1(t *testing.T){
+	seed,_ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master,err := NewMasterKey(seed)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	tests := []struct{
+		path,xprv,xpub string
+	}{
+		{"m",
+			"xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			"xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"},
+		{"m/0'",
+			"xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+			"xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"},
+		{"m/0'/1",
+			"xprv9wTYmMFdV23N2TdNG573QoEsfRrWKQgWeibmLntzniatZvR9BmLnvSxqu53Kw1UmYPxLgboyZQaXwTCg8MSY3H2EU4pWcQDnRnrVA1xe8fs",
+			"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"},
+		{"m/0'/1/2'/2/1000000000",
+			"xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76",
+			"xpub6H1LXWLaKsWFhvm6RVpEL9P4KfRZSW7abD2ttkWP3SSQvnyA8FSVqNTEcYFgJS2UaFcxupHiYkro49S8yGasTvXEYBVPamhGW6cFJodrTHy"},
+	}
+	for _,tt := range tests{
+		path,err := ParseDerivationPath(tt.path)
+		if err != nil{
+			t.Fatal(err)
+		}
+		key,err := master.Derive(path)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if got := key.String(); got != tt.xprv{
+			t.Errorf("%s: xprv = %s, want %s",tt.path,got,tt.xprv)
+		}
+		if got := key.Neuter().String(); got != tt.xpub{
+			t.Errorf("%s: xpub = %s, want %s",tt.path,got,tt.xpub)
+		}
+	}
+}
+
+//普通派生可以只用公钥，结果和用私钥派生的子密钥的公钥一样；强化派生不能只用公钥
+func TestPublicChildDerivation(t *testing.T){
+	seed,_ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master,err := NewMasterKey(seed)
+	if err != nil{
+		t.Fatal(err)
+	}
+	priv,err := master.Child(7)
+	if err != nil{
+		t.Fatal(err)
+	}
+	pub,err := master.Neuter().Child(7)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if pub.String() != priv.Neuter().String(){
+		t.Errorf("public derivation = %s, want %s",pub,priv.Neuter())
+	}
+	if _,err := master.Neuter().Child(HardenedKeyStart); !errors.Is(err,ErrInvalidKey){
+		t.Errorf("hardened child of a public key: err = %v, want ErrInvalidKey",err)
+	}
+	if _,err := master.Neuter().ECPrivateKey(); !errors.Is(err,ErrInvalidKey){
+		t.Errorf("ECPrivateKey of a public key: err = %v, want ErrInvalidKey",err)
+	}
+}
+
+func TestNewMasterKeyRejectsSeedLength(t *testing.T){
+	for _,n := range []int{0,15,65}{
+		if _,err := NewMasterKey(make([]byte,n)); !errors.Is(err,ErrInvalidKey){
+			t.Errorf("%d byte seed: err = %v, want ErrInvalidKey",n,err)
+		}
+	}
+}
+
+func TestDerivationPath(t *testing.T){
+	path,err := ParseDerivationPath("m/44'/0h/0'/1/5")
+	if err != nil{
+		t.Fatal(err)
+	}
+	want := []uint32{44 + HardenedKeyStart,HardenedKeyStart,HardenedKeyStart,1,5}
+	if len(path) != len(want){
+		t.Fatalf("path = %v, want %v",path,want)
+	}
+	for i := range want{
+		if path[i] != want[i]{
+			t.Errorf("path[%d] = %d, want %d",i,path[i],want[i])
+		}
+	}
+	if got := FormatDerivationPath(path); got != "m/44'/0'/0'/1/5"{
+		t.Errorf("FormatDerivationPath = %s",got)
+	}
+	if got := FormatDerivationPath(nil); got != "m"{
+		t.Errorf("FormatDerivationPath(nil) = %s, want m",got)
+	}
+
+	for _,s := range []string{"","44'/0'","m/x","m/-1","m/2147483648","m//1","m/1''"}{
+		if _,err := ParseDerivationPath(s); !errors.Is(err,ErrInvalidKey){
+			t.Errorf("ParseDerivationPath(%q): err = %v, want ErrInvalidKey",s,err)
+		}
+	}
+}
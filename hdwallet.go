@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+//HD钱包：secp256k1的地址都由一个BIP39助记词派生，备份一次助记词就能恢复全部地址。
+//派生路径是 m/44'/0'/0'/链/序号，链0是收款地址，链1是找零地址。
+//早期的钱包文件没有HDChain，里面的地址都是随机生成的，照常使用
+type HDChain struct{
+	Seed          []byte //BIP39种子，钱包集加密后为nil
+	EncryptedSeed []byte //钱包集加密后，用主密钥加密的种子
+	NextReceive   uint32 //下一个收款地址的序号
+	NextChange    uint32 //下一个找零地址的序号
+	GapLimit      int    //恢复时连续这么多个地址都没用过就停止查找
+
+	seed      []byte                  //加密的钱包集解锁后解密出来的种子，不写入文件
+	chainKeys map[uint32]*ExtendedKey //派生过的收款链、找零链的扩展密钥，不用每次从种子开始派生
+}
+
+const (
+	HDReceiveChain  uint32 = 0
+	HDChangeChain   uint32 = 1
+	DefaultGapLimit        = 20
+
+	hdMnemonicBits = 128 //新建钱包的助记词是12个单词
+)
+
+//账户的派生路径 m/44'/0'/0'
+var hdAccountPath = []uint32{44 + HardenedKeyStart,HardenedKeyStart,HardenedKeyStart}
+
+//加密种子时的认证数据
+var hdSeedAAD = []byte("hdseed")
+
+//第chain条链上第index个地址的派生路径
+func hdKeyPath(chain,index uint32) []uint32{
+	path := append([]uint32{},hdAccountPath...)
+	return append(path,chain,index)
+}
+
+//由助记词建立HD钱包集，还没有任何地址
+func newHDWallets(mnemonic,passphrase string,gapLimit int) (*Wallets,error){
+	seed,err := MnemonicToSeed(mnemonic,passphrase)
+	if err != nil{
+		return nil,err
+	}
+	if gapLimit <= 0{
+		return nil,fmt.Errorf("gap limit must be positive")
+	}
+	ws := &Wallets{Store: make(map[string]*Wallet)}
+	ws.HDChain = &HDChain{Seed: seed,GapLimit: gapLimit}
+	return ws,nil
+}
+
+//新建HD钱包集：生成12个单词的助记词、第一个收款地址和密钥池，返回助记词，调用方要提醒用户抄下来
+func NewHDWallets() (*Wallets,string,error){
+	mnemonic,err := NewMnemonic(hdMnemonicBits)
+	if err != nil{
+		return nil,"",err
+	}
+	ws,err := newHDWallets(mnemonic,"",DefaultGapLimit)
+	if err != nil{
+		return nil,"",err
+	}
+	_,err = ws.NewHDAddress(HDReceiveChain)
+	if err != nil{
+		return nil,"",err
+	}
+	err = ws.TopUpKeyPool()
+	if err != nil{
+		return nil,"",err
+	}
+	return ws,mnemonic,nil
+}
+
+//派生用的种子，加密的钱包集锁定时返回ErrWalletLocked
+func (hd *HDChain) masterSeed() ([]byte,error){
+	if hd.Seed != nil{
+		return hd.Seed,nil
+	}
+	if hd.seed != nil{
+		return hd.seed,nil
+	}
+	return nil,ErrWalletLocked
+}
+
+//第chain条链 m/44'/0'/0'/chain 的扩展私钥
+func (hd *HDChain) chainKey(chain uint32) (*ExtendedKey,error){
+	if key,ok := hd.chainKeys[chain]; ok{
+		return key,nil
+	}
+	seed,err := hd.masterSeed()
+	if err != nil{
+		return nil,err
+	}
+	master,err := NewMasterKey(seed)
+	if err != nil{
+		return nil,err
+	}
+	key,err := master.Derive(append(append([]uint32{},hdAccountPath...),chain))
+	if err != nil{
+		return nil,err
+	}
+	if hd.chainKeys == nil{
+		hd.chainKeys = make(map[uint32]*ExtendedKey)
+	}
+	hd.chainKeys[chain] = key
+	return key,nil
+}
+
+//派生第chain条链上第index个地址的钱包
+func (hd *HDChain) deriveWallet(chain,index uint32) (*Wallet,error){
+	parent,err := hd.chainKey(chain)
+	if err != nil{
+		return nil,err
+	}
+	key,err := parent.Child(index)
+	if err != nil{
+		return nil,err
+	}
+	private,err := key.ECPrivateKey()
+	if err != nil{
+		return nil,err
+	}
+	pubkey := MarshalPubKey(&private.PublicKey,true)
+	return &Wallet{PrivateKey: *private,PublicKey: pubkey,hdPath: hdKeyPath(chain,index)},nil
+}
+
+//在第chain条链上派生下一个地址加入钱包集，chain是HDReceiveChain或HDChangeChain
+func (ws *Wallets) NewHDAddress(chain uint32) (string,error){
+	hd := ws.HDChain
+	if hd == nil{
+		return "",fmt.Errorf("wallet has no HD seed")
+	}
+	next := &hd.NextReceive
+	if chain == HDChangeChain{
+		next = &hd.NextChange
+	}
+	for{
+		wallet,err := hd.deriveWallet(chain,*next)
+		//派生出无效的私钥概率极低，按BIP32跳过这个序号
+		if errors.Is(err,ErrInvalidKey){
+			*next++
+			continue
+		}
+		if err != nil{
+			return "",err
+		}
+		err = ws.protectNewWallet(wallet)
+		if err != nil{
+			return "",err
+		}
+		*next++
+		address := fmt.Sprintf("%s",wallet.GetAddress())
+		ws.Store[address] = wallet
+		return address,nil
+	}
+}
+
+//钱包集加密时用主密钥加密种子，明文种子不再写入文件
+func (hd *HDChain) encryptSeed(masterKey []byte) error{
+	sealed,err := sealAESGCM(masterKey,hd.Seed,hdSeedAAD)
+	if err != nil{
+		return err
+	}
+	hd.EncryptedSeed = sealed
+	hd.seed = hd.Seed
+	hd.Seed = nil
+	return nil
+}
+
+//解锁时解密种子
+func (hd *HDChain) decryptSeed(masterKey []byte) error{
+	if hd.EncryptedSeed == nil{
+		return nil
+	}
+	seed,err := openAESGCM(masterKey,hd.EncryptedSeed,hdSeedAAD)
+	if err != nil{
+		return fmt.Errorf("%w: cannot decrypt HD seed: %v",ErrWalletFile,err)
+	}
+	hd.seed = seed
+	return nil
+}
+
+//锁定时清除内存中的种子和派生出的私钥
+func (hd *HDChain) lock(){
+	for i := range hd.seed{
+		hd.seed[i] = 0
+	}
+	hd.seed = nil
+	hd.chainKeys = nil
+}
+
+//用助记词恢复钱包集：收款链和找零链都从0开始派生，连续gapLimit个地址在used中都没出现过就停止，
+//用过的地址以及它们之前的地址都加入钱包集。一个都没用过时保留第一个收款地址。
+//used是链上出现过的公钥hash，见BlockChain.usedPubKeyHashes
+func RestoreHDWallets(mnemonic,passphrase string,gapLimit int,used map[string]bool) (*Wallets,error){
+	ws,err := newHDWallets(mnemonic,passphrase,gapLimit)
+	if err != nil{
+		return nil,err
+	}
+	for _,chain := range []uint32{HDReceiveChain,HDChangeChain}{
+		var found []*Wallet
+		lastUsed := -1
+		for index,unused := uint32(0),0; unused < gapLimit; index++{
+			wallet,err := ws.HDChain.deriveWallet(chain,index)
+			if errors.Is(err,ErrInvalidKey){
+				continue
+			}
+			if err != nil{
+				return nil,err
+			}
+			found = append(found,wallet)
+			if used[string(HashPubKey(wallet.PublicKey))]{
+				lastUsed = len(found) - 1
+				unused = 0
+			}else{
+				unused++
+			}
+		}
+		if lastUsed < 0{
+			continue
+		}
+		for _,wallet := range found[:lastUsed+1]{
+			ws.Store[fmt.Sprintf("%s",wallet.GetAddress())] = wallet
+		}
+		next := found[lastUsed].hdPath[len(hdAccountPath)+1] + 1
+		if chain == HDChangeChain{
+			ws.HDChain.NextChange = next
+		}else{
+			ws.HDChain.NextReceive = next
+		}
+	}
+	if ws.HDChain.NextReceive == 0{
+		_,err = ws.NewHDAddress(HDReceiveChain)
+		if err != nil{
+			return nil,err
+		}
+	}
+	err = ws.TopUpKeyPool()
+	if err != nil{
+		return nil,err
+	}
+	return ws,nil
+}
+
+//区块链上出现过的全部公钥hash：输出的收款人和输入的签名人，恢复钱包时用来判断地址是否用过
+func (bc *BlockChain) usedPubKeyHashes() (map[string]bool,error){
+	used := make(map[string]bool)
+	bci := bc.iterator()
+	for{
+		block,err := bci.Next()
+		if err != nil{
+			return nil,err
+		}
+		for _,tx := range block.Transations{
+			for _,out := range tx.Vout{
+				used[string(out.PubkeyHash)] = true
+			}
+			if tx.isCoinBase(){
+				continue
+			}
+			for _,in := range tx.Vin{
+				used[string(HashPubKey(in.Pubkey))] = true
+			}
+		}
+
+		//PrevBlockHash长度==0表示这是创世区块，遍历结束
+		if len(block.PrevBlockHash) == 0{
+			break
+		}
+	}
+	return used,nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+const hdTestMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+//测试助记词派生出的第chain条链上第index个地址，和它的公钥hash
+func hdTestAddress(t *testing.T,chain,index uint32) (string,string){
+	t.Helper()
+	ws,err := newHDWallets(hdTestMnemonic,"",DefaultGapLimit)
+	if err != nil{
+		t.Fatal(err)
+	}
+	wallet,err := ws.HDChain.deriveWallet(chain,index)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s",wallet.GetAddress()),string(HashPubKey(wallet.PublicKey))
+}
+
+//m/44'/0'/0'/0/0 的地址和其他BIP44钱包一致
+func TestHDAddressKnownAnswer(t *testing.T){
+	address,_ := hdTestAddress(t,HDReceiveChain,0)
+	if address != "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"{
+		t.Errorf("m/44'/0'/0'/0/0 = %s, want 1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA",address)
+	}
+}
+
+//恢复时找回用过的地址和它们之前的地址，超过gap limit的地址找不回来，口令不同恢复出别的地址
+func TestRestoreHDWallets(t *testing.T){
+	var receive,change []string
+	for i := uint32(0); i < 4; i++{
+		address,_ := hdTestAddress(t,HDReceiveChain,i)
+		receive = append(receive,address)
+	}
+	for i := uint32(0); i < 2; i++{
+		address,_ := hdTestAddress(t,HDChangeChain,i)
+		change = append(change,address)
+	}
+	_,usedReceive := hdTestAddress(t,HDReceiveChain,3)
+	_,usedChange := hdTestAddress(t,HDChangeChain,1)
+	used := map[string]bool{usedReceive: true,usedChange: true}
+
+	listed := func(ws *Wallets) []string{
+		addresses := ws.GetAllAddress()
+		sort.Strings(addresses)
+		return addresses
+	}
+
+	ws,err := RestoreHDWallets(hdTestMnemonic,"",DefaultGapLimit,used)
+	if err != nil{
+		t.Fatal(err)
+	}
+	//恢复时不知道找零地址属于哪个账户，找零地址和收款地址一样列出
+	want := append(append([]string{},receive...),change...)
+	sort.Strings(want)
+	if got := listed(ws); fmt.Sprint(got) != fmt.Sprint(want){
+		t.Errorf("restored addresses = %v, want %v",got,want)
+	}
+
+	//间隔比gap limit大的地址找不回来，只保留第一个收款地址
+	ws,err = RestoreHDWallets(hdTestMnemonic,"",2,map[string]bool{usedReceive: true})
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got := listed(ws); len(got) != 1 || got[0] != receive[0]{
+		t.Errorf("gap limit 2: addresses = %v, want only %s",got,receive[0])
+	}
+
+	ws,err = RestoreHDWallets(hdTestMnemonic,"other",DefaultGapLimit,used)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got := listed(ws); len(got) != 1 || ws.Store[receive[0]] != nil{
+		t.Errorf("different passphrase restored %v",got)
+	}
+}
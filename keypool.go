@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+//密钥池：预先生成一批收款地址和找零地址放进钱包文件，之后备份的钱包文件已经包含了将来要用的私钥，
+//钱包锁定时也还能从池中取地址。HD钱包从收款链和找零链派生，早期的钱包随机生成secp256k1私钥。
+//找零地址记录它属于哪个发送地址（账户），转账时账户的找零也可以花，余额也算在账户上
+const DefaultKeyPoolSize = 100
+
+//密钥池的大小
+func (ws *Wallets) keyPoolSize() int{
+	if ws.KeyPoolSize > 0{
+		return ws.KeyPoolSize
+	}
+	return DefaultKeyPoolSize
+}
+
+//生成一个新地址放入钱包集
+func (ws *Wallets) generateKey(change bool) (string,error){
+	if ws.HDChain == nil{
+		return ws.newRandomAddress(DefaultCurve)
+	}
+	if change{
+		return ws.NewHDAddress(HDChangeChain)
+	}
+	return ws.NewHDAddress(HDReceiveChain)
+}
+
+//把收款和找零的密钥池补满。加密的钱包集锁定时返回ErrWalletLocked
+func (ws *Wallets) TopUpKeyPool() error{
+	for len(ws.KeyPool) < ws.keyPoolSize(){
+		address,err := ws.generateKey(false)
+		if err != nil{
+			return err
+		}
+		ws.KeyPool = append(ws.KeyPool,address)
+	}
+	for len(ws.ChangePool) < ws.keyPoolSize(){
+		address,err := ws.generateKey(true)
+		if err != nil{
+			return err
+		}
+		ws.ChangePool = append(ws.ChangePool,address)
+	}
+	return nil
+}
+
+//从池中取出最早生成的地址，再把池补满。池空了又不能生成新地址时返回ErrWalletLocked
+func (ws *Wallets) takeFromPool(pool *[]string,change bool) (string,error){
+	if len(*pool) == 0{
+		address,err := ws.generateKey(change)
+		if err != nil{
+			return "",fmt.Errorf("keypool is empty: %w",err)
+		}
+		*pool = append(*pool,address)
+	}
+	address := (*pool)[0]
+	*pool = (*pool)[1:]
+
+	err := ws.TopUpKeyPool()
+	if err != nil && !errors.Is(err,ErrWalletLocked){
+		return "",err
+	}
+	return address,nil
+}
+
+//取一个新的收款地址
+func (ws *Wallets) GetNewAddress() (string,error){
+	return ws.takeFromPool(&ws.KeyPool,false)
+}
+
+//给account的这次转账取一个新的找零地址
+func (ws *Wallets) GetChangeAddress(account string) (string,error){
+	address,err := ws.takeFromPool(&ws.ChangePool,true)
+	if err != nil{
+		return "",err
+	}
+	if owner,ok := ws.Change[account]; ok{
+		account = owner
+	}
+	if ws.Change == nil{
+		ws.Change = make(map[string]string)
+	}
+	ws.Change[address] = account
+	return address,nil
+}
+
+//地址是否还在密钥池中，没有交给用户
+func (ws *Wallets) inKeyPool(address string) bool{
+	for _,pool := range [][]string{ws.KeyPool,ws.ChangePool}{
+		for _,pooled := range pool{
+			if pooled == address{
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//地址是否是钱包生成的找零地址
+func (ws *Wallets) IsChange(address string) bool{
+	_,ok := ws.Change[address]
+	return ok
+}
+
+//账户的全部地址：account本身和转账时给它生成的找零地址
+func (ws *Wallets) AccountAddresses(account string) []string{
+	addresses := []string{account}
+	for address,owner := range ws.Change{
+		if owner == account{
+			addresses = append(addresses,address)
+		}
+	}
+	return addresses
+}
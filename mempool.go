@@ -0,0 +1,595 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"github.com/boltdb/bolt-master"
+	"log"
+	"sort"
+	"time"
+)
+
+//交易池：保存已经验证通过、还没有打包进区块的交易。
+//和UTXO集一样存放在区块链数据库的一个桶中，key是交易ID，value是序列化的MempoolEntry。
+//池中的交易可以花费链上的UTXO，也可以花费池中其他交易的输出；同一个输出只能被池中的一笔交易花费
+type Mempool struct{
+	bchain *BlockChain
+}
+
+const mempoolBucket = "mempool"
+
+//区块模板给coinbase交易留出的重量
+const coinbaseReservedWeight = 4000
+
+//交易池中的一项：交易，以及进入交易池时算好的手续费、大小和时间
+type MempoolEntry struct{
+	Tx   *Transation
+	Fee  Amount //手续费 = 输入总额 - 输出总额
+	Size int    //交易序列化后的字节数
+	Time int64  //进入交易池的时间，Unix秒
+}
+
+//交易池中一笔交易的详细信息，包括它在池中的祖先和后代
+type MempoolEntryInfo struct{
+	MempoolEntry
+	Ancestors      int    //池中的祖先笔数，不包括自己
+	Descendants    int    //池中的后代笔数，不包括自己
+	AncestorFee    Amount //自己和全部祖先的手续费之和，挖矿时按它和AncestorSize的比值排序
+	AncestorSize   int
+	DescendantFee  Amount //自己和全部后代的手续费之和，池满时按它和DescendantSize的比值淘汰
+	DescendantSize int
+}
+
+//交易池的统计信息
+type MempoolInfo struct{
+	Count           int    //交易笔数
+	Bytes           int    //序列化后的总字节数
+	Fees            Amount //手续费总额
+	MaxBytes        int    //总字节数上限
+	MinRelayFeeRate Amount //最低转发费率，每1000字节的手续费
+}
+
+//输出的唯一标识 交易ID:输出序号
+func outpointKey(txid []byte,index int) string{
+	return fmt.Sprintf("%x:%d",txid,index)
+}
+
+//序列化
+func (e *MempoolEntry) Serialize() []byte{
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(e)
+	if err != nil{
+		log.Panic(err)
+	}
+	return buf.Bytes()
+}
+
+//反序列化交易池中的一项
+func DeserializeMempoolEntry(data []byte) (*MempoolEntry,error){
+	var e MempoolEntry
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	if err != nil || e.Tx == nil{
+		return nil,fmt.Errorf("%w: corrupt mempool entry: %v",ErrInvalidTransation,err)
+	}
+	return &e,nil
+}
+
+//读取池中的全部项，key是16进制的交易ID
+func poolEntries(btx *bolt.Tx) (map[string]*MempoolEntry,error){
+	pool := make(map[string]*MempoolEntry)
+	b := btx.Bucket([]byte(mempoolBucket))
+	if b == nil{
+		return pool,nil
+	}
+	err := b.ForEach(func(k,v []byte) error{
+		entry,err := DeserializeMempoolEntry(v)
+		if err != nil{
+			return err
+		}
+		pool[hex.EncodeToString(k)] = entry
+		return nil
+	})
+	return pool,err
+}
+
+//读取池中的全部交易，key是16进制的交易ID
+func poolTransations(btx *bolt.Tx) (map[string]*Transation,error){
+	entries,err := poolEntries(btx)
+	if err != nil{
+		return nil,err
+	}
+	return entryTransations(entries),nil
+}
+
+//只取出交易
+func entryTransations(entries map[string]*MempoolEntry) map[string]*Transation{
+	pool := make(map[string]*Transation)
+	for id,entry := range entries{
+		pool[id] = entry.Tx
+	}
+	return pool
+}
+
+//从池中删除一组交易
+func deleteEntries(btx *bolt.Tx,ids map[string]bool) error{
+	b := btx.Bucket([]byte(mempoolBucket))
+	if b == nil{
+		return nil
+	}
+	for id := range ids{
+		key,err := hex.DecodeString(id)
+		if err != nil{
+			return err
+		}
+		err = b.Delete(key)
+		if err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+//池中交易花费的全部输出 --> 花费它的交易ID
+func poolSpent(pool map[string]*Transation) map[string]string{
+	spent := make(map[string]string)
+	for id,tx := range pool{
+		for _,vin := range tx.Vin{
+			spent[outpointKey(vin.TXid,vin.Voutindex)] = id
+		}
+	}
+	return spent
+}
+
+//找出输入引用的输出：先在UTXO集中找，再在池中交易的输出中找
+func findPrevOutput(btx *bolt.Tx,pool map[string]*Transation,vin TXInput) (TXOutput,error){
+	if outsbytes := btx.Bucket([]byte(utxoBucket)).Get(vin.TXid); outsbytes != nil{
+		outs,err := Deserialize(outsbytes)
+		if err != nil{
+			return TXOutput{},err
+		}
+		if out,ok := outs.Outputs[vin.Voutindex]; ok{
+			return out,nil
+		}
+	}
+	if parent,ok := pool[hex.EncodeToString(vin.TXid)]; ok{
+		if vin.Voutindex >= 0 && vin.Voutindex < len(parent.Vout){
+			return parent.Vout[vin.Voutindex],nil
+		}
+	}
+	return TXOutput{},fmt.Errorf("%w: %s",ErrOutputSpent,outpointKey(vin.TXid,vin.Voutindex))
+}
+
+//检查交易能否进入交易池，返回每个输入引用的输出，以及和它花费同一个输出的池中交易（冲突交易）
+func checkPoolInputs(btx *bolt.Tx,pool map[string]*Transation,tx *Transation) ([]TXOutput,map[string]bool,error){
+	id := hex.EncodeToString(tx.ID)
+	if _,ok := pool[id]; ok{
+		return nil,nil,fmt.Errorf("%w: %s",ErrTxInMempool,id)
+	}
+	if confirmed := btx.Bucket([]byte(utxoBucket)).Get(tx.ID); confirmed != nil{
+		return nil,nil,fmt.Errorf("%w: %s is already confirmed",ErrTxInMempool,id)
+	}
+
+	spent := poolSpent(pool)
+	seen := make(map[string]bool)
+	conflicts := make(map[string]bool)
+	var prevOuts []TXOutput
+	for _,vin := range tx.Vin{
+		key := outpointKey(vin.TXid,vin.Voutindex)
+		if seen[key]{
+			return nil,nil,fmt.Errorf("%w: output %s is spent twice",ErrInvalidTransation,key)
+		}
+		seen[key] = true
+		if other,ok := spent[key]; ok{
+			conflicts[other] = true
+		}
+		out,err := findPrevOutput(btx,pool,vin)
+		if err != nil{
+			return nil,nil,err
+		}
+		prevOuts = append(prevOuts,out)
+	}
+	return prevOuts,conflicts,nil
+}
+
+//验证交易并按mempoolPolicy加入交易池。
+//已经在池中返回ErrTxInMempool，和池中交易花费同一个输出时按替换规则处理（见checkReplacement），
+//冲突的交易不允许替换返回ErrNotReplaceable，替换不满足规则返回ErrMempoolConflict或ErrFeeTooLow，
+//引用的输出不存在或已花费返回ErrOutputSpent，交易ID和内容不符、签名或金额错误返回ErrInvalidTransation，
+//交易太大返回ErrNonStandard，手续费低于最低转发费率返回ErrFeeTooLow，未确认的交易链太长返回ErrMempoolChain，
+//池满了且这笔交易的费率最低返回ErrMempoolFull
+func (m Mempool) Add(tx *Transation) error{
+	policy := mempoolPolicy
+	if tx.isCoinBase(){
+		return fmt.Errorf("%w: coinbase transation cannot be relayed",ErrInvalidTransation)
+	}
+	err := tx.checkID()
+	if err != nil{
+		return err
+	}
+	err = checkStandard(tx,policy)
+	if err != nil{
+		return err
+	}
+	db := m.bchain.db
+
+	//先在只读事务中找出引用的输出，签名验证比较慢，放在事务外面做。
+	//冲突的交易不允许替换时不用验证签名，直接拒绝
+	var prevOuts []TXOutput
+	err = db.View(func(btx *bolt.Tx) error{
+		pool,err := poolTransations(btx)
+		if err != nil{
+			return err
+		}
+		var conflicts map[string]bool
+		prevOuts,conflicts,err = checkPoolInputs(btx,pool,tx)
+		if err != nil{
+			return err
+		}
+		for other := range conflicts{
+			if !pool[other].signalsReplaceable(){
+				return fmt.Errorf("%w: conflicts with %s",ErrNotReplaceable,other)
+			}
+		}
+		return nil
+	})
+	if err != nil{
+		return err
+	}
+
+	fee,err := checkTransationAmounts(tx,prevOuts)
+	if err != nil{
+		return err
+	}
+	size := tx.Size()
+	if minFee := feeForSize(policy.MinRelayFeeRate,size); fee < minFee{
+		return fmt.Errorf("%w: fee %s for %d bytes, minimum is %s",ErrFeeTooLow,fee,size,minFee)
+	}
+
+	var checks []sigCheck
+	for inID,prevOut := range prevOuts{
+		checks = append(checks,sigCheck{tx,inID,prevOut})
+	}
+	err = verifySigChecks(checks,verifyWorkers)
+	if err != nil{
+		return err
+	}
+
+	//写入时重新检查一次冲突，验证期间可能有别的交易进了池
+	entry := &MempoolEntry{tx,fee,size,time.Now().Unix()}
+	id := hex.EncodeToString(tx.ID)
+	return db.Update(func(btx *bolt.Tx) error{
+		b,err := btx.CreateBucketIfNotExists([]byte(mempoolBucket))
+		if err != nil{
+			return err
+		}
+		entries,err := poolEntries(btx)
+		if err != nil{
+			return err
+		}
+
+		//先删除过期的交易，它们花费的输出又可以用了
+		expired := expiredEntries(entries,time.Now(),policy)
+		err = deleteEntries(btx,expired)
+		if err != nil{
+			return err
+		}
+		for expiredID := range expired{
+			delete(entries,expiredID)
+		}
+
+		_,conflicts,err := checkPoolInputs(btx,entryTransations(entries),tx)
+		if err != nil{
+			return err
+		}
+		if len(conflicts) > 0{
+			replaced,err := checkReplacement(entries,conflicts,entry,policy)
+			if err != nil{
+				return err
+			}
+			err = deleteEntries(btx,replaced)
+			if err != nil{
+				return err
+			}
+			for replacedID := range replaced{
+				delete(entries,replacedID)
+			}
+		}
+		entries[id] = entry
+		err = checkChainLimits(entries,id,policy)
+		if err != nil{
+			return err
+		}
+
+		//超过总大小上限时淘汰费率最低的交易包，新交易自己被淘汰说明它的费率不够，整个事务回滚
+		evicted := evictionCandidates(entries,policy)
+		if evicted[id]{
+			return fmt.Errorf("%w: fee rate %.2f is too low to replace pooled transations",ErrMempoolFull,feeRate(fee,size))
+		}
+		err = deleteEntries(btx,evicted)
+		if err != nil{
+			return err
+		}
+		return b.Put(tx.ID,entry.Serialize())
+	})
+}
+
+//从池中取出指定ID的交易，不在池中返回ErrTxNotFound
+func (m Mempool) Get(txid []byte) (*Transation,error){
+	var tx *Transation
+	err := m.bchain.db.View(func(btx *bolt.Tx) error{
+		b := btx.Bucket([]byte(mempoolBucket))
+		if b == nil{
+			return fmt.Errorf("%w: %x",ErrTxNotFound,txid)
+		}
+		data := b.Get(txid)
+		if data == nil{
+			return fmt.Errorf("%w: %x",ErrTxNotFound,txid)
+		}
+		entry,err := DeserializeMempoolEntry(data)
+		if err != nil{
+			return err
+		}
+		tx = entry.Tx
+		return nil
+	})
+	return tx,err
+}
+
+//读取池中的全部项
+func (m Mempool) snapshot() (map[string]*MempoolEntry,error){
+	var entries map[string]*MempoolEntry
+	err := m.bchain.db.View(func(btx *bolt.Tx) error{
+		var err error
+		entries,err = poolEntries(btx)
+		return err
+	})
+	return entries,err
+}
+
+//返回池中每笔交易的详细信息，按依赖顺序排列
+func (m Mempool) Entries() ([]MempoolEntryInfo,error){
+	entries,err := m.snapshot()
+	if err != nil{
+		return nil,err
+	}
+
+	var infos []MempoolEntryInfo
+	for _,tx := range sortByDependency(entryTransations(entries)){
+		id := hex.EncodeToString(tx.ID)
+		ancestors := poolAncestors(entries,id)
+		descendants := poolDescendants(entries,id)
+		info := MempoolEntryInfo{MempoolEntry: *entries[id],Ancestors: len(ancestors),Descendants: len(descendants)}
+		ancestors[id] = true
+		descendants[id] = true
+		info.AncestorFee,info.AncestorSize = packageFeeSize(entries,ancestors)
+		info.DescendantFee,info.DescendantSize = packageFeeSize(entries,descendants)
+		infos = append(infos,info)
+	}
+	return infos,nil
+}
+
+//挖矿用的交易：按祖先包费率从高到低选，总重量不超过maxWeight（<=0表示按共识上限），返回交易和手续费总额
+func (m Mempool) BlockTemplate(maxWeight int) ([]*Transation,Amount,error){
+	entries,err := m.snapshot()
+	if err != nil{
+		return nil,0,err
+	}
+	//给区块头和coinbase交易留出位置，保证挖出的区块不超过共识的重量上限
+	limit := chainParams.MaxBlockWeight - blockHeaderSize*chainParams.WitnessScaleFactor - coinbaseReservedWeight
+	if maxWeight <= 0 || maxWeight > limit{
+		maxWeight = limit
+	}
+	if maxWeight <= 0{
+		return nil,0,nil
+	}
+	txs,fees := selectByPackageFeeRate(entries,maxWeight)
+	return txs,fees,nil
+}
+
+//按依赖关系排序，没有依赖关系的交易按ID排序，保证每次结果一样
+func sortByDependency(pool map[string]*Transation) []*Transation{
+	var ids []string
+	for id := range pool{
+		ids = append(ids,id)
+	}
+	sort.Strings(ids)
+
+	var sorted []*Transation
+	done := make(map[string]bool)
+	var visit func(id string)
+	visit = func(id string){
+		if done[id]{
+			return
+		}
+		done[id] = true
+		for _,vin := range pool[id].Vin{
+			parent := hex.EncodeToString(vin.TXid)
+			if _,ok := pool[parent]; ok{
+				visit(parent)
+			}
+		}
+		sorted = append(sorted,pool[id])
+	}
+	for _,id := range ids{
+		visit(id)
+	}
+	return sorted
+}
+
+//交易池的统计信息
+func (m Mempool) Info() (MempoolInfo,error){
+	info := MempoolInfo{MaxBytes: mempoolPolicy.MaxBytes,MinRelayFeeRate: mempoolPolicy.MinRelayFeeRate}
+	err := m.bchain.db.View(func(btx *bolt.Tx) error{
+		entries,err := poolEntries(btx)
+		if err != nil{
+			return err
+		}
+		for _,entry := range entries{
+			info.Count++
+			info.Bytes += entry.Size
+			info.Fees += entry.Fee
+		}
+		return nil
+	})
+	return info,err
+}
+
+//新区块上链后清理交易池：删除区块中的交易，以及和区块中的交易花费同一个输出的交易和它们的后代，
+//顺便删除过期的交易
+func (m Mempool) removeForBlock(block *Block) error{
+	return m.bchain.db.Update(func(btx *bolt.Tx) error{
+		entries,err := poolEntries(btx)
+		if err != nil{
+			return err
+		}
+		pool := entryTransations(entries)
+
+		removed := make(map[string]bool)
+		blockSpent := make(map[string]bool)
+		for _,tx := range block.Transations{
+			removed[hex.EncodeToString(tx.ID)] = true
+			if !tx.isCoinBase(){
+				for _,vin := range tx.Vin{
+					blockSpent[outpointKey(vin.TXid,vin.Voutindex)] = true
+				}
+			}
+		}
+
+		//冲突的交易已经不可能上链了，花费它们输出的交易也要一起删除，反复检查直到没有新的删除
+		for changed := true; changed;{
+			changed = false
+			for id,tx := range pool{
+				if removed[id]{
+					continue
+				}
+				for _,vin := range tx.Vin{
+					parent := hex.EncodeToString(vin.TXid)
+					_,inPool := pool[parent]
+					if blockSpent[outpointKey(vin.TXid,vin.Voutindex)] || (inPool && removed[parent] && !blockContains(block,vin.TXid)){
+						removed[id] = true
+						changed = true
+						break
+					}
+				}
+			}
+		}
+
+		for id := range expiredEntries(entries,time.Now(),mempoolPolicy){
+			removed[id] = true
+		}
+		return deleteEntries(btx,removed)
+	})
+}
+
+//区块中是否包含指定ID的交易
+func blockContains(block *Block,txid []byte) bool{
+	for _,tx := range block.Transations{
+		if string(tx.ID) == string(txid){
+			return true
+		}
+	}
+	return false
+}
+
+//指定公钥hash还没有确认的余额变化：池中付给它的输出，减去池中交易花掉的它的输出
+func (m Mempool) UnconfirmedBalance(pubkeyhash []byte) (Amount,error){
+	var balance Amount
+	err := m.bchain.db.View(func(btx *bolt.Tx) error{
+		pool,err := poolTransations(btx)
+		if err != nil{
+			return err
+		}
+		for _,tx := range pool{
+			for _,out := range tx.Vout{
+				if out.CanBeUnlockedWith(pubkeyhash){
+					balance += out.Value
+				}
+			}
+			for _,vin := range tx.Vin{
+				out,err := findPrevOutput(btx,pool,vin)
+				if err != nil{
+					continue
+				}
+				if out.CanBeUnlockedWith(pubkeyhash){
+					balance -= out.Value
+				}
+			}
+		}
+		return nil
+	})
+	return balance,err
+}
+
+//指定公钥hash可以花费的输出：链上没有被池中交易花掉的UTXO，加上池中付给它且还没有被花掉的输出。
+//这样连续转账时可以花费还没有确认的找零
+func (m Mempool) FindSpendableUTXOs(pubkeyhash []byte) ([]UTXO,error){
+	set := UTXOSet{m.bchain}
+	confirmed,err := set.FindSpendableUTXOs(pubkeyhash)
+	if err != nil{
+		return nil,err
+	}
+
+	var UTXOs []UTXO
+	err = m.bchain.db.View(func(btx *bolt.Tx) error{
+		pool,err := poolTransations(btx)
+		if err != nil{
+			return err
+		}
+		spent := poolSpent(pool)
+		for _,utxo := range confirmed{
+			if _,ok := spent[outpointKey(utxo.TXid,utxo.Voutindex)]; !ok{
+				UTXOs = append(UTXOs,utxo)
+			}
+		}
+		for _,tx := range sortByDependency(pool){
+			for outIdx,out := range tx.Vout{
+				if !out.CanBeUnlockedWith(pubkeyhash){
+					continue
+				}
+				if _,ok := spent[outpointKey(tx.ID,outIdx)]; !ok{
+					UTXOs = append(UTXOs,UTXO{tx.ID,outIdx,out})
+				}
+			}
+		}
+		return nil
+	})
+	return UTXOs,err
+}
+
+//找出交易每个输入引用的输出，可以是链上的UTXO，也可以是池中交易的输出，和Vin一一对应
+func (m Mempool) FindPrevOutputs(tx *Transation) ([]TXOutput,error){
+	var prevOuts []TXOutput
+	err := m.bchain.db.View(func(btx *bolt.Tx) error{
+		pool,err := poolTransations(btx)
+		if err != nil{
+			return err
+		}
+		for _,vin := range tx.Vin{
+			out,err := findPrevOutput(btx,pool,vin)
+			if err != nil{
+				return err
+			}
+			prevOuts = append(prevOuts,out)
+		}
+		return nil
+	})
+	return prevOuts,err
+}
+
+//用池中的交易挖一个新区块，按祖先包费率选交易，coinbase的奖励加上手续费给minerAddress，
+//区块中的交易从池中删除
+func (m Mempool) MineBlock(minerAddress string) (*Block,error){
+	txs,fees,err := m.BlockTemplate(mempoolPolicy.BlockMaxWeight)
+	if err != nil{
+		return nil,err
+	}
+	coinbase,err := NewCoinbaseTX(minerAddress,"",fees)
+	if err != nil{
+		return nil,err
+	}
+	txs = append([]*Transation{coinbase},txs...)
+
+	return m.bchain.MineBlock(txs)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+//交易池策略：总大小上限、交易过期时间、最低转发费率、单笔交易的标准大小，以及未确认交易链的长度限制。
+//费率统一按 每1000字节的手续费 计算
+type MempoolPolicy struct{
+	MaxBytes        int           //池中交易序列化后的总字节数上限，超出时淘汰费率最低的交易包
+	Expiry          time.Duration //交易在池中超过这么久还没上链就删除，0表示不过期
+	MinRelayFeeRate Amount        //最低转发费率，低于它的交易不进入交易池
+	MaxAncestors    int           //一笔交易在池中的祖先（包括自己）最多这么多笔
+	MaxDescendants  int           //一笔交易在池中的后代（包括自己）最多这么多笔
+	MaxTxWeight     int           //单笔交易的最大重量，更大的交易不转发，见Transation.Weight
+	BlockMaxWeight  int           //挖矿时区块模板中交易的总重量上限，不会超过共识参数允许的值
+}
+
+//默认的交易池策略
+func DefaultMempoolPolicy() MempoolPolicy{
+	return MempoolPolicy{
+		MaxBytes:        5000000,
+		Expiry:          14 * 24 * time.Hour,
+		MinRelayFeeRate: 1000,
+		MaxAncestors:    25,
+		MaxDescendants:  25,
+		MaxTxWeight:     400000,
+		BlockMaxWeight:  3996000,
+	}
+}
+
+//本进程使用的交易池策略，startNode的命令行参数可以修改
+var mempoolPolicy = DefaultMempoolPolicy()
+
+//检查交易是否符合转发标准，这不是共识规则，区块中的交易只要求不超过区块的重量上限。
+//不符合时返回ErrNonStandard
+func checkStandard(tx *Transation,policy MempoolPolicy) error{
+	if weight := tx.Weight(); policy.MaxTxWeight > 0 && weight > policy.MaxTxWeight{
+		return fmt.Errorf("%w: weight %d exceeds %d",ErrNonStandard,weight,policy.MaxTxWeight)
+	}
+	return nil
+}
+
+//按费率计算size字节的交易至少要付的手续费，不足一个最小单位的部分向上取整。
+//结果超过MaxMoney时返回MaxMoney+1，这样的手续费不可能付得起
+func feeForSize(feeRate Amount,size int) Amount{
+	if feeRate <= 0 || size <= 0{
+		return 0
+	}
+	hi,lo := bits.Mul64(uint64(feeRate),uint64(size))
+	lo,carry := bits.Add64(lo,999,0)
+	hi += carry
+	if hi >= 1000{
+		return MaxMoney + 1
+	}
+	fee,_ := bits.Div64(hi,lo,1000)
+	if fee > uint64(MaxMoney){
+		return MaxMoney + 1
+	}
+	return Amount(fee)
+}
+
+//比较 fee1/size1 和 fee2/size2 两个费率，交叉相乘避免除法误差，乘积用128位防止溢出。
+//前者高返回1，相等返回0，低返回-1。手续费不会是负数
+func compareFeeRate(fee1 Amount,size1 int,fee2 Amount,size2 int) int{
+	hi1,lo1 := bits.Mul64(uint64(fee1),uint64(size2))
+	hi2,lo2 := bits.Mul64(uint64(fee2),uint64(size1))
+	switch{
+	case hi1 > hi2 || hi1 == hi2 && lo1 > lo2:
+		return 1
+	case hi1 < hi2 || hi1 == hi2 && lo1 < lo2:
+		return -1
+	}
+	return 0
+}
+
+//显示用的费率，每1000字节的手续费
+func feeRate(fee Amount,size int) float64{
+	if size == 0{
+		return 0
+	}
+	return float64(fee) * 1000 / float64(size)
+}
+
+//交易在池中的全部祖先，即它直接或间接花费了哪些池中交易的输出，不包括自己
+func poolAncestors(pool map[string]*MempoolEntry,id string) map[string]bool{
+	ancestors := make(map[string]bool)
+	var visit func(id string)
+	visit = func(id string){
+		for _,vin := range pool[id].Tx.Vin{
+			parent := hex.EncodeToString(vin.TXid)
+			if _,ok := pool[parent]; ok && !ancestors[parent]{
+				ancestors[parent] = true
+				visit(parent)
+			}
+		}
+	}
+	visit(id)
+	return ancestors
+}
+
+//交易在池中的全部后代，即池中直接或间接花费了它的输出的交易，不包括自己
+func poolDescendants(pool map[string]*MempoolEntry,id string) map[string]bool{
+	children := make(map[string][]string)
+	for childID,entry := range pool{
+		for _,vin := range entry.Tx.Vin{
+			parent := hex.EncodeToString(vin.TXid)
+			if _,ok := pool[parent]; ok{
+				children[parent] = append(children[parent],childID)
+			}
+		}
+	}
+
+	descendants := make(map[string]bool)
+	var visit func(id string)
+	visit = func(id string){
+		for _,child := range children[id]{
+			if !descendants[child]{
+				descendants[child] = true
+				visit(child)
+			}
+		}
+	}
+	visit(id)
+	return descendants
+}
+
+//一组交易的手续费和大小之和
+func packageFeeSize(pool map[string]*MempoolEntry,ids map[string]bool) (Amount,int){
+	var fee Amount
+	size := 0
+	for id := range ids{
+		fee += pool[id].Fee
+		size += pool[id].Size
+	}
+	return fee,size
+}
+
+//检查新交易加入后，它和它的祖先在池中的交易链是否超过长度限制
+func checkChainLimits(pool map[string]*MempoolEntry,id string,policy MempoolPolicy) error{
+	ancestors := poolAncestors(pool,id)
+	if policy.MaxAncestors > 0 && len(ancestors)+1 > policy.MaxAncestors{
+		return fmt.Errorf("%w: %d unconfirmed ancestors, limit is %d",ErrMempoolChain,len(ancestors)+1,policy.MaxAncestors)
+	}
+	if policy.MaxDescendants > 0{
+		for ancestor := range ancestors{
+			count := len(poolDescendants(pool,ancestor)) + 1
+			if count > policy.MaxDescendants{
+				return fmt.Errorf("%w: ancestor %s would have %d descendants, limit is %d",ErrMempoolChain,ancestor,count,policy.MaxDescendants)
+			}
+		}
+	}
+	return nil
+}
+
+//过期的交易：进入交易池超过policy.Expiry的交易，连同它们的后代
+func expiredEntries(pool map[string]*MempoolEntry,now time.Time,policy MempoolPolicy) map[string]bool{
+	expired := make(map[string]bool)
+	if policy.Expiry <= 0{
+		return expired
+	}
+	deadline := now.Add(-policy.Expiry).Unix()
+	for id,entry := range pool{
+		if entry.Time < deadline && !expired[id]{
+			expired[id] = true
+			for descendant := range poolDescendants(pool,id){
+				expired[descendant] = true
+			}
+		}
+	}
+	return expired
+}
+
+//池的总大小超过上限时要淘汰的交易。每次淘汰 后代包费率（自己和全部后代一起算）最低的交易和它的后代，
+//这样低费率的父交易有高费率的子交易带着时（CPFP）不会被先淘汰
+func evictionCandidates(pool map[string]*MempoolEntry,policy MempoolPolicy) map[string]bool{
+	evicted := make(map[string]bool)
+	if policy.MaxBytes <= 0{
+		return evicted
+	}
+
+	remaining := make(map[string]*MempoolEntry)
+	total := 0
+	for id,entry := range pool{
+		remaining[id] = entry
+		total += entry.Size
+	}
+
+	for total > policy.MaxBytes && len(remaining) > 0{
+		worst := ""
+		var worstPackage map[string]bool
+		var worstFee Amount
+		worstSize := 0
+		for _,id := range sortedIDs(remaining){
+			pkg := poolDescendants(remaining,id)
+			pkg[id] = true
+			fee,size := packageFeeSize(remaining,pkg)
+			if worst == "" || compareFeeRate(fee,size,worstFee,worstSize) < 0{
+				worst,worstPackage,worstFee,worstSize = id,pkg,fee,size
+			}
+		}
+		for id := range worstPackage{
+			evicted[id] = true
+			total -= remaining[id].Size
+			delete(remaining,id)
+		}
+	}
+	return evicted
+}
+
+//按 祖先包费率（自己和还没选入的全部祖先一起算）从高到低选交易，父交易总是排在子交易前面，
+//总重量不超过maxWeight（<=0表示不限制）。返回选中的交易和手续费总额
+func selectByPackageFeeRate(pool map[string]*MempoolEntry,maxWeight int) ([]*Transation,Amount){
+	var selected []*Transation
+	included := make(map[string]bool)
+	var totalFee Amount
+	totalWeight := 0
+
+	//重量要序列化交易才能算出来，先算好
+	weights := make(map[string]int)
+	for id,entry := range pool{
+		weights[id] = entry.Tx.Weight()
+	}
+
+	for{
+		best := ""
+		var bestPackage map[string]bool
+		var bestFee Amount
+		bestSize,bestWeight := 0,0
+		for _,id := range sortedIDs(pool){
+			if included[id]{
+				continue
+			}
+			pkg := map[string]bool{id: true}
+			for ancestor := range poolAncestors(pool,id){
+				if !included[ancestor]{
+					pkg[ancestor] = true
+				}
+			}
+			fee,size := packageFeeSize(pool,pkg)
+			weight := 0
+			for member := range pkg{
+				weight += weights[member]
+			}
+			if maxWeight > 0 && totalWeight+weight > maxWeight{
+				continue
+			}
+			if best == "" || compareFeeRate(fee,size,bestFee,bestSize) > 0{
+				best,bestPackage,bestFee,bestSize,bestWeight = id,pkg,fee,size,weight
+			}
+		}
+		if best == ""{
+			break
+		}
+
+		//包中的交易按依赖关系排好再放进区块
+		txs := make(map[string]*Transation)
+		for id := range bestPackage{
+			txs[id] = pool[id].Tx
+			included[id] = true
+		}
+		selected = append(selected,sortByDependency(txs)...)
+		totalFee += bestFee
+		totalWeight += bestWeight
+	}
+	return selected,totalFee
+}
+
+//按ID排序，保证每次挑选的结果一样
+func sortedIDs(pool map[string]*MempoolEntry) []string{
+	var ids []string
+	for id := range pool{
+		ids = append(ids,id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+)
+
+//往池中放一笔假交易，它花费parents各自的0号输出，没有parents时花费池外的一个输出。
+//只有ID、输入和输出，手续费和大小直接给定
+func addPolicyTestEntry(pool map[string]*MempoolEntry,id byte,fee Amount,size int,when int64,parents ...*Transation) *Transation{
+	var vin []TXInput
+	for _,parent := range parents{
+		vin = append(vin,TXInput{parent.ID,0,nil,nil,SequenceFinal})
+	}
+	if len(vin) == 0{
+		vin = append(vin,TXInput{[]byte{0xf0},int(id),nil,nil,SequenceFinal})
+	}
+	tx := &Transation{[]byte{id},vin,[]TXOutput{{1,nil}}}
+	pool[hex.EncodeToString(tx.ID)] = &MempoolEntry{tx,fee,size,when}
+	return tx
+}
+
+func TestFeeForSize(t *testing.T){
+	tests := []struct{
+		rate Amount
+		size int
+		want Amount
+	}{
+		{1000,250,250},
+		{1,1,1},        //不足一个最小单位向上取整
+		{1500,333,500}, //499.5
+		{2000,1000,2000},
+		{0,100,0},
+		{1000,0,0},
+		{MaxMoney,1 << 40,MaxMoney + 1}, //乘积超过64位
+		{MaxMoney,2000,MaxMoney + 1},
+	}
+	for _,tt := range tests{
+		if got := feeForSize(tt.rate,tt.size); got != tt.want{
+			t.Errorf("feeForSize(%d, %d) = %d, want %d",tt.rate,tt.size,got,tt.want)
+		}
+	}
+}
+
+func TestCompareFeeRate(t *testing.T){
+	tests := []struct{
+		fee1  Amount
+		size1 int
+		fee2  Amount
+		size2 int
+		want  int
+	}{
+		{100,200,50,100,0},
+		{101,200,50,100,1},
+		{99,200,50,100,-1},
+		{0,100,0,200,0},
+		{MaxMoney,1 << 40,MaxMoney,1<<40 + 1,1}, //交叉相乘超过64位
+	}
+	for _,tt := range tests{
+		if got := compareFeeRate(tt.fee1,tt.size1,tt.fee2,tt.size2); got != tt.want{
+			t.Errorf("compareFeeRate(%d/%d, %d/%d) = %d, want %d",tt.fee1,tt.size1,tt.fee2,tt.size2,got,tt.want)
+		}
+	}
+}
+
+func TestCheckChainLimits(t *testing.T){
+	//1 <- 2 <- 3 <- 4
+	pool := make(map[string]*MempoolEntry)
+	var last *Transation
+	for i := byte(1); i <= 4; i++{
+		if last == nil{
+			last = addPolicyTestEntry(pool,i,100,100,0)
+		}else{
+			last = addPolicyTestEntry(pool,i,100,100,0,last)
+		}
+	}
+	id := hex.EncodeToString(last.ID)
+
+	policy := DefaultMempoolPolicy()
+	policy.MaxAncestors = 4
+	policy.MaxDescendants = 4
+	if err := checkChainLimits(pool,id,policy); err != nil{
+		t.Fatalf("checkChainLimits at the limit: %v",err)
+	}
+	policy.MaxAncestors = 3
+	if err := checkChainLimits(pool,id,policy); !errors.Is(err,ErrMempoolChain){
+		t.Errorf("too many ancestors: err = %v, want ErrMempoolChain",err)
+	}
+	policy.MaxAncestors = 25
+	policy.MaxDescendants = 3
+	if err := checkChainLimits(pool,id,policy); !errors.Is(err,ErrMempoolChain){
+		t.Errorf("too many descendants: err = %v, want ErrMempoolChain",err)
+	}
+	policy.MaxAncestors = 0
+	policy.MaxDescendants = 0
+	if err := checkChainLimits(pool,id,policy); err != nil{
+		t.Errorf("no limits: %v",err)
+	}
+}
+
+func TestExpiredEntries(t *testing.T){
+	now := time.Unix(1000000,0)
+	pool := make(map[string]*MempoolEntry)
+	old := addPolicyTestEntry(pool,1,100,100,now.Add(-2*time.Hour).Unix())
+	child := addPolicyTestEntry(pool,2,100,100,now.Unix(),old) //自己没过期，但父交易过期了
+	fresh := addPolicyTestEntry(pool,3,100,100,now.Add(-30*time.Minute).Unix())
+
+	policy := DefaultMempoolPolicy()
+	policy.Expiry = time.Hour
+	expired := expiredEntries(pool,now,policy)
+	if len(expired) != 2 || !expired[hex.EncodeToString(old.ID)] || !expired[hex.EncodeToString(child.ID)]{
+		t.Errorf("expired = %v, want the old transation and its child",expired)
+	}
+	if expired[hex.EncodeToString(fresh.ID)]{
+		t.Errorf("fresh transation expired")
+	}
+
+	policy.Expiry = 0
+	if expired := expiredEntries(pool,now,policy); len(expired) != 0{
+		t.Errorf("Expiry 0: expired = %v, want none",expired)
+	}
+}
+
+//父交易0手续费，子交易费率很高（CPFP），另有一笔单独的中等费率交易
+func cpfpTestPool() (map[string]*MempoolEntry,*Transation,*Transation,*Transation){
+	pool := make(map[string]*MempoolEntry)
+	parent := addPolicyTestEntry(pool,1,0,100,0)
+	child := addPolicyTestEntry(pool,2,300,100,0,parent)
+	single := addPolicyTestEntry(pool,3,100,100,0)
+	return pool,parent,child,single
+}
+
+func TestEvictionCandidates(t *testing.T){
+	pool,parent,child,single := cpfpTestPool()
+	policy := DefaultMempoolPolicy()
+
+	//父交易和子交易一起算的费率1.5高于单独交易的1.0，先淘汰单独交易
+	policy.MaxBytes = 200
+	evicted := evictionCandidates(pool,policy)
+	if len(evicted) != 1 || !evicted[hex.EncodeToString(single.ID)]{
+		t.Errorf("MaxBytes 200: evicted = %v, want only the single transation",evicted)
+	}
+
+	//淘汰父交易时子交易一起淘汰
+	policy.MaxBytes = 100
+	evicted = evictionCandidates(pool,policy)
+	for _,tx := range []*Transation{parent,child,single}{
+		if !evicted[hex.EncodeToString(tx.ID)]{
+			t.Errorf("MaxBytes 100: %x not evicted",tx.ID)
+		}
+	}
+
+	policy.MaxBytes = 300
+	if evicted := evictionCandidates(pool,policy); len(evicted) != 0{
+		t.Errorf("pool within limit: evicted = %v",evicted)
+	}
+}
+
+func TestSelectByPackageFeeRate(t *testing.T){
+	pool,parent,child,single := cpfpTestPool()
+
+	//子交易带着父交易的包费率最高，父交易排在子交易前面
+	txs,fees := selectByPackageFeeRate(pool,0)
+	want := []*Transation{parent,child,single}
+	if len(txs) != len(want) || fees != 400{
+		t.Fatalf("selected %d transations with fees %d, want 3 with fees 400",len(txs),fees)
+	}
+	for i := range want{
+		if txs[i] != want[i]{
+			t.Errorf("txs[%d] = %x, want %x",i,txs[i].ID,want[i].ID)
+		}
+	}
+
+	//只放得下一笔时，包放不下，选单独交易而不是0手续费的父交易
+	txs,fees = selectByPackageFeeRate(pool,single.Weight())
+	if len(txs) != 1 || txs[0] != single || fees != 100{
+		t.Errorf("limited template: %d transations, fees %d, want the single transation",len(txs),fees)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+//在临时目录中新建钱包集和区块链，创世区块的奖励付给钱包的第一个地址。
+//钱包文件和数据库都用相对路径，所以要切换工作目录；交易池策略恢复成默认值，最低转发费率为0
+func newTestChain(t *testing.T) (*BlockChain,*Wallets,string){
+	t.Helper()
+	chdirTemp(t)
+	policy := mempoolPolicy
+	mempoolPolicy = DefaultMempoolPolicy()
+	mempoolPolicy.MinRelayFeeRate = 0
+	t.Cleanup(func() { mempoolPolicy = policy })
+
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	addr := ws.GetAllAddress()[0]
+	bc,err := NewBlockChain(addr)
+	if err != nil{
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bc.Close() })
+	return bc,ws,addr
+}
+
+//切换到一个临时目录，测试结束时切换回来，使用的钱包文件也恢复成默认的
+func chdirTemp(t *testing.T){
+	t.Helper()
+	dir,err := os.Getwd()
+	if err != nil{
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil{
+		t.Fatal(err)
+	}
+	file := walletFile
+	walletFile = defaultWalletFile
+	t.Cleanup(func(){
+		walletFile = file
+		os.Chdir(dir)
+	})
+}
+
+//不挖矿连续转账两次，第二笔花费第一笔还没确认的找零，挖矿后交易池清空
+func TestMempoolChainedSends(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	b,_ := ws.CreateWallet(DefaultCurve)
+	c,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	cli := CLI{bc}
+	pool := Mempool{bc}
+
+	if err := cli.send(addr,b,10*Coin,SendOptions{},false); err != nil{
+		t.Fatal(err)
+	}
+	if err := cli.send(addr,c,5*Coin,SendOptions{},false); err != nil{
+		t.Fatal(err)
+	}
+	info,err := pool.Info()
+	if err != nil{
+		t.Fatal(err)
+	}
+	if info.Count != 2 || info.Bytes == 0{
+		t.Fatalf("mempool info = %+v, want 2 transations",info)
+	}
+	if got,_ := cli.getUnconfirmedBalance(b); got != 10*Coin{
+		t.Errorf("unconfirmed balance of b = %s, want 10",got)
+	}
+	if got,_ := cli.getUnconfirmedBalance(addr); got != -15*Coin{
+		t.Errorf("unconfirmed balance of sender = %s, want -15",got)
+	}
+	if got,_ := cli.GetBalance(b); got != 0{
+		t.Errorf("confirmed balance of b = %s before mining",got)
+	}
+
+	if err := cli.mine(addr); err != nil{
+		t.Fatal(err)
+	}
+	if info,_ := pool.Info(); info.Count != 0{
+		t.Fatalf("mempool still has %d transations after mining",info.Count)
+	}
+	if got,_ := cli.GetBalance(b); got != 10*Coin{
+		t.Errorf("balance of b = %s, want 10",got)
+	}
+	if got,_ := cli.GetBalance(c); got != 5*Coin{
+		t.Errorf("balance of c = %s, want 5",got)
+	}
+}
+
+//同一笔交易不能重复加入，花费池中交易已经花费的输出时被拒绝
+func TestMempoolRejectsConflicts(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	b,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	pool := Mempool{bc}
+
+	tx,err := NewUTXOTransation(addr,b,10*Coin,SendOptions{},bc)
+	if err != nil{
+		t.Fatal(err)
+	}
+	conflict,err := NewUTXOTransation(addr,b,20*Coin,SendOptions{},bc)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); err != nil{
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); !errors.Is(err,ErrTxInMempool){
+		t.Errorf("adding twice: got %v, want ErrTxInMempool",err)
+	}
+	if err := pool.Add(conflict); !errors.Is(err,ErrNotReplaceable){
+		t.Errorf("double spend: got %v, want ErrNotReplaceable",err)
+	}
+
+	//冲突的交易直接打包进区块，池中的交易就不可能上链了，要删除
+	cb,_ := NewCoinbaseTX(addr,"",0)
+	if _,err := bc.MineBlock([]*Transation{cb,conflict}); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := pool.Get(tx.ID); !errors.Is(err,ErrTxNotFound){
+		t.Errorf("conflicting transation is still in the mempool: %v",err)
+	}
+}
+
+//切换到更长的分叉后，被切换掉的区块中的交易回到交易池
+func TestReorgReturnsTransationsToMempool(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	genesis,err := bc.GetBlock(bc.tip)
+	if err != nil{
+		t.Fatal(err)
+	}
+	b,_ := ws.CreateWallet(CurveP256)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	pool := Mempool{bc}
+	tx,err := NewUTXOTransation(addr,b,10*Coin,SendOptions{},bc)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := pool.Add(tx); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := pool.MineBlock(addr); err != nil{
+		t.Fatal(err)
+	}
+
+	//区块hash不包括交易，等一秒让分叉上的区块时间戳不同
+	time.Sleep(time.Second)
+	prev := genesis.Hash
+	for h := int32(1); h <= 2; h++{
+		cb,_ := NewCoinbaseTX(b,fmt.Sprintf("fork%d",h),0)
+		block := NewBlock([]*Transation{cb},prev,h)
+		if err := bc.AddBlock(block); err != nil{
+			t.Fatal(err)
+		}
+		prev = block.Hash
+	}
+	if _,err := pool.Get(tx.ID); err != nil{
+		t.Fatalf("transation from the disconnected block is not in the mempool: %v",err)
+	}
+	if _,err := pool.MineBlock(addr); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := pool.Get(tx.ID); err == nil{
+		t.Fatal("transation is still in the mempool after it was mined again")
+	}
+}
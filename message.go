@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+//消息签名：证明自己拥有某个地址的私钥，不需要转账。
+//签名的是 前缀+消息 的双重SHA256，和比特币的signmessage相同，前缀保证签出来的不会是一笔交易。
+//签名是65字节的紧凑格式再base64编码：第一个字节是27+恢复号（+4表示压缩公钥），后面是r和s各32字节。
+//验证时由签名和消息恢复出公钥，算出公钥hash和地址比较
+const (
+	messageMagic         = "Bitcoin Signed Message:\n"
+	compactSigLen        = 65
+	compactSigHeader     = byte(27)
+	compactSigCompressed = byte(4)
+)
+
+//消息的hash：前缀和消息都以比特币的变长整数长度开头
+func messageHash(message string) []byte{
+	var buf bytes.Buffer
+	for _,s := range []string{messageMagic,message}{
+		writeCompactSize(&buf,uint64(len(s)))
+		buf.WriteString(s)
+	}
+	first := sha256.Sum256(buf.Bytes())
+	hash := sha256.Sum256(first[:])
+	return hash[:]
+}
+
+//比特币的变长整数：小于0xfd用1个字节，否则是标记字节加上小端的2、4、8字节
+func writeCompactSize(buf *bytes.Buffer,n uint64){
+	var b [9]byte
+	switch{
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+		return
+	case n <= 0xffff:
+		b[0] = 0xfd
+		binary.LittleEndian.PutUint16(b[1:],uint16(n))
+		buf.Write(b[:3])
+	case n <= 0xffffffff:
+		b[0] = 0xfe
+		binary.LittleEndian.PutUint32(b[1:],uint32(n))
+		buf.Write(b[:5])
+	default:
+		b[0] = 0xff
+		binary.LittleEndian.PutUint64(b[1:],n)
+		buf.Write(b[:9])
+	}
+}
+
+//用钱包中address的私钥签名消息，返回base64编码的紧凑签名。
+//只读地址返回ErrWatchOnly，加密的钱包锁定时返回ErrWalletLocked
+func (ws *Wallets) SignMessage(address,message string) (string,error){
+	wallet,err := ws.GetWallet(address)
+	if err != nil{
+		return "",err
+	}
+	if wallet.Locked(){
+		return "",ErrWalletLocked
+	}
+	var compressed bool
+	switch{
+	case bytes.Equal(wallet.PublicKey,MarshalPubKey(&wallet.PrivateKey.PublicKey,true)):
+		compressed = true
+	case bytes.Equal(wallet.PublicKey,wifUncompressedPubKey(&wallet.PrivateKey.PublicKey)):
+	default:
+		return "",fmt.Errorf("%w: public key encoding cannot be recovered from a signature",ErrInvalidKey)
+	}
+	sig,err := signCompact(&wallet.PrivateKey,messageHash(message),compressed)
+	if err != nil{
+		return "",err
+	}
+	return base64.StdEncoding.EncodeToString(sig),nil
+}
+
+//验证消息签名是address的私钥签的，签名不对返回ErrInvalidSignature
+func VerifyMessage(address,signature,message string) error{
+	addr,err := DecodeAddress(address,chainParams)
+	if err != nil{
+		return err
+	}
+	sig,err := base64.StdEncoding.DecodeString(signature)
+	if err != nil{
+		return fmt.Errorf("%w: signature is not base64: %v",ErrInvalidSignature,err)
+	}
+	if len(sig) != compactSigLen{
+		return fmt.Errorf("%w: signature has %d bytes, want %d",ErrInvalidSignature,len(sig),compactSigLen)
+	}
+	hash := messageHash(message)
+	//签名中没有曲线信息，依次在支持的曲线上恢复公钥
+	for _,id := range supportedCurves{
+		pub,compressed,err := recoverCompact(id.Curve(),sig,hash)
+		if err != nil{
+			continue
+		}
+		pubkey := wifUncompressedPubKey(pub)
+		if compressed{
+			pubkey = MarshalPubKey(pub,true)
+		}
+		if bytes.Equal(HashPubKey(pubkey),addr.PubKeyHash){
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: not signed by %s",ErrInvalidSignature,address)
+}
+
+//签名hash并算出恢复号，返回65字节的紧凑签名。
+//恢复号记录R点y坐标的奇偶和R.x是否超过n，这里逐个尝试，找到能恢复出本公钥的那个
+func signCompact(priv *ecdsa.PrivateKey,hash []byte,compressed bool) ([]byte,error){
+	r,s,err := signHash(priv,hash)
+	if err != nil{
+		return nil,err
+	}
+	size := coordinateLen(priv.Curve)
+	sig := make([]byte,compactSigLen)
+	r.FillBytes(sig[1 : 1+size])
+	s.FillBytes(sig[1+size:])
+	for recid := byte(0); recid < 4; recid++{
+		sig[0] = compactSigHeader + recid
+		if compressed{
+			sig[0] += compactSigCompressed
+		}
+		pub,_,err := recoverCompact(priv.Curve,sig,hash)
+		if err == nil && pub.X.Cmp(priv.X) == 0 && pub.Y.Cmp(priv.Y) == 0{
+			return sig,nil
+		}
+	}
+	return nil,fmt.Errorf("cannot find recovery id for signature")
+}
+
+//由紧凑签名和hash恢复公钥：Q = r⁻¹(s·R - e·G)，R是x坐标为r（或r+n）的曲线点
+func recoverCompact(curve elliptic.Curve,sig,hash []byte) (*ecdsa.PublicKey,bool,error){
+	header := sig[0] - compactSigHeader
+	if sig[0] < compactSigHeader || header >= 2*compactSigCompressed{
+		return nil,false,fmt.Errorf("%w: bad header byte %d",ErrInvalidSignature,sig[0])
+	}
+	compressed := header&compactSigCompressed != 0
+	recid := header &^ compactSigCompressed
+
+	params := curve.Params()
+	n := params.N
+	size := coordinateLen(curve)
+	r := new(big.Int).SetBytes(sig[1 : 1+size])
+	s := new(big.Int).SetBytes(sig[1+size:])
+	if r.Sign() == 0 || r.Cmp(n) >= 0 || s.Sign() == 0 || s.Cmp(n) >= 0{
+		return nil,false,fmt.Errorf("%w: r or s out of range",ErrInvalidSignature)
+	}
+
+	rx := new(big.Int).Set(r)
+	if recid&2 != 0{
+		rx.Add(rx,n)
+	}
+	ry,err := decompressY(curve,rx,recid&1 == 1)
+	if err != nil{
+		return nil,false,fmt.Errorf("%w: %v",ErrInvalidSignature,err)
+	}
+
+	//s·R - e·G，-e·G就是把e·G的y取反
+	qx,qy := curve.ScalarMult(rx,ry,s.Bytes())
+	e := new(big.Int).Mod(hashToInt(hash,n),n)
+	if e.Sign() != 0{
+		ex,ey := curve.ScalarBaseMult(e.Bytes())
+		qx,qy = curve.Add(qx,qy,ex,new(big.Int).Sub(params.P,ey))
+	}
+	qx,qy = curve.ScalarMult(qx,qy,new(big.Int).ModInverse(r,n).Bytes())
+	if qx.Sign() == 0 && qy.Sign() == 0{
+		return nil,false,fmt.Errorf("%w: recovered the point at infinity",ErrInvalidSignature)
+	}
+	return &ecdsa.PublicKey{Curve: curve,X: qx,Y: qy},compressed,nil
+}
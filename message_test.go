@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+//签名用RFC6979的确定性k，同一个私钥和消息的签名是固定的。期望值另外按比特币signmessage的算法算出
+func TestSignMessageKnownAnswers(t *testing.T){
+	tests := []struct{
+		wif,address,message,signature string
+	}{
+		{"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617","1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK","Hello, World!",
+			"H2jm888xMz4A4BMNURLSeOQ69DBVT3Pw/VBEVfM9zNoINaMaG1OZCUyAgbvte89aDZWu5uv6Be8//xbSiJ5XNPU="},
+		{"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617","1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK","",
+			"H2Ijf+Lv7QjnQEkV1h7mWrdyKRZ8yx2Cp0c2VSMP9R6RPtZQlL3qqtdj/eOYIuPIBKdmOAvIKRBqhttQDPU3n30="},
+		{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ","1GAehh7TsJAHuUAeKZcXf5CnwuGuGgyX2S","Hello, World!",
+			"G2jm888xMz4A4BMNURLSeOQ69DBVT3Pw/VBEVfM9zNoINaMaG1OZCUyAgbvte89aDZWu5uv6Be8//xbSiJ5XNPU="},
+	}
+	for _,tt := range tests{
+		wallet,err := DecodeWIF(tt.wif)
+		if err != nil{
+			t.Fatal(err)
+		}
+		ws := &Wallets{Store: map[string]*Wallet{tt.address: wallet}}
+		sig,err := ws.SignMessage(tt.address,tt.message)
+		if err != nil || sig != tt.signature{
+			t.Errorf("SignMessage(%s, %q) = %s, %v, want %s",tt.address,tt.message,sig,err,tt.signature)
+		}
+		if err := VerifyMessage(tt.address,tt.signature,tt.message); err != nil{
+			t.Errorf("VerifyMessage(%s, %q): %v",tt.address,tt.message,err)
+		}
+	}
+
+	//私钥为1的压缩地址
+	if err := VerifyMessage("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH","HzAcieVBUwC1YDj4Dn5+rrp56B4DxJdhT3OUeNqDT58qQPQiKVfGp3Ym67gL1DD+9XLkeP6a2DUAhJY2nOHizys=","Hello, World!"); err != nil{
+		t.Errorf("VerifyMessage for private key 1: %v",err)
+	}
+}
+
+//各种曲线和公钥格式的地址都能签名和验证，改了消息、换了地址或者改了压缩标记都验证不过
+func TestSignVerifyMessage(t *testing.T){
+	ws := &Wallets{Store: make(map[string]*Wallet)}
+	add := func(w *Wallet) string{
+		address := fmt.Sprintf("%s",w.GetAddress())
+		ws.Store[address] = w
+		return address
+	}
+	k1,_ := NewWalletOnCurve(CurveSecp256k1)
+	p256,_ := NewWalletOnCurve(CurveP256)
+	legacy,_ := NewWalletOnCurve(CurveP256)
+	legacy.PublicKey = append(legacy.PrivateKey.X.Bytes(),legacy.PrivateKey.Y.Bytes()...)
+	uncompressed,_ := NewWalletOnCurve(CurveSecp256k1)
+	uncompressed.PublicKey = MarshalPubKey(&uncompressed.PrivateKey.PublicKey,false)
+	first := add(k1)
+	addresses := []string{first,add(p256),add(legacy),add(uncompressed)}
+
+	const message = "hello 世界"
+	for _,address := range addresses{
+		sig,err := ws.SignMessage(address,message)
+		if err != nil{
+			t.Fatalf("SignMessage(%s): %v",address,err)
+		}
+		if err := VerifyMessage(address,sig,message); err != nil{
+			t.Errorf("VerifyMessage(%s): %v",address,err)
+		}
+		if err := VerifyMessage(address,sig,"hello"); !errors.Is(err,ErrInvalidSignature){
+			t.Errorf("%s: changed message: err = %v, want ErrInvalidSignature",address,err)
+		}
+		if address != first{
+			if err := VerifyMessage(first,sig,message); !errors.Is(err,ErrInvalidSignature){
+				t.Errorf("%s: other address: err = %v, want ErrInvalidSignature",address,err)
+			}
+		}
+		raw,_ := base64.StdEncoding.DecodeString(sig)
+		raw[0] ^= compactSigCompressed
+		if err := VerifyMessage(address,base64.StdEncoding.EncodeToString(raw),message); err == nil{
+			t.Errorf("%s: signature with the compression flag flipped verifies",address)
+		}
+	}
+}
+
+func TestVerifyMessageRejects(t *testing.T){
+	address := "1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK"
+	for _,sig := range []string{"","!!",base64.StdEncoding.EncodeToString(make([]byte,65)),base64.StdEncoding.EncodeToString(make([]byte,64))}{
+		if err := VerifyMessage(address,sig,"x"); !errors.Is(err,ErrInvalidSignature){
+			t.Errorf("VerifyMessage(%q): err = %v, want ErrInvalidSignature",sig,err)
+		}
+	}
+	sig := "H2jm888xMz4A4BMNURLSeOQ69DBVT3Pw/VBEVfM9zNoINaMaG1OZCUyAgbvte89aDZWu5uv6Be8//xbSiJ5XNPU="
+	if err := VerifyMessage("bogus",sig,"Hello, World!"); !errors.Is(err,ErrInvalidAddress){
+		t.Errorf("bad address: err = %v, want ErrInvalidAddress",err)
+	}
+}
+
+//没有私钥的地址不能签名，加密的钱包锁定时也不能
+func TestSignMessageNeedsPrivateKey(t *testing.T){
+	chdirTemp(t)
+	forgetTestUnlocks(t)
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	address := ws.GetAllAddress()[0]
+	if _,err := ws.SignMessage("1BoatSLRHtKNngkdXEeobR76b53LETtpyT","x"); !errors.Is(err,ErrUnknownAddress){
+		t.Errorf("unknown address: err = %v, want ErrUnknownAddress",err)
+	}
+	watched := NewAddress(make([]byte,pubKeyHashLen),chainParams).String()
+	if err := ws.ImportAddress(watched); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.SignMessage(watched,"x"); !errors.Is(err,ErrWatchOnly){
+		t.Errorf("watch-only address: err = %v, want ErrWatchOnly",err)
+	}
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.SignMessage(address,"x"); !errors.Is(err,ErrWalletLocked){
+		t.Errorf("locked wallet: err = %v, want ErrWalletLocked",err)
+	}
+	if err := ws.Unlock("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.SignMessage(address,"x"); err != nil{
+		t.Errorf("unlocked wallet: %v",err)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//一个节点可以有多个互相独立的钱包，每个钱包是一个单独的文件。没有名字的是默认钱包wallet.dat，
+//有名字的钱包是wallet_<名字>.dat。命名钱包要先加载（loadWallet）才能用 -wallet 选择，
+//加载的钱包名单保存在loadedWalletsFile中。钱包的交易记录在用到时才同步到最新区块，见SyncHistory
+const loadedWalletsFile = "wallets.loaded"
+
+var walletNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+//检查钱包名是否合法：字母、数字、下划线和减号
+func checkWalletName(name string) error{
+	if !walletNamePattern.MatchString(name){
+		return fmt.Errorf("invalid wallet name %q, use letters, digits, _ and -",name)
+	}
+	return nil
+}
+
+//钱包名对应的文件，空名字是默认钱包
+func walletFileName(name string) string{
+	if name == ""{
+		return defaultWalletFile
+	}
+	return "wallet_" + name + ".dat"
+}
+
+//已加载的命名钱包，按名字排序
+func LoadedWallets() ([]string,error){
+	content,err := ioutil.ReadFile(loadedWalletsFile)
+	if os.IsNotExist(err){
+		return nil,nil
+	}
+	if err != nil{
+		return nil,err
+	}
+	var names []string
+	for _,name := range strings.Fields(string(content)){
+		if checkWalletName(name) == nil{
+			names = append(names,name)
+		}
+	}
+	sort.Strings(names)
+	return names,nil
+}
+
+func saveLoadedWallets(names []string) error{
+	sort.Strings(names)
+	return writeFileAtomic(loadedWalletsFile,[]byte(strings.Join(names,"\n")+"\n"),0600)
+}
+
+//钱包是否已加载，默认钱包总是加载的
+func isWalletLoaded(name string) (bool,error){
+	if name == ""{
+		return true,nil
+	}
+	names,err := LoadedWallets()
+	if err != nil{
+		return false,err
+	}
+	for _,loaded := range names{
+		if loaded == name{
+			return true,nil
+		}
+	}
+	return false,nil
+}
+
+//选择命令使用的钱包，名字为空是默认钱包。命名钱包必须已经加载
+func SelectWallet(name string) error{
+	if name != ""{
+		err := checkWalletName(name)
+		if err != nil{
+			return err
+		}
+	}
+	loaded,err := isWalletLoaded(name)
+	if err != nil{
+		return err
+	}
+	if !loaded{
+		return fmt.Errorf("wallet %q is not loaded, use loadWallet -name %s",name,name)
+	}
+	walletFile = walletFileName(name)
+	return nil
+}
+
+//创建命名的HD钱包并加载，返回钱包集和助记词。同名的钱包文件已经存在时返回错误
+func CreateNamedWallet(name string) (*Wallets,string,error){
+	err := checkWalletName(name)
+	if err != nil{
+		return nil,"",err
+	}
+	file := walletFileName(name)
+	if _,err := os.Stat(file); err == nil{
+		return nil,"",fmt.Errorf("wallet %q already exists, use loadWallet -name %s",name,name)
+	}
+	ws,mnemonic,err := NewHDWallets()
+	if err != nil{
+		return nil,"",err
+	}
+	ws.file = file
+	err = ws.SaveToFile2()
+	if err == nil{
+		err = LoadWallet(name)
+	}
+	if err != nil{
+		ws.Close()
+		return nil,"",err
+	}
+	return ws,mnemonic,nil
+}
+
+//加载命名钱包，钱包文件必须存在。已经加载过时什么也不做
+func LoadWallet(name string) error{
+	err := checkWalletName(name)
+	if err != nil{
+		return err
+	}
+	if _,err := os.Stat(walletFileName(name)); err != nil{
+		return fmt.Errorf("%w: wallet %q: %v",ErrWalletFile,name,err)
+	}
+	loaded,err := isWalletLoaded(name)
+	if err != nil || loaded{
+		return err
+	}
+	names,err := LoadedWallets()
+	if err != nil{
+		return err
+	}
+	return saveLoadedWallets(append(names,name))
+}
+
+//卸载命名钱包，钱包文件保留，之后不能再用 -wallet 选择
+func UnloadWallet(name string) error{
+	if name == ""{
+		return fmt.Errorf("the default wallet cannot be unloaded")
+	}
+	names,err := LoadedWallets()
+	if err != nil{
+		return err
+	}
+	var kept []string
+	for _,loaded := range names{
+		if loaded != name{
+			kept = append(kept,loaded)
+		}
+	}
+	if len(kept) == len(names){
+		return fmt.Errorf("wallet %q is not loaded",name)
+	}
+	return saveLoadedWallets(kept)
+}
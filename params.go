@@ -0,0 +1,27 @@
+package main
+
+//共识参数：所有节点必须一致，超出限制的区块是无效的，不能存进数据库。
+//交易池的转发标准（比共识更严）在MempoolPolicy中
+type ChainParams struct{
+	MaxBlockWeight     int  //区块的最大重量，见Block.Weight
+	WitnessScaleFactor int  //签名和公钥以外的数据每字节的重量，签名和公钥每字节的重量是1
+	PubKeyHashAddrID   byte //地址的版本号，不同网络的地址不能混用，见DecodeAddress
+}
+
+//默认的共识参数
+func DefaultChainParams() ChainParams{
+	return ChainParams{
+		MaxBlockWeight:     4000000,
+		WitnessScaleFactor: 4,
+		PubKeyHashAddrID:   version,
+	}
+}
+
+//本进程使用的共识参数
+var chainParams = DefaultChainParams()
+
+//其他节点发来的一条消息最多这么多字节：区块序列化后的字节数不会超过它的重量，
+//再加上命令字和消息格式的开销。更大的消息不再读取，防止对方让本节点无限制地占用内存
+func (p ChainParams) MaxMessageSize() int{
+	return cmdLength + p.MaxBlockWeight + 1<<16
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+)
+
+//部分签名交易（PSBT）：在有区块链数据库的机器上创建，拿到只有钱包文件的离线机器上签名，
+//再拿回来合并、检查、广播。文件中带着每个输入引用的输出，签名和验证都不需要访问区块链
+type PSBT struct{
+	Tx       Transation //待签名的交易，已经签好的输入直接填在Vin的Signature和Pubkey中
+	PrevOuts []TXOutput //每个输入引用的输出，和Tx.Vin一一对应
+	Final    bool       //finalizePSBT检查通过后为true，只有这样的交易才能广播
+}
+
+//PSBT文件开头的标识，防止把别的文件当成PSBT读取
+var psbtMagic = []byte("psbt\xff")
+
+//根据选好的UTXO创建未签名的PSBT，付fee的手续费，找零付给change地址，不到minChange时不找零，每个输入的序列号是sequence。
+//金额超出范围或者选中的总额acc不够付金额和手续费时返回ErrInvalidAmount
+func NewPSBT(change,to string,amount,fee,minChange Amount,selected []UTXO,acc Amount,sequence uint32) (*PSBT,error){
+	target,err := amount.Add(fee)
+	if err != nil{
+		return nil,err
+	}
+	changeValue,err := acc.Sub(target)
+	if err != nil{
+		return nil,err
+	}
+
+	var inputs []TXInput
+	var prevOuts []TXOutput
+	for _,utxo := range selected{
+		inputs = append(inputs,TXInput{utxo.TXid,utxo.Voutindex,nil,nil,sequence})
+		prevOuts = append(prevOuts,utxo.Output)
+	}
+
+	var outputs []TXOutput
+	output,err := NewTXOutput(amount,to)
+	if err != nil{
+		return nil,err
+	}
+	outputs = append(outputs,*output)
+	if changeValue > minChange{
+		changeOutput,err := NewTXOutput(changeValue,change)
+		if err != nil{
+			return nil,err
+		}
+		outputs = append(outputs,*changeOutput)
+	}
+
+	psbt := &PSBT{Tx: Transation{nil,inputs,outputs},PrevOuts: prevOuts}
+	psbt.Tx.ID = psbt.Tx.Hash()
+	return psbt,nil
+}
+
+//序列化，前面加上PSBT标识
+func (p *PSBT) Serialize() ([]byte,error){
+	var content bytes.Buffer
+	content.Write(psbtMagic)
+	err := gob.NewEncoder(&content).Encode(p)
+	if err != nil{
+		return nil,err
+	}
+	return content.Bytes(),nil
+}
+
+//反序列化，检查标识和输入、输出的对应关系
+func DeserializePSBT(data []byte) (*PSBT,error){
+	if !bytes.HasPrefix(data,psbtMagic){
+		return nil,fmt.Errorf("%w: missing psbt header",ErrInvalidPSBT)
+	}
+	var p PSBT
+	err := gob.NewDecoder(bytes.NewReader(data[len(psbtMagic):])).Decode(&p)
+	if err != nil{
+		return nil,fmt.Errorf("%w: %v",ErrInvalidPSBT,err)
+	}
+	if len(p.Tx.Vin) == 0 || len(p.PrevOuts) != len(p.Tx.Vin){
+		return nil,fmt.Errorf("%w: %d inputs but %d previous outputs",ErrInvalidPSBT,len(p.Tx.Vin),len(p.PrevOuts))
+	}
+	return &p,nil
+}
+
+//从文件读取PSBT
+func LoadPSBT(filename string) (*PSBT,error){
+	data,err := ioutil.ReadFile(filename)
+	if err != nil{
+		return nil,err
+	}
+	return DeserializePSBT(data)
+}
+
+//把PSBT写入文件
+func (p *PSBT) SaveToFile(filename string) error{
+	data,err := p.Serialize()
+	if err != nil{
+		return err
+	}
+	return ioutil.WriteFile(filename,data,0600)
+}
+
+//不含签名和公钥的交易hash，用来判断两个PSBT是不是同一笔交易
+func (p *PSBT) unsignedHash() []byte{
+	txcopy := p.Tx.TrimmedCopy()
+	return txcopy.Hash()
+}
+
+//手续费：引用输出的总额减去输出总额，输出超过输入时返回ErrInvalidTransation。
+//金额来自PSBT文件，签名覆盖引用输出的金额，文件中的金额不对时签名无效
+func (p *PSBT) Fee() (Amount,error){
+	return checkTransationAmounts(&p.Tx,p.PrevOuts)
+}
+
+//第inID个输入是否已经签名
+func (p *PSBT) isSigned(inID int) bool{
+	return len(p.Tx.Vin[inID].Signature) > 0
+}
+
+//用钱包集中的密钥给能签的输入签名，已经签过的输入跳过，返回这次签名的输入个数。
+//只需要钱包文件，不需要区块链数据库
+func (p *PSBT) Sign(ws *Wallets,hashType SigHashType) (int,error){
+	if p.Final{
+		return 0,fmt.Errorf("%w: psbt is already finalized",ErrInvalidPSBT)
+	}
+
+	return signWithWallets(&p.Tx,p.PrevOuts,ws,hashType)
+}
+
+//把其他人签过的PSBT合并进来，必须是同一笔交易。两边都签了的输入保留当前的签名
+func (p *PSBT) Combine(other *PSBT) error{
+	if !bytes.Equal(p.unsignedHash(),other.unsignedHash()){
+		return fmt.Errorf("%w: psbts are for different transations",ErrInvalidPSBT)
+	}
+	for inID := range p.Tx.Vin{
+		if !p.isSigned(inID) && other.isSigned(inID){
+			p.Tx.Vin[inID].Signature = other.Tx.Vin[inID].Signature
+			p.Tx.Vin[inID].Pubkey = other.Tx.Vin[inID].Pubkey
+		}
+	}
+	p.Final = false
+	return nil
+}
+
+//检查全部输入都已签名，并用文件中带的引用输出验证每个签名，通过后标记为可以广播
+func (p *PSBT) Finalize() error{
+	for inID := range p.Tx.Vin{
+		if !p.isSigned(inID){
+			return fmt.Errorf("%w: input %d is not signed",ErrInvalidPSBT,inID)
+		}
+		err := p.Tx.VerifyInput(inID,p.PrevOuts[inID])
+		if err != nil{
+			return err
+		}
+	}
+
+	//创建时公钥还没有填上，签好名后重新计算交易ID
+	p.Tx.ID = p.Tx.unsignedID()
+	p.Final = true
+	return nil
+}
+
+//打印PSBT的签名进度
+func (p *PSBT) ToString() string{
+	signed := 0
+	for inID := range p.Tx.Vin{
+		if p.isSigned(inID){
+			signed++
+		}
+	}
+	return fmt.Sprintf("%s\n   Signed inputs: %d/%d, Final: %v",p.Tx.ToString(),signed,len(p.Tx.Vin),p.Final)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+//SEC1公钥编码的前缀字节
+const (
+	pubkeyCompressedEven = 0x02 //压缩格式，y是偶数
+	pubkeyCompressedOdd  = 0x03 //压缩格式，y是奇数
+	pubkeyUncompressed   = 0x04 //非压缩格式，后面跟着x、y
+)
+
+var errInvalidPubKey = errors.New("invalid public key")
+
+//坐标的固定字节长度，P256和secp256k1都是32字节
+func coordinateLen(curve elliptic.Curve) int{
+	return (curve.Params().BitSize + 7) / 8
+}
+
+//把公钥编码成SEC1格式：压缩格式是 前缀+x 共33字节，非压缩格式是 0x04+x+y 共65字节。
+//x、y都按固定长度补齐前导0，不会再出现长度不定的问题
+func MarshalPubKey(pub *ecdsa.PublicKey,compressed bool) []byte{
+	size := coordinateLen(pub.Curve)
+	if compressed{
+		out := make([]byte,1+size)
+		out[0] = pubkeyCompressedEven
+		if pub.Y.Bit(0) == 1{
+			out[0] = pubkeyCompressedOdd
+		}
+		pub.X.FillBytes(out[1:])
+		return out
+	}
+
+	out := make([]byte,1+2*size)
+	out[0] = pubkeyUncompressed
+	pub.X.FillBytes(out[1 : 1+size])
+	pub.Y.FillBytes(out[1+size:])
+	return out
+}
+
+//解析交易输入中的公钥，支持SEC1压缩、非压缩格式，以及早期钱包直接拼接x、y的旧格式
+func ParsePubKey(curve elliptic.Curve,data []byte) (*ecdsa.PublicKey,error){
+	size := coordinateLen(curve)
+
+	switch{
+	case len(data) == 1+size && (data[0] == pubkeyCompressedEven || data[0] == pubkeyCompressedOdd):
+		x := new(big.Int).SetBytes(data[1:])
+		y,err := decompressY(curve,x,data[0] == pubkeyCompressedOdd)
+		if err == nil{
+			return &ecdsa.PublicKey{Curve: curve,X: x,Y: y},nil
+		}
+	case len(data) == 1+2*size && data[0] == pubkeyUncompressed:
+		x := new(big.Int).SetBytes(data[1 : 1+size])
+		y := new(big.Int).SetBytes(data[1+size:])
+		if isOnCurve(curve,x,y){
+			return &ecdsa.PublicKey{Curve: curve,X: x,Y: y},nil
+		}
+		return nil,fmt.Errorf("%w: point is not on the curve",errInvalidPubKey)
+	}
+
+	//旧格式没有前缀，33字节的旧公钥也可能恰好以02、03开头，所以上面解压失败时也要再试一次
+	return parseLegacyPubKey(curve,data)
+}
+
+//旧钱包的公钥是 X.Bytes()+Y.Bytes() 直接拼接，坐标有前导0字节时会变短，不能简单地从中间切开。
+//这里尝试所有可能的切分位置，找到在曲线上的那个点。两个坐标都去掉了前导0，所以各自的第一个字节都不为0
+func parseLegacyPubKey(curve elliptic.Curve,data []byte) (*ecdsa.PublicKey,error){
+	size := coordinateLen(curve)
+	if len(data) < 2 || len(data) > 2*size{
+		return nil,fmt.Errorf("%w: unexpected length %d",errInvalidPubKey,len(data))
+	}
+
+	//先试从中间切开，这是最常见的情况
+	splits := []int{len(data) / 2}
+	for k := len(data) - size; k <= size; k++{
+		if k != len(data)/2{
+			splits = append(splits,k)
+		}
+	}
+	for _,k := range splits{
+		if k < 1 || k >= len(data) || data[0] == 0 || data[k] == 0{
+			continue
+		}
+		x := new(big.Int).SetBytes(data[:k])
+		y := new(big.Int).SetBytes(data[k:])
+		if isOnCurve(curve,x,y){
+			return &ecdsa.PublicKey{Curve: curve,X: x,Y: y},nil
+		}
+	}
+	return nil,fmt.Errorf("%w: no point on the curve",errInvalidPubKey)
+}
+
+//根据x坐标和y的奇偶性恢复y坐标：y² = x³ + ax + b (mod p)
+func decompressY(curve elliptic.Curve,x *big.Int,odd bool) (*big.Int,error){
+	params := curve.Params()
+	if x.Cmp(params.P) >= 0{
+		return nil,fmt.Errorf("%w: x is out of range",errInvalidPubKey)
+	}
+
+	y2 := curveRHS(curve,x)
+	y := new(big.Int).ModSqrt(y2,params.P)
+	if y == nil{
+		return nil,fmt.Errorf("%w: x is not on the curve",errInvalidPubKey)
+	}
+	if odd != (y.Bit(0) == 1){
+		y.Sub(params.P,y)
+	}
+	return y,nil
+}
+
+//计算曲线方程右边 x³ + ax + b (mod p)
+func curveRHS(curve elliptic.Curve,x *big.Int) *big.Int{
+	params := curve.Params()
+	rhs := new(big.Int).Mul(x,x)
+	rhs.Mul(rhs,x)
+
+	ax := new(big.Int).Mul(curveA(curve),x)
+	rhs.Add(rhs,ax)
+	rhs.Add(rhs,params.B)
+	return rhs.Mod(rhs,params.P)
+}
+
+//曲线方程中的系数a，NIST曲线都是-3，secp256k1是0
+func curveA(curve elliptic.Curve) *big.Int{
+	if curveIDOf(curve) == CurveSecp256k1{
+		return big.NewInt(0)
+	}
+	return big.NewInt(-3)
+}
+
+//检查点是否在曲线上，直接按曲线方程计算，不依赖具体曲线的实现
+func isOnCurve(curve elliptic.Curve,x,y *big.Int) bool{
+	params := curve.Params()
+	if x.Sign() < 0 || x.Cmp(params.P) >= 0 || y.Sign() < 0 || y.Cmp(params.P) >= 0{
+		return false
+	}
+	y2 := new(big.Int).Mul(y,y)
+	y2.Mod(y2,params.P)
+	return y2.Cmp(curveRHS(curve,x)) == 0
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//原始交易：十六进制编码的交易序列化数据，由用户明确指定花费哪些输出、付给谁多少，不经过自动选币
+
+//反序列化交易
+func DeserializeTransation(data []byte) (*Transation,error){
+	var tx Transation
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&tx)
+	if err != nil{
+		return nil,fmt.Errorf("%w: %v",ErrInvalidTransation,err)
+	}
+	if len(tx.Vin) == 0 || len(tx.Vout) == 0{
+		return nil,fmt.Errorf("%w: transation has no inputs or outputs",ErrInvalidTransation)
+	}
+	return &tx,nil
+}
+
+//从十六进制字符串解析交易
+func DecodeRawTransation(rawhex string) (*Transation,error){
+	data,err := hex.DecodeString(strings.TrimSpace(rawhex))
+	if err != nil{
+		return nil,fmt.Errorf("%w: %v",ErrInvalidTransation,err)
+	}
+	return DeserializeTransation(data)
+}
+
+//把交易编码成十六进制字符串
+func (tx *Transation) RawHex() string{
+	return hex.EncodeToString(tx.Serialize())
+}
+
+//解析输入列表 "txid:vout,txid:vout"，输入的序列号是SequenceFinal
+func ParseRawInputs(s string) ([]TXInput,error){
+	var inputs []TXInput
+	seen := make(map[string]bool)
+	for _,item := range strings.Split(s,","){
+		item = strings.TrimSpace(item)
+		pos := strings.LastIndex(item,":")
+		if pos < 0{
+			return nil,fmt.Errorf("input %q must be txid:vout",item)
+		}
+		txid,err := hex.DecodeString(item[:pos])
+		if err != nil || len(txid) == 0{
+			return nil,fmt.Errorf("input %q has an invalid txid",item)
+		}
+		vout,err := strconv.Atoi(item[pos+1:])
+		if err != nil || vout < 0{
+			return nil,fmt.Errorf("input %q has an invalid output index",item)
+		}
+		key := fmt.Sprintf("%x:%d",txid,vout)
+		if seen[key]{
+			return nil,fmt.Errorf("input %s is listed twice",key)
+		}
+		seen[key] = true
+		inputs = append(inputs,TXInput{txid,vout,nil,nil,SequenceFinal})
+	}
+	return inputs,nil
+}
+
+//解析输出列表 "address:amount,address:amount"，金额是 整数.小数 格式，地址不合法返回ErrInvalidAddress
+func ParseRawOutputs(s string) ([]TXOutput,error){
+	var outputs []TXOutput
+	for _,item := range strings.Split(s,","){
+		item = strings.TrimSpace(item)
+		pos := strings.LastIndex(item,":")
+		if pos < 0{
+			return nil,fmt.Errorf("output %q must be address:amount",item)
+		}
+		amount,err := ParseAmount(item[pos+1:])
+		if err != nil || amount == 0{
+			return nil,fmt.Errorf("%w: output %q has an invalid amount",ErrInvalidAmount,item)
+		}
+		output,err := NewTXOutput(amount,item[:pos])
+		if err != nil{
+			return nil,fmt.Errorf("output %q: %w",item,err)
+		}
+		outputs = append(outputs,*output)
+	}
+	return outputs,nil
+}
+
+//用指定的输入和输出创建未签名的交易
+func NewRawTransation(inputs []TXInput,outputs []TXOutput) *Transation{
+	tx := Transation{nil,inputs,outputs}
+	tx.ID = tx.Hash()
+	return &tx
+}
+
+//交易ID按 有公钥、无签名 的交易计算，和NewUTXOTransation一致，签名不会改变交易ID
+func (tx *Transation) unsignedID() []byte{
+	txcopy := *tx
+	txcopy.Vin = make([]TXInput,len(tx.Vin))
+	for i,vin := range tx.Vin{
+		txcopy.Vin[i] = TXInput{vin.TXid,vin.Voutindex,nil,vin.Pubkey,vin.Sequence}
+	}
+	return txcopy.Hash()
+}
+
+//检查交易ID等于按内容计算的ID。收到的交易和区块中的交易都要检查，
+//否则别人可以用任意的ID转发交易，交易池的键、冲突检查和上链后的交易ID都会错
+func (tx *Transation) checkID() error{
+	if !bytes.Equal(tx.ID,tx.unsignedID()){
+		return fmt.Errorf("%w: transation id %x does not match its content",ErrInvalidTransation,tx.ID)
+	}
+	return nil
+}
+
+//交易的每个输入是否都已签名
+func (tx *Transation) isComplete() bool{
+	for _,vin := range tx.Vin{
+		if len(vin.Signature) == 0{
+			return false
+		}
+	}
+	return true
+}
+
+//用钱包集中的密钥给能签的输入签名，prevOuts是每个输入引用的输出。
+//已经签过的输入跳过，返回这次签名的输入个数
+func signWithWallets(tx *Transation,prevOuts []TXOutput,ws *Wallets,hashType SigHashType) (int,error){
+	//公钥hash --> 钱包
+	keys := make(map[string]*Wallet)
+	for _,wallet := range ws.Store{
+		keys[string(HashPubKey(wallet.PublicKey))] = wallet
+	}
+
+	signed := 0
+	for inID,prevOut := range prevOuts{
+		if len(tx.Vin[inID].Signature) > 0{
+			continue
+		}
+		wallet,ok := keys[string(prevOut.PubkeyHash)]
+		if !ok{
+			continue
+		}
+		tx.Vin[inID].Pubkey = wallet.PublicKey
+		err := tx.SignInput(inID,wallet.PrivateKey,prevOut,hashType)
+		if err != nil{
+			return signed,err
+		}
+		signed++
+	}
+	return signed,nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+//opt-in替换（replace-by-fee）：交易的任意一个输入的序列号不大于maxRBFSequence，表示上链之前允许被
+//花费同一个输出、手续费更高的交易替换。序列号是SequenceFinal的交易不允许替换
+const (
+	SequenceFinal  uint32 = 0xffffffff
+	maxRBFSequence uint32 = 0xfffffffd
+
+	maxReplacementEvictions = 100 //一次替换最多从池中删除这么多笔交易（冲突交易和它们的后代）
+)
+
+//新建交易时输入的序列号
+func inputSequence(replaceable bool) uint32{
+	if replaceable{
+		return maxRBFSequence
+	}
+	return SequenceFinal
+}
+
+//交易是否声明了允许替换
+func (tx *Transation) signalsReplaceable() bool{
+	for _,vin := range tx.Vin{
+		if vin.Sequence <= maxRBFSequence{
+			return true
+		}
+	}
+	return false
+}
+
+//检查新交易能否替换池中和它冲突的交易，返回要从池中删除的交易（冲突交易和它们的后代）。规则是：
+//1. 每笔冲突交易都声明了允许替换
+//2. 新交易的费率高于每笔冲突交易的费率
+//3. 要删除的交易不超过maxReplacementEvictions笔，新交易不能花费要删除的交易的输出
+//4. 新交易的手续费高于要删除的全部交易的手续费之和，多出的部分至少够按最低转发费率付新交易自己的大小
+func checkReplacement(entries map[string]*MempoolEntry,conflicts map[string]bool,entry *MempoolEntry,policy MempoolPolicy) (map[string]bool,error){
+	replaced := make(map[string]bool)
+	for id := range conflicts{
+		conflict := entries[id]
+		if !conflict.Tx.signalsReplaceable(){
+			return nil,fmt.Errorf("%w: conflicts with %s",ErrNotReplaceable,id)
+		}
+		if compareFeeRate(entry.Fee,entry.Size,conflict.Fee,conflict.Size) <= 0{
+			return nil,fmt.Errorf("%w: fee rate %.2f does not exceed %.2f of replaced transation %s",ErrFeeTooLow,feeRate(entry.Fee,entry.Size),feeRate(conflict.Fee,conflict.Size),id)
+		}
+		replaced[id] = true
+		for descendant := range poolDescendants(entries,id){
+			replaced[descendant] = true
+		}
+	}
+
+	if len(replaced) > maxReplacementEvictions{
+		return nil,fmt.Errorf("%w: replacement would evict %d transations, limit is %d",ErrMempoolConflict,len(replaced),maxReplacementEvictions)
+	}
+	for _,vin := range entry.Tx.Vin{
+		if parent := hex.EncodeToString(vin.TXid); replaced[parent]{
+			return nil,fmt.Errorf("%w: replacement spends an output of %s which it replaces",ErrMempoolConflict,parent)
+		}
+	}
+
+	replacedFee,_ := packageFeeSize(entries,replaced)
+	if entry.Fee < replacedFee+replacementIncrement(policy,entry.Size){
+		return nil,fmt.Errorf("%w: fee %s must exceed %s of replaced transations by at least %s",ErrFeeTooLow,entry.Fee,replacedFee,replacementIncrement(policy,entry.Size))
+	}
+	return replaced,nil
+}
+
+//替换交易比被替换的交易至少要多付的手续费，至少为一个最小单位
+func replacementIncrement(policy MempoolPolicy,size int) Amount{
+	increment := feeForSize(policy.MinRelayFeeRate,size)
+	if increment < 1{
+		increment = 1
+	}
+	return increment
+}
+
+//给交易池中允许替换的交易提高手续费：用同样的输入和输出重新创建交易并签名，增加的手续费从找零中扣，
+//找零不够时再从发送方的账户（发送地址和它的找零地址）选输出加进来。新交易的费率至少是feeRate（为0时用最低转发费率），并且满足替换规则。
+//交易不在池中返回ErrTxNotFound，不允许替换返回ErrNotReplaceable，输入不全是钱包中的地址返回ErrUnknownAddress
+func NewBumpFeeTransation(txid []byte,feeRate Amount,bc *BlockChain) (*Transation,error){
+	pool := Mempool{bc}
+	entries,err := pool.snapshot()
+	if err != nil{
+		return nil,err
+	}
+	id := hex.EncodeToString(txid)
+	orig,ok := entries[id]
+	if !ok{
+		return nil,fmt.Errorf("%w: %s is not in the mempool",ErrTxNotFound,id)
+	}
+	if !orig.Tx.signalsReplaceable(){
+		return nil,fmt.Errorf("%w: %s",ErrNotReplaceable,id)
+	}
+
+	//被替换的交易和它的后代都会从池中删除，新交易的手续费要比它们的手续费之和高
+	replaced := poolDescendants(entries,id)
+	replaced[id] = true
+	replacedFee,_ := packageFeeSize(entries,replaced)
+
+	prevOuts,err := pool.FindPrevOutputs(orig.Tx)
+	if err != nil{
+		return nil,err
+	}
+	wallets,err := NewWallets()
+	if err != nil{
+		return nil,err
+	}
+	defer wallets.Close()
+
+	//找零是最后一个付给发送方（第一个输入的所有者）或者本钱包找零地址的输出
+	sender := prevOuts[0].PubkeyHash
+	changeHashes := map[string]bool{string(sender): true}
+	for address := range wallets.Change{
+		pubkeyhash,err := GetPubKeyHash(address)
+		if err == nil{
+			changeHashes[string(pubkeyhash)] = true
+		}
+	}
+	changeIdx := -1
+	for i,out := range orig.Tx.Vout{
+		if changeHashes[string(out.PubkeyHash)]{
+			changeIdx = i
+		}
+	}
+
+	//发送方所在的账户：发送方是找零地址时是它所属的发送地址
+	account := ""
+	for address := range wallets.Store{
+		pubkeyhash,err := GetPubKeyHash(address)
+		if err == nil && bytes.Equal(pubkeyhash,sender){
+			account = address
+			break
+		}
+	}
+	if account == ""{
+		return nil,fmt.Errorf("%w: sender of %s is not in this wallet",ErrUnknownAddress,id)
+	}
+	if owner,ok := wallets.Change[account]; ok{
+		account = owner
+	}
+
+	//找零不够时可以追加的输出：和NewUTXOTransation一样是账户中全部地址可以花费的输出，
+	//不能是要删除的交易的输出，金额大的优先
+	var extra []UTXO
+	for _,address := range wallets.AccountAddresses(account){
+		pubkeyhash,err := GetPubKeyHash(address)
+		if err != nil{
+			return nil,err
+		}
+		spendable,err := pool.FindSpendableUTXOs(pubkeyhash)
+		if err != nil{
+			return nil,err
+		}
+		for _,utxo := range spendable{
+			if !replaced[hex.EncodeToString(utxo.TXid)]{
+				extra = append(extra,utxo)
+			}
+		}
+	}
+	sort.SliceStable(extra,func(i,j int) bool { return extra[i].Output.Value > extra[j].Output.Value })
+
+	if feeRate == 0{
+		feeRate = mempoolPolicy.MinRelayFeeRate
+	}
+
+	//和NewUTXOTransation一样，手续费取决于签名后的大小，不够就按算出来的手续费重来
+	fee := replacedFee + 1
+	added := 0
+	for{
+		tx := bumpedTransation(orig.Tx,orig.Fee,extra[:added],changeIdx,fee,sender)
+		if tx == nil{
+			if added == len(extra){
+				return nil,fmt.Errorf("%w: cannot pay fee %s",ErrInsufficientFunds,fee)
+			}
+			added++
+			continue
+		}
+
+		allPrevOuts := append([]TXOutput{},prevOuts...)
+		for _,utxo := range extra[:added]{
+			allPrevOuts = append(allPrevOuts,utxo.Output)
+		}
+		signed,err := signWithWallets(tx,allPrevOuts,wallets,SigHashAll)
+		if err != nil{
+			return nil,err
+		}
+		if signed != len(tx.Vin){
+			return nil,fmt.Errorf("%w: only %d of %d inputs can be signed with this wallet",ErrUnknownAddress,signed,len(tx.Vin))
+		}
+		tx.ID = tx.unsignedID()
+
+		//费率不低于feeRate，高于原交易的费率，手续费比被删除的交易多出至少一个增量
+		size := tx.Size()
+		need := feeForSize(feeRate,size)
+		if rateFee := origRateFee(orig,size); rateFee > need{
+			need = rateFee
+		}
+		if replaceFee := replacedFee + replacementIncrement(mempoolPolicy,size); replaceFee > need{
+			need = replaceFee
+		}
+		if fee >= need{
+			return tx,nil
+		}
+		fee = need
+	}
+}
+
+//size字节的交易按原交易的费率要付的手续费再加一个最小单位，这样新交易的费率一定比原交易高
+//乘积用128位防止溢出，结果超过MaxMoney时返回MaxMoney+1
+func origRateFee(orig *MempoolEntry,size int) Amount{
+	hi,lo := bits.Mul64(uint64(orig.Fee),uint64(size))
+	if hi >= uint64(orig.Size){
+		return MaxMoney + 1
+	}
+	fee,_ := bits.Div64(hi,lo,uint64(orig.Size))
+	if fee >= uint64(MaxMoney){
+		return MaxMoney + 1
+	}
+	return Amount(fee) + 1
+}
+
+//按手续费fee创建未签名的替换交易：输入是原交易的输入加上extra，输出和原交易一样，
+//找零减去多付的手续费，没有找零时多出的金额找零给change。找零不够付手续费时返回nil
+func bumpedTransation(orig *Transation,origFee Amount,extra []UTXO,changeIdx int,fee Amount,change []byte) *Transation{
+	var inputs []TXInput
+	for _,vin := range orig.Vin{
+		inputs = append(inputs,TXInput{vin.TXid,vin.Voutindex,nil,nil,vin.Sequence})
+	}
+	var extraValue Amount
+	for _,utxo := range extra{
+		inputs = append(inputs,TXInput{utxo.TXid,utxo.Voutindex,nil,nil,maxRBFSequence})
+		extraValue += utxo.Output.Value
+	}
+
+	//比原交易多付的手续费，扣掉追加的输入之后还要从找零中扣的部分
+	delta := fee - origFee - extraValue
+	outputs := append([]TXOutput{},orig.Vout...)
+	switch{
+	case changeIdx >= 0:
+		value := outputs[changeIdx].Value - delta
+		if value > 0{
+			outputs[changeIdx].Value = value
+		}else if value == 0 && len(outputs) > 1{
+			outputs = append(outputs[:changeIdx],outputs[changeIdx+1:]...)
+		}else{
+			return nil
+		}
+	case delta > 0:
+		return nil
+	case delta < 0:
+		outputs = append(outputs,TXOutput{-delta,change})
+	}
+	return &Transation{nil,inputs,outputs}
+}
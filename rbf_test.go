@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestCheckReplacement(t *testing.T){
+	policy := DefaultMempoolPolicy()
+	policy.MinRelayFeeRate = 1000
+
+	pool := make(map[string]*MempoolEntry)
+	orig := addPolicyTestEntry(pool,1,200,200,0)
+	orig.Vin[0].Sequence = maxRBFSequence
+	child := addPolicyTestEntry(pool,2,200,200,0,orig)
+	final := addPolicyTestEntry(pool,3,200,200,0)
+	origID,childID,finalID := hex.EncodeToString(orig.ID),hex.EncodeToString(child.ID),hex.EncodeToString(final.ID)
+
+	replacement := func(fee Amount,size int,spends ...*Transation) *MempoolEntry{
+		tx := &Transation{[]byte{9},[]TXInput{{[]byte{0xf0},1,nil,nil,SequenceFinal}},[]TXOutput{{1,nil}}}
+		for _,parent := range spends{
+			tx.Vin = append(tx.Vin,TXInput{parent.ID,0,nil,nil,SequenceFinal})
+		}
+		return &MempoolEntry{tx,fee,size,0}
+	}
+
+	//替换掉原交易和它的子交易，要付两笔的手续费再加上自己大小的最低转发费
+	replaced,err := checkReplacement(pool,map[string]bool{origID: true},replacement(600,200),policy)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(replaced) != 2 || !replaced[origID] || !replaced[childID]{
+		t.Errorf("replaced = %v, want the original and its child",replaced)
+	}
+
+	tests := []struct{
+		name      string
+		conflicts string
+		entry     *MempoolEntry
+		want      error
+	}{
+		{"not signaling",finalID,replacement(1000,200),ErrNotReplaceable},
+		{"same fee rate",origID,replacement(400,400),ErrFeeTooLow},
+		{"fee below package plus increment",origID,replacement(599,200),ErrFeeTooLow},
+		{"spends a replaced output",origID,replacement(1000,200,child),ErrMempoolConflict},
+	}
+	for _,tt := range tests{
+		_,err := checkReplacement(pool,map[string]bool{tt.conflicts: true},tt.entry,policy)
+		if !errors.Is(err,tt.want){
+			t.Errorf("%s: err = %v, want %v",tt.name,err,tt.want)
+		}
+	}
+}
+
+//提高手续费后原交易被替换，原交易不能再回到交易池；不允许替换的交易不能提高手续费
+func TestBumpFee(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	mempoolPolicy.MinRelayFeeRate = 10
+	b,_ := ws.CreateWallet(DefaultCurve)
+	c,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	cli := CLI{bc}
+	pool := Mempool{bc}
+
+	if err := cli.send(addr,b,10*Coin,SendOptions{},false); err != nil{
+		t.Fatal(err)
+	}
+	entries,_ := pool.Entries()
+	if _,err := NewBumpFeeTransation(entries[0].Tx.ID,0,bc); !errors.Is(err,ErrNotReplaceable){
+		t.Errorf("bumping a final transation: err = %v, want ErrNotReplaceable",err)
+	}
+	if err := cli.mine(c); err != nil{
+		t.Fatal(err)
+	}
+
+	if err := cli.send(addr,b,10*Coin,SendOptions{Replaceable: true},false); err != nil{
+		t.Fatal(err)
+	}
+	entries,_ = pool.Entries()
+	orig := entries[0]
+	if err := cli.bumpFee(hex.EncodeToString(orig.Tx.ID),0); err != nil{
+		t.Fatal(err)
+	}
+	entries,_ = pool.Entries()
+	if len(entries) != 1 || string(entries[0].Tx.ID) == string(orig.Tx.ID){
+		t.Fatalf("mempool has %d transations after bumpFee, want only the replacement",len(entries))
+	}
+	repl := entries[0]
+	if repl.Fee <= orig.Fee || compareFeeRate(repl.Fee,repl.Size,orig.Fee,orig.Size) <= 0{
+		t.Errorf("replacement fee %s for %d bytes does not exceed %s for %d bytes",repl.Fee,repl.Size,orig.Fee,orig.Size)
+	}
+	if err := pool.Add(orig.Tx); !errors.Is(err,ErrFeeTooLow){
+		t.Errorf("re-adding the replaced transation: err = %v, want ErrFeeTooLow",err)
+	}
+
+	if err := cli.bumpFee(hex.EncodeToString(repl.Tx.ID),100); err != nil{
+		t.Fatal(err)
+	}
+	entries,_ = pool.Entries()
+	if rate := feeRate(entries[0].Fee,entries[0].Size); rate < 100{
+		t.Errorf("fee rate after bumpFee -feerate 100 is %.2f",rate)
+	}
+	if err := cli.mine(c); err != nil{
+		t.Fatal(err)
+	}
+	if got,_ := cli.GetBalance(b); got != 20*Coin{
+		t.Errorf("balance of b = %s, want 20",got)
+	}
+}
+
+//没有找零的交易提高手续费时，从发送方的账户中加一个输入，多出的金额找零
+func TestBumpFeeAddsAccountInput(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	mempoolPolicy.MinRelayFeeRate = 10
+	b,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	cli := CLI{bc}
+	pool := Mempool{bc}
+
+	//先转一笔，发送方的账户里就有了找零地址上的输出
+	if err := cli.send(addr,b,10*Coin,SendOptions{},true); err != nil{
+		t.Fatal(err)
+	}
+	if err := cli.mine(addr); err != nil{
+		t.Fatal(err)
+	}
+	set := UTXOSet{bc}
+	utxos,err := set.FindSpendableUTXOs(HashPubKey(ws.Store[addr].PublicKey))
+	if err != nil || len(utxos) == 0{
+		t.Fatal(len(utxos),err)
+	}
+	u := utxos[0]
+	tx := &Transation{nil,[]TXInput{{u.TXid,u.Voutindex,nil,nil,maxRBFSequence}},[]TXOutput{{u.Output.Value - 10000,HashPubKey(ws.Store[b].PublicKey)}}}
+	prev,err := set.FindPrevOutputs(tx)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _,err := signWithWallets(tx,prev,ws,SigHashAll); err != nil{
+		t.Fatal(err)
+	}
+	tx.ID = tx.unsignedID()
+	if err := pool.Add(tx); err != nil{
+		t.Fatal(err)
+	}
+
+	bumped,err := NewBumpFeeTransation(tx.ID,0,bc)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(bumped.Vin) != 2 || len(bumped.Vout) != 2{
+		t.Fatalf("bumped transation has %d inputs and %d outputs, want 2 and 2",len(bumped.Vin),len(bumped.Vout))
+	}
+	if err := pool.Add(bumped); err != nil{
+		t.Fatal(err)
+	}
+}
+
+//序列号也在签名的范围内，改成SequenceFinal后签名失效
+func TestSequenceCommitted(t *testing.T){
+	_,ws,addr := newTestChain(t)
+	w := ws.Store[addr]
+	pkh := HashPubKey(w.PublicKey)
+	tx := &Transation{nil,[]TXInput{{[]byte{1},0,nil,w.PublicKey,maxRBFSequence}},[]TXOutput{{1,pkh}}}
+	prev := TXOutput{5,pkh}
+	if err := tx.SignInput(0,w.PrivateKey,prev,SigHashAll); err != nil{
+		t.Fatal(err)
+	}
+	if err := tx.VerifyInput(0,prev); err != nil{
+		t.Fatal(err)
+	}
+	tx.Vin[0].Sequence = SequenceFinal
+	if err := tx.VerifyInput(0,prev); err == nil{
+		t.Error("signature still verifies after the sequence changed")
+	}
+}
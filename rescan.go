@@ -0,0 +1,108 @@
+package main
+
+import "fmt"
+
+//重新扫描的进度回调，每处理完一个区块调用一次，返回false时中止扫描
+type RescanProgress func(height,from,to int32) bool
+
+//重新扫描区块链上高度在[from,to]之间的区块，to<0表示到最高区块。
+//只遍历一次区块，同时检查钱包中的全部地址（包括只读地址），重建这些区块的交易记录，
+//钱包的未花费输出由交易记录得出，见ListUnspent。
+//中止时返回ErrRescanAborted和最后处理完的高度，还没扫描到的区块保留原来的记录
+func (ws *Wallets) RescanBlockchain(bc *BlockChain,from,to int32,progress RescanProgress) (int32,error){
+	best,err := bc.GetBestHeight()
+	if err != nil{
+		return 0,err
+	}
+	if to < 0{
+		to = best
+	}
+	if from < 0 || from > to || to > best{
+		return 0,fmt.Errorf("invalid rescan range %d-%d, best height is %d",from,to,best)
+	}
+
+	//从最高区块往回找到范围内的区块，再按高度从低到高处理
+	var blocks []*Block
+	bci := bc.iterator()
+	for{
+		block,err := bci.Next()
+		if err != nil{
+			return 0,err
+		}
+		if block.Height <= to{
+			blocks = append(blocks,block)
+		}
+		if block.Height <= from || len(block.PrevBlockHash) == 0{
+			break
+		}
+	}
+
+	//范围内原来的记录按高度分组，处理到这个高度时再删掉。扫描到最高区块时，
+	//更高的记录是被挤掉的分叉上的，也一起删掉
+	stale := make(map[int32][]string)
+	for txid,wtx := range ws.History{
+		if wtx.Height >= from && (wtx.Height <= to || to == best){
+			stale[wtx.Height] = append(stale[wtx.Height],txid)
+		}
+	}
+
+	owned := ws.ownedPubKeyHashes()
+	height := from - 1
+	for i := len(blocks) - 1; i >= 0; i--{
+		block := blocks[i]
+		for _,txid := range stale[block.Height]{
+			delete(ws.History,txid)
+		}
+		err = ws.recordBlock(bc,block,owned)
+		if err != nil{
+			return height,err
+		}
+		height = block.Height
+		if progress != nil && !progress(height,from,to){
+			return height,fmt.Errorf("%w at height %d",ErrRescanAborted,height)
+		}
+	}
+	if to == best{
+		for h,txids := range stale{
+			if h > best{
+				for _,txid := range txids{
+					delete(ws.History,txid)
+				}
+			}
+		}
+		ws.HistoryTip = blocks[0].Hash
+	}
+	return height,nil
+}
+
+//钱包的未花费输出：交易记录中付给本钱包地址、还没有被记录中的交易花掉的输出，按高度排列
+func (ws *Wallets) ListUnspent() []UTXO{
+	spent := make(map[string]bool)
+	for _,wtx := range ws.History{
+		for _,in := range wtx.Spends{
+			spent[outpointKey(in.TXid,in.Voutindex)] = true
+		}
+	}
+	owned := ws.ownedPubKeyHashes()
+	var UTXOs []UTXO
+	for _,wtx := range ws.ListTransactions(){
+		for index,out := range wtx.Outputs{
+			if _,ok := owned[string(out.PubkeyHash)]; !ok || spent[outpointKey(wtx.TxID,index)]{
+				continue
+			}
+			UTXOs = append(UTXOs,UTXO{TXid: wtx.TxID,Voutindex: index,Output: out})
+		}
+	}
+	return UTXOs
+}
+
+//交易记录中某个高度范围内的交易数，用来报告扫描结果
+func (ws *Wallets) historyCount(from,to int32) int{
+	count := 0
+	for _,wtx := range ws.History{
+		if wtx.Height >= from && wtx.Height <= to{
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"math/big"
+	"sync"
+)
+
+//比特币使用的secp256k1曲线：y² = x³ + 7，用math/big实现的纯Go版本。
+//标准库elliptic.CurveParams的通用算法假定a=-3，不能用在a=0的secp256k1上，所以这里自己实现点运算。
+//注意big.Int的运算不是常数时间的，这个实现适合学习和测试，不适合在不可信的环境中保护大额私钥。
+type secp256k1Curve struct{
+	params *elliptic.CurveParams
+
+	baseOnce  sync.Once
+	baseTable *[baseWindows][windowSize]jacobianPoint //baseTable[i][j] = j * 16^i * G，仿射坐标（Z=1）
+}
+
+//标量乘法按4位一个窗口处理，256位的标量分成64个窗口
+const (
+	windowBits  = 4
+	windowSize  = 1 << windowBits
+	baseWindows = 256 / windowBits
+)
+
+var (
+	secp256k1Once     sync.Once
+	secp256k1Instance *secp256k1Curve
+)
+
+//返回secp256k1曲线，全局只有一个实例
+func S256() elliptic.Curve{
+	secp256k1Once.Do(func(){
+		params := &elliptic.CurveParams{Name: "secp256k1",BitSize: 256}
+		params.P,_ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEFFFFFC2F",16)
+		params.N,_ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141",16)
+		params.B = big.NewInt(7)
+		params.Gx,_ = new(big.Int).SetString("79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",16)
+		params.Gy,_ = new(big.Int).SetString("483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8",16)
+		secp256k1Instance = &secp256k1Curve{params: params}
+	})
+	return secp256k1Instance
+}
+
+func (c *secp256k1Curve) Params() *elliptic.CurveParams{
+	return c.params
+}
+
+//检查点是否在曲线上：y² = x³ + 7 (mod p)
+func (c *secp256k1Curve) IsOnCurve(x,y *big.Int) bool{
+	return isOnCurve(c,x,y)
+}
+
+//两点相加，仿射坐标进出，内部用雅可比坐标计算
+func (c *secp256k1Curve) Add(x1,y1,x2,y2 *big.Int) (*big.Int,*big.Int){
+	p1 := c.toJacobian(x1,y1)
+	p2 := c.toJacobian(x2,y2)
+	return c.toAffine(c.addJacobian(p1,p2))
+}
+
+//点加倍
+func (c *secp256k1Curve) Double(x1,y1 *big.Int) (*big.Int,*big.Int){
+	return c.toAffine(c.doubleJacobian(c.toJacobian(x1,y1)))
+}
+
+//标量乘法 k*(Bx,By)，k是大端字节
+func (c *secp256k1Curve) ScalarMult(Bx,By *big.Int,k []byte) (*big.Int,*big.Int){
+	return c.toAffine(c.scalarMultJacobian(Bx,By,k))
+}
+
+//标量乘以基点G，也就是由私钥计算公钥
+func (c *secp256k1Curve) ScalarBaseMult(k []byte) (*big.Int,*big.Int){
+	return c.toAffine(c.scalarBaseMultJacobian(k))
+}
+
+//计算 baseScalar*G + scalar*(Bx,By)，verifyECDSA用它验证签名，
+//两个乘积在雅可比坐标下相加，只在最后求一次模逆
+func (c *secp256k1Curve) CombinedMult(Bx,By *big.Int,baseScalar,scalar []byte) (*big.Int,*big.Int){
+	return c.toAffine(c.addJacobian(c.scalarBaseMultJacobian(baseScalar),c.scalarMultJacobian(Bx,By,scalar)))
+}
+
+//固定窗口法：先算出基点的1到15倍，从最高的窗口开始，每个窗口先加倍4次，再加上窗口值倍的基点
+func (c *secp256k1Curve) scalarMultJacobian(Bx,By *big.Int,k []byte) jacobianPoint{
+	var multiples [windowSize]jacobianPoint
+	multiples[1] = c.toJacobian(Bx,By)
+	for j := 2; j < windowSize; j++{
+		multiples[j] = c.addJacobian(multiples[j-1],multiples[1])
+	}
+
+	result := jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+	for _,b := range k{
+		for _,window := range [2]byte{b >> windowBits,b & (windowSize - 1)}{
+			for i := 0; i < windowBits; i++{
+				result = c.doubleJacobian(result)
+			}
+			if window != 0{
+				result = c.addJacobian(result,multiples[window])
+			}
+		}
+	}
+	return result
+}
+
+//基点的标量乘法查表：每个窗口直接加上表中的点，不需要加倍，最多64次点加
+func (c *secp256k1Curve) scalarBaseMultJacobian(k []byte) jacobianPoint{
+	table := c.baseMultTable()
+	result := jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+
+	//表只有64个窗口，超过32字节的标量先对n取模，n*G是无穷远点，结果不变
+	if len(k) > 32{
+		k = new(big.Int).Mod(new(big.Int).SetBytes(k),c.params.N).Bytes()
+	}
+	window := 0
+	for i := len(k) - 1; i >= 0; i--{
+		for _,w := range [2]byte{k[i] & (windowSize - 1),k[i] >> windowBits}{
+			if w != 0{
+				result = c.addJacobian(result,table[window][w])
+			}
+			window++
+		}
+	}
+	return result
+}
+
+//第一次用到时计算基点的倍数表，转换成仿射坐标，点加时可以省掉Z2的运算
+func (c *secp256k1Curve) baseMultTable() *[baseWindows][windowSize]jacobianPoint{
+	c.baseOnce.Do(func(){
+		table := new([baseWindows][windowSize]jacobianPoint)
+		base := c.toJacobian(c.params.Gx,c.params.Gy)
+		for i := 0; i < baseWindows; i++{
+			table[i][0] = jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+			point := base
+			for j := 1; j < windowSize; j++{
+				x,y := c.toAffine(point)
+				table[i][j] = c.toJacobian(x,y)
+				point = c.addJacobian(point,base)
+			}
+			//下一个窗口的基点是 16^(i+1) * G
+			base = point
+		}
+		c.baseTable = table
+	})
+	return c.baseTable
+}
+
+//雅可比坐标 (X, Y, Z) 表示仿射坐标 (X/Z², Y/Z³)，Z=0是无穷远点。
+//这样点加和加倍都不需要求模逆，只在最后转换回仿射坐标时求一次
+type jacobianPoint struct{
+	x,y,z *big.Int
+}
+
+//仿射坐标转雅可比坐标，按照elliptic包的约定(0,0)表示无穷远点
+func (c *secp256k1Curve) toJacobian(x,y *big.Int) jacobianPoint{
+	if x.Sign() == 0 && y.Sign() == 0{
+		return jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+	}
+	return jacobianPoint{new(big.Int).Set(x),new(big.Int).Set(y),big.NewInt(1)}
+}
+
+//p = 2^256 - 2^32 - 977，所以 2^256 ≡ 2^32 + 977 (mod p)
+var (
+	secp256k1PrimeDelta = big.NewInt(1<<32 + 977)
+	mask256             = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1),256),big.NewInt(1))
+)
+
+//x对p取模，结果写回x。256位以上的部分乘上2^32+977加回低256位，只用移位和小数乘法，
+//比通用的除法快得多。x可以是负数
+func (c *secp256k1Curve) mod(x *big.Int) *big.Int{
+	P := c.params.P
+	neg := x.Sign() < 0
+	if neg{
+		x.Neg(x)
+	}
+	for x.BitLen() > 256{
+		hi := new(big.Int).Rsh(x,256)
+		x.And(x,mask256)
+		x.Add(x,hi.Mul(hi,secp256k1PrimeDelta))
+	}
+	if x.Cmp(P) >= 0{
+		x.Sub(x,P)
+	}
+	if neg && x.Sign() != 0{
+		x.Sub(P,x)
+	}
+	return x
+}
+
+//雅可比坐标转回仿射坐标
+func (c *secp256k1Curve) toAffine(p jacobianPoint) (*big.Int,*big.Int){
+	if p.z.Sign() == 0{
+		return new(big.Int),new(big.Int)
+	}
+	P := c.params.P
+	zinv := new(big.Int).ModInverse(p.z,P)
+	zinv2 := new(big.Int).Mul(zinv,zinv)
+
+	x := new(big.Int).Mul(p.x,zinv2)
+	c.mod(x)
+
+	zinv2.Mul(zinv2,zinv)
+	y := new(big.Int).Mul(p.y,zinv2)
+	c.mod(y)
+	return x,y
+}
+
+//雅可比坐标点加倍，a=0时的公式（dbl-2009-l）
+func (c *secp256k1Curve) doubleJacobian(p jacobianPoint) jacobianPoint{
+	if p.z.Sign() == 0 || p.y.Sign() == 0{
+		return jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+	}
+
+	a := new(big.Int).Mul(p.x,p.x) //A = X1²
+	c.mod(a)
+	b := new(big.Int).Mul(p.y,p.y) //B = Y1²
+	c.mod(b)
+	cc := new(big.Int).Mul(b,b) //C = B²
+	c.mod(cc)
+
+	d := new(big.Int).Add(p.x,b) //D = 2*((X1+B)²-A-C)
+	d.Mul(d,d)
+	d.Sub(d,a)
+	d.Sub(d,cc)
+	d.Lsh(d,1)
+	c.mod(d)
+
+	e := new(big.Int).Mul(big.NewInt(3),a) //E = 3*A
+	f := new(big.Int).Mul(e,e)             //F = E²
+
+	x3 := new(big.Int).Sub(f,new(big.Int).Lsh(d,1)) //X3 = F-2*D
+	c.mod(x3)
+
+	y3 := new(big.Int).Sub(d,x3) //Y3 = E*(D-X3)-8*C
+	y3.Mul(y3,e)
+	y3.Sub(y3,new(big.Int).Lsh(cc,3))
+	c.mod(y3)
+
+	z3 := new(big.Int).Mul(p.y,p.z) //Z3 = 2*Y1*Z1
+	z3.Lsh(z3,1)
+	c.mod(z3)
+
+	return jacobianPoint{x3,y3,z3}
+}
+
+//雅可比坐标点加（add-2007-bl）
+func (c *secp256k1Curve) addJacobian(p1,p2 jacobianPoint) jacobianPoint{
+	if p1.z.Sign() == 0{
+		return p2
+	}
+	if p2.z.Sign() == 0{
+		return p1
+	}
+	//p2是仿射坐标（Z2=1）时，Z2相关的乘法都可以省掉（madd-2007-bl）
+	affine := p2.z.IsInt64() && p2.z.Int64() == 1
+
+	z1z1 := new(big.Int).Mul(p1.z,p1.z)
+	c.mod(z1z1)
+	z2z2 := big.NewInt(1)
+	u1 := p1.x
+	s1 := p1.y
+	if !affine{
+		z2z2.Mul(p2.z,p2.z)
+		c.mod(z2z2)
+		u1 = new(big.Int).Mul(p1.x,z2z2)
+		c.mod(u1)
+		s1 = new(big.Int).Mul(p1.y,p2.z)
+		s1.Mul(s1,z2z2)
+		c.mod(s1)
+	}
+	u2 := new(big.Int).Mul(p2.x,z1z1)
+	c.mod(u2)
+
+	s2 := new(big.Int).Mul(p2.y,p1.z)
+	s2.Mul(s2,z1z1)
+	c.mod(s2)
+
+	h := new(big.Int).Sub(u2,u1)
+	c.mod(h)
+	r := new(big.Int).Sub(s2,s1)
+	c.mod(r)
+
+	//x坐标相同：要么是同一个点（改为加倍），要么互为相反数（结果是无穷远点）
+	if h.Sign() == 0{
+		if r.Sign() == 0{
+			return c.doubleJacobian(p1)
+		}
+		return jacobianPoint{new(big.Int),new(big.Int),new(big.Int)}
+	}
+	r.Lsh(r,1)
+
+	i := new(big.Int).Lsh(h,1) //I = (2*H)²
+	i.Mul(i,i)
+	c.mod(i)
+	j := new(big.Int).Mul(h,i) //J = H*I
+	c.mod(j)
+	v := new(big.Int).Mul(u1,i) //V = U1*I
+	c.mod(v)
+
+	x3 := new(big.Int).Mul(r,r) //X3 = r²-J-2*V
+	x3.Sub(x3,j)
+	x3.Sub(x3,new(big.Int).Lsh(v,1))
+	c.mod(x3)
+
+	y3 := new(big.Int).Sub(v,x3) //Y3 = r*(V-X3)-2*S1*J
+	y3.Mul(y3,r)
+	s1j := new(big.Int).Mul(s1,j)
+	y3.Sub(y3,s1j.Lsh(s1j,1))
+	c.mod(y3)
+
+	var z3 *big.Int
+	if affine{
+		z3 = new(big.Int).Lsh(p1.z,1) //Z3 = 2*Z1*H
+	}else{
+		z3 = new(big.Int).Add(p1.z,p2.z) //Z3 = ((Z1+Z2)²-Z1Z1-Z2Z2)*H
+		z3.Mul(z3,z3)
+		z3.Sub(z3,z1z1)
+		z3.Sub(z3,z2z2)
+	}
+	z3.Mul(z3,h)
+	c.mod(z3)
+
+	return jacobianPoint{x3,y3,z3}
+}
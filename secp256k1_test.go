@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func mustHexInt(t testing.TB,s string) *big.Int{
+	t.Helper()
+	v,ok := new(big.Int).SetString(s,16)
+	if !ok{
+		t.Fatalf("bad hex %q",s)
+	}
+	return v
+}
+
+//k*G的已知结果
+func TestScalarBaseMultKnownAnswers(t *testing.T){
+	curve := S256()
+	nMinus1 := new(big.Int).Sub(curve.Params().N,big.NewInt(1))
+
+	tests := []struct{
+		k    *big.Int
+		x,y string
+	}{
+		{big.NewInt(1),
+			"79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+			"483ADA7726A3C4655DA4FBFC0E1108A8FD17B448A68554199C47D08FFB10D4B8"},
+		{big.NewInt(2),
+			"C6047F9441ED7D6D3045406E95C07CD85C778E4B8CEF3CA7ABAC09B95C709EE5",
+			"1AE168FEA63DC339A3C58419466CEAEEF7F632653266D0E1236431A950CFE52A"},
+		{big.NewInt(3),
+			"F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9",
+			"388F7B0F632DE8140FE337E62A37F3566500A99934C2231B6CB9FD7584B8E672"},
+		{big.NewInt(20),
+			"4CE119C96E2FA357200B559B2F7DD5A5F02D5290AFF74B03F3E471B273211C97",
+			"12BA26DCB10EC1625DA61FA10A844C676162948271D96967450288EE9233DC3A"},
+		{big.NewInt(112233445566778899),
+			"A90CC3D3F3E146DAADFC74CA1372207CB4B725AE708CEF713A98EDD73D99EF29",
+			"5A79D6B289610C68BC3B47F3D72F9788A26A06868B4D8E433E1E2AD76FB7DC76"},
+		{nMinus1,
+			"79BE667EF9DCBBAC55A06295CE870B07029BFCDB2DCE28D959F2815B16F81798",
+			"B7C52588D95C3B9AA25B0403F1EEF75702E84BB7597AABE663B82F6F04EF2777"},
+	}
+	for _,tt := range tests{
+		wantX,wantY := mustHexInt(t,tt.x),mustHexInt(t,tt.y)
+
+		x,y := curve.ScalarBaseMult(tt.k.Bytes())
+		if x.Cmp(wantX) != 0 || y.Cmp(wantY) != 0{
+			t.Errorf("ScalarBaseMult(%x) = (%x, %x), want (%x, %x)",tt.k,x,y,wantX,wantY)
+		}
+
+		//窗口法的ScalarMult必须和查表的ScalarBaseMult一致
+		x,y = curve.ScalarMult(curve.Params().Gx,curve.Params().Gy,tt.k.Bytes())
+		if x.Cmp(wantX) != 0 || y.Cmp(wantY) != 0{
+			t.Errorf("ScalarMult(G, %x) = (%x, %x), want (%x, %x)",tt.k,x,y,wantX,wantY)
+		}
+	}
+}
+
+func TestScalarMultEdgeCases(t *testing.T){
+	curve := S256()
+	params := curve.Params()
+
+	//n*G是无穷远点
+	x,y := curve.ScalarBaseMult(params.N.Bytes())
+	if x.Sign() != 0 || y.Sign() != 0{
+		t.Errorf("ScalarBaseMult(n) = (%x, %x), want infinity",x,y)
+	}
+
+	//超过32字节的标量先对n取模
+	k := new(big.Int).Add(params.N,big.NewInt(2))
+	long := append([]byte{0},k.Bytes()...)
+	x,y = curve.ScalarBaseMult(long)
+	wantX,wantY := curve.Double(params.Gx,params.Gy)
+	if x.Cmp(wantX) != 0 || y.Cmp(wantY) != 0{
+		t.Errorf("ScalarBaseMult(n+2) = (%x, %x), want 2G",x,y)
+	}
+
+	//CombinedMult(P, a, b) = a*G + b*P
+	px,py := curve.ScalarBaseMult([]byte{7})
+	cm := curve.(interface{
+		CombinedMult(Bx,By *big.Int,baseScalar,scalar []byte) (*big.Int,*big.Int)
+	})
+	x,y = cm.CombinedMult(px,py,[]byte{5},[]byte{3})
+	wantX,wantY = curve.ScalarBaseMult([]byte{26})
+	if x.Cmp(wantX) != 0 || y.Cmp(wantY) != 0{
+		t.Errorf("CombinedMult = (%x, %x), want 26G",x,y)
+	}
+}
+
+//RFC6979的k和签名，向量与比特币各实现使用的一致，签名已经是low-S
+func TestRFC6979KnownAnswers(t *testing.T){
+	tests := []struct{
+		d,msg,k,r,s string
+	}{
+		{"1","Satoshi Nakamoto",
+			"8F8A276C19F4149656B280621E358CCE24F5F52542772691EE69063B74F15D15",
+			"934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8",
+			"2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"},
+		{"1","All those moments will be lost in time, like tears in rain. Time to die...",
+			"38AA22D72376B4DBC472E06C3BA403EE0A394DA63FC58D88686C611ABA98D6B3",
+			"8600dbd41e348fe5c9465ab92d23e3db8b98b873beecd930736488696438cb6b",
+			"547fe64427496db33bf66019dacbf0039c04199abb0122918601db38a72cfc21"},
+	}
+	curve := S256()
+	for _,tt := range tests{
+		d := mustHexInt(t,tt.d)
+		hash := sha256.Sum256([]byte(tt.msg))
+
+		k := rfc6979Nonces(d,hash[:],curve.Params().N)()
+		if k.Cmp(mustHexInt(t,tt.k)) != 0{
+			t.Errorf("%q: k = %x, want %s",tt.msg,k,tt.k)
+		}
+
+		priv := &ecdsa.PrivateKey{D: d}
+		priv.Curve = curve
+		priv.X,priv.Y = curve.ScalarBaseMult(d.Bytes())
+		r,s,err := signHash(priv,hash[:])
+		if err != nil{
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(r.FillBytes(make([]byte,32))) != tt.r ||
+			hex.EncodeToString(s.FillBytes(make([]byte,32))) != tt.s{
+			t.Errorf("%q: signature = (%x, %x), want (%s, %s)",tt.msg,r,s,tt.r,tt.s)
+		}
+		if !ecdsa.Verify(&priv.PublicKey,hash[:],r,s){
+			t.Errorf("%q: signature does not verify",tt.msg)
+		}
+	}
+}
+
+func BenchmarkScalarBaseMult(b *testing.B){
+	curve := S256()
+	k := sha256.Sum256([]byte("scalar"))
+	for i := 0; i < b.N; i++{
+		curve.ScalarBaseMult(k[:])
+	}
+}
+
+func BenchmarkScalarMult(b *testing.B){
+	curve := S256()
+	px,py := curve.ScalarBaseMult([]byte{7})
+	k := sha256.Sum256([]byte("scalar"))
+	for i := 0; i < b.N; i++{
+		curve.ScalarMult(px,py,k[:])
+	}
+}
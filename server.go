@@ -3,10 +3,13 @@ package main
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log"
 	"net"
+	"sync"
 )
 
 //定义版本信息， 用于网络节点间的版本查询
@@ -43,6 +46,12 @@ type BlockCMDData struct {
 	Block []byte
 }
 
+//发送交易数据专用结构体
+type TxCMDData struct {
+	AddrFrom    string   //命令发送方地址，用于对方应答回来
+	Transation  []byte   //序列化的交易
+}
+
 const nodeversion = 0x00
 const cmdLength   = 12    //命令字固定长度10字节，方便接收方解析
 var nodeAddress string    //程序使用的本机IP+端口
@@ -52,21 +61,37 @@ var  knownNodes = []string{"localhost:3000"}
 
 var blockInTransit [][]byte  //这个保存的是外部公共节点的全部区块Hash值，用于不断的发出下载区块命令的。
 
+//每个连接在自己的协程中处理，knownNodes和blockInTransit的读写都要先加这个锁，
+//发送命令时不持有锁（sendData连接失败时还要删除节点）
+var nodesMutex sync.Mutex
+
+var miningAddress string      //本节点是矿工时的挖矿奖励地址，为空表示不挖矿
+const minerTxThreshold = 2    //交易池中至少有这么多笔交易时矿工才开始挖矿
+var miningMutex sync.Mutex    //同时收到多笔交易时，一次只挖一个区块
+
 
 //-----------------------------------------------
 
 
 //启动节点的服务器程序, 参数nodeID就是端口号
-func StartServer(nodeID, minerAddrerss string, bc *BlockChain){
+func StartServer(nodeID, minerAddrerss string, bc *BlockChain) error{
 	nodeAddress = fmt.Sprintf("localhost:%s",nodeID)
+	miningAddress = minerAddrerss
 
 	listen,err := net.Listen("tcp",nodeAddress)
-	checkErr(err)
+	if err != nil{
+		return err
+	}
 	defer listen.Close()
 
 	//如果本程序监听的IP:port不是公共节点，就向公共节点发送自己的版本信息
-	if nodeAddress != knownNodes[0]{
-		sendVersion(knownNodes[0],bc)
+	//公共节点暂时连不上不影响本节点启动，打印出来就行
+	centralNode := getKnownNodes()[0]
+	if nodeAddress != centralNode{
+		err = sendVersion(centralNode,bc)
+		if err != nil{
+			fmt.Println("StartServer():",err)
+		}
 	}
 
 	for{
@@ -79,216 +104,350 @@ func StartServer(nodeID, minerAddrerss string, bc *BlockChain){
 	}
 }
 
-//处理其他节点的请求命令
+//处理其他节点的请求命令。处理出错只打印错误并关闭这个连接，不能让一个坏消息把整个节点搞崩溃
 func HandleConnection(conn net.Conn, bc *BlockChain) {
-	request,err := ioutil.ReadAll(conn) //读取全部数据
-	checkErr(err)
+	defer conn.Close()
+
+	//读取全部数据，最多多读一个字节，用来判断消息是否超过上限
+	maxSize := chainParams.MaxMessageSize()
+	request,err := ioutil.ReadAll(io.LimitReader(conn,int64(maxSize)+1))
+	if err != nil{
+		fmt.Println("HandleConnection():",err)
+		return
+	}
+	if len(request) > maxSize{
+		fmt.Printf("HandleConnection(): %v: message from %s exceeds %d bytes\n",ErrInvalidMessage,conn.RemoteAddr(),maxSize)
+		return
+	}
+	if len(request) < cmdLength{
+		fmt.Printf("HandleConnection(): %v: message is only %d bytes\n",ErrInvalidMessage,len(request))
+		return
+	}
 
 	//解析命令
 	cmd := bytesToCmd(request[:cmdLength])
 	fmt.Println("HandleConnection(): cmd=",cmd)
 	switch cmd{
 	case "version":
-		handleVersion(request,bc)
+		err = handleVersion(request,bc)
 	case "getblocks":
-		handleGetBlocks(request,bc)
+		err = handleGetBlocks(request,bc)
 	case "inv":
-		handleInv(request,bc)
+		err = handleInv(request,bc)
 	case "getdata":
-		handleGetData(request,bc)
+		err = handleGetData(request,bc)
 	case "blockdata":
-		handleBlockData(request,bc)
+		err = handleBlockData(request,bc)
+	case "tx":
+		err = handleTx(request,bc)
+	default:
+		err = fmt.Errorf("%w: unknown command %q",ErrInvalidMessage,cmd)
+	}
+	if err != nil{
+		fmt.Printf("HandleConnection(): %s from %s: %v\n",cmd,conn.RemoteAddr(),err)
 	}
 }
 
+//解析命令数据的内容，数据格式不对返回ErrInvalidMessage
+func decodePayload(request []byte, payload interface{}) error{
+	dec := gob.NewDecoder(bytes.NewReader(request[cmdLength:]))
+	err := dec.Decode(payload)
+	if err != nil{
+		return fmt.Errorf("%w: %v",ErrInvalidMessage,err)
+	}
+	return nil
+}
+
 //处理收到的version版本命令
-func handleVersion(request []byte, bc *BlockChain) {
-	var buff bytes.Buffer
+func handleVersion(request []byte, bc *BlockChain) error{
 	var payload Version
 
-	buff.Write(request[cmdLength:]) //提取命令数据的内容
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	checkErr(err)
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
 	fmt.Printf("handleVersion(), receive ‘version’ \n")
 	payload.toString() //显示收到的Version数据
 
-	myBestHeight := bc.GetBestHeight()
+	myBestHeight,err := bc.GetBestHeight()
+	if err != nil{
+		return err
+	}
 	foreignerBestHeight := payload.BestHeight
 
 	fmt.Printf("myBestHeight=%d, foreignerBestHeight=%d\n",myBestHeight,foreignerBestHeight)
 	if myBestHeight < foreignerBestHeight{
 		//说明本节点的区块高度小，需要从外部节点获取新的区块
-		sendGetBlocks(payload.AddrFrom, myBestHeight+1,foreignerBestHeight)
+		err = sendGetBlocks(payload.AddrFrom, myBestHeight+1,foreignerBestHeight)
 
 	}else{
 		//说明本节点的区块高度大，把自己的版本信息发给外部节点
 		fmt.Printf("发送Version to:%s\n", payload.AddrFrom)
-		sendVersion(payload.AddrFrom,bc)
+		err = sendVersion(payload.AddrFrom,bc)
 	}
-
-	//无论区块高度大小，都说明这个外部节点是一个可用的节点，添加到公共节点列表中
-	if !nodeIsKnow(payload.AddrFrom){
-		knownNodes = append(knownNodes, payload.AddrFrom)
+	if err != nil{
+		return err
 	}
 
+	//无论区块高度大小，都说明这个外部节点是一个可用的节点，添加到公共节点列表中
+	addKnownNode(payload.AddrFrom)
+	return nil
 }
 
 //处理收到的getblocks命令， 发送inv命令，携带全部区块hash值
-func handleGetBlocks(request []byte, bc *BlockChain) {
-	var buff bytes.Buffer
+func handleGetBlocks(request []byte, bc *BlockChain) error{
 	var payload GetBlocks
 
-	buff.Write(request[cmdLength:]) //提取命令数据的内容
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	checkErr(err)
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
 	fmt.Printf("handleGetBlocks(), receive ‘getblocks’ \n")
 	fmt.Printf("     low=%d, high=%d\n",payload.LowHeight,payload.HighHeight)
 
 
-	blockhash:=bc.GetBlockHashScope(payload.LowHeight,payload.HighHeight)
-	sendInv(payload.AddrFrom,"block",blockhash)
+	blockhash,err:=bc.GetBlockHashScope(payload.LowHeight,payload.HighHeight)
+	if err != nil{
+		return err
+	}
+	return sendInv(payload.AddrFrom,"block",blockhash)
 }
 
 //处理收到的inv命令， 发送getdata命令，携带指定的区块hash，表示要下载这个区块的数据
-func handleInv(request []byte, bc *BlockChain) {
-	var buff bytes.Buffer
+func handleInv(request []byte, bc *BlockChain) error{
 	var payload Inv
 
-	buff.Write(request[cmdLength:]) //提取命令数据的内容
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	checkErr(err)
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
 	fmt.Printf("handleInv(), receive inventory %d, %s \n",len(payload.Items),payload.Type)
 
 	if payload.Type == "block"{
-		blockInTransit = payload.Items
-		blockHash := payload.Items[0]  //这是最新区块的hash
-		sendGetData(payload.AddrFrom,"block",blockHash)   //请求下载这个最新区块
-
+		if len(payload.Items) == 0{
+			return fmt.Errorf("%w: empty block inventory",ErrInvalidMessage)
+		}
+		//清单是从最新区块往前排的，反过来从最老的区块开始下载，
+		//这样收到区块时它引用的交易已经在链上，可以验证签名
+		items := make([][]byte,0,len(payload.Items))
+		for i := len(payload.Items)-1; i >= 0; i--{
+			items = append(items,payload.Items[i])
+		}
+		blockHash := items[0]  //这是最老区块的hash
 
-		//发出请求最新区块命令后， 这个最新的blockHash就没用了，可以从blockInTransit删除了。
+		//要请求的这个blockHash不用再留在blockInTransit中了。
 		//删除的方法是保存剩余的hash值，然后替换掉blockInTransit
 		newInTransit := [][]byte{}
-		for _,b:= range blockInTransit{
+		for _,b:= range items{
 			if bytes.Compare(b,blockHash) !=0{
 				newInTransit = append(newInTransit,b)
 			}
 		}
+		nodesMutex.Lock()
 		blockInTransit = newInTransit   //替换
+		nodesMutex.Unlock()
+
+		return sendGetData(payload.AddrFrom,"block",blockHash)   //请求下载这个区块
 	}
+	return nil
 }
 
 //处理收到的getdata命令， 发出命令，携带这个区块的具体内容数据
-func handleGetData(request []byte, bc *BlockChain) {
-	var buff bytes.Buffer
+func handleGetData(request []byte, bc *BlockChain) error{
 	var payload GetData
 
-	buff.Write(request[cmdLength:]) //提取命令数据的内容
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	checkErr(err)
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
 	fmt.Printf("handleGetData(), receive ‘getdata’ \n")
 
 	if payload.Type == "block"{
 		block,err := bc.GetBlock(payload.ID)
-		checkErr(err)
-		sendBlock(payload.AddrFrom,&block)   //这里才真正的发送这个区块数据
+		if err != nil{
+			return err
+		}
+		return sendBlock(payload.AddrFrom,&block)   //这里才真正的发送这个区块数据
 	}
+	return nil
 }
 
 //处理收到的blockdata版本命令
-func handleBlockData(request []byte, bc *BlockChain) {
-	var buff bytes.Buffer
+func handleBlockData(request []byte, bc *BlockChain) error{
 	var payload BlockCMDData
 
-	buff.Write(request[cmdLength:]) //提取命令数据的内容
-	dec := gob.NewDecoder(&buff)
-	err := dec.Decode(&payload)
-	checkErr(err)
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
 
 	//保存接收到的block区块数据
 	blockdata := payload.Block
-	block := DeserializeBlock(blockdata)
+	block,err := DeserializeBlock(blockdata)
+	if err != nil{
+		return err
+	}
 	fmt.Printf("handleBlockData(): receive a new Block, hash=%x\n",block.Hash)
-	bc.AddBlock(block)
+	err = bc.AddBlock(block)
+	if err != nil{
+		return err
+	}
 
+	nodesMutex.Lock()
+	var blockHash []byte
 	if len(blockInTransit)>0{
-		blockHash := blockInTransit[0]
-		sendGetData(payload.AddrFrom,"block",blockHash)
-
+		blockHash = blockInTransit[0]
 		blockInTransit = blockInTransit[1:]  //更新hash列表
-	}else{
-		//全部区块都更新完毕，准备更新UTXO
-		set := UTXOSet{bc}
-		set.Reindex()
 	}
+	nodesMutex.Unlock()
+	if blockHash != nil{
+		return sendGetData(payload.AddrFrom,"block",blockHash)
+	}
+	//AddBlock已经更新了UTXO集
+	return nil
+}
+
+//处理收到的tx交易命令：验证后放入交易池，再转发给其他节点；矿工节点交易够多时就挖矿
+func handleTx(request []byte, bc *BlockChain) error{
+	var payload TxCMDData
+
+	err := decodePayload(request,&payload) //提取命令数据的内容
+	if err != nil{
+		return err
+	}
+	tx,err := DeserializeTransation(payload.Transation)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("handleTx(): receive transation %x\n",tx.ID)
+
+	err = Mempool{bc}.Add(tx)
+	if errors.Is(err,ErrTxInMempool){
+		return nil  //已经收到过，不再转发，避免在节点之间来回传
+	}
+	if err != nil{
+		return err
+	}
+	relayTransation(tx,payload.AddrFrom)
 
+	if miningAddress != ""{
+		return mineMempool(bc)
+	}
+	return nil
+}
+
+//矿工节点用交易池中的交易挖矿，挖出的区块通知其他节点
+func mineMempool(bc *BlockChain) error{
+	miningMutex.Lock()
+	defer miningMutex.Unlock()
+
+	pool := Mempool{bc}
+	info,err := pool.Info()
+	if err != nil{
+		return err
+	}
+	if info.Count < minerTxThreshold{
+		return nil
+	}
+
+	newBlock,err := pool.MineBlock(miningAddress)
+	if err != nil{
+		return err
+	}
+	fmt.Printf("mineMempool(): mined block %x with %d transations\n",newBlock.Hash,len(newBlock.Transations))
+
+	for _,node := range getKnownNodes(){
+		if node != nodeAddress{
+			err := sendInv(node,"block",[][]byte{newBlock.Hash})
+			if err != nil{
+				fmt.Println("mineMempool():",err)
+			}
+		}
+	}
+	return nil
 }
 
 //-----------------------------------------------------
 
 
+//把交易转发给除了本节点和except之外的全部已知节点，某个节点连不上只打印出来
+func relayTransation(tx *Transation, except string){
+	for _,node := range getKnownNodes(){
+		if node == nodeAddress || node == except{
+			continue
+		}
+		err := sendTx(node,tx)
+		if err != nil{
+			fmt.Printf("relayTransation(): %s: %v\n",node,err)
+		}
+	}
+}
+
+//发送交易
+func sendTx(addr string, tx *Transation) error{
+	data := TxCMDData{nodeAddress,tx.Serialize()}
+	payload := gobEncode(data)
+	request := append(cmdToBytes("tx"),payload...)
+	return sendData(addr,request)
+}
+
 //发送区块具体内容
-func sendBlock(addr string, block *Block) {
+func sendBlock(addr string, block *Block) error{
 	data := BlockCMDData{nodeAddress,block.Serialize()}
 	payload := gobEncode(data)
 	request := append(cmdToBytes("blockdata"),payload...)
-	sendData(addr,request)
+	return sendData(addr,request)
 }
 
 
 //发送获取区块数据命令getdata
-func sendGetData(addr string, kind string, id []byte) {
+func sendGetData(addr string, kind string, id []byte) error{
 	payload := gobEncode(GetData{nodeAddress,kind,id})
 	request := append(cmdToBytes("getdata"),payload...)
-	sendData(addr,request)
+	return sendData(addr,request)
 }
 
 //发送本节点的全部区块Hash值的命令inv
-func sendInv(addr string, kind string, items [][]byte) {
+func sendInv(addr string, kind string, items [][]byte) error{
 	inventory := Inv{nodeAddress,kind,items}
 	payload := gobEncode(inventory)
 	request := append(cmdToBytes("inv"),payload...)
-	sendData(addr,request)
+	return sendData(addr,request)
 }
 
 //发送下载区块Hash列表命令getblocks
-func sendGetBlocks(addr string, low int32, high int32) {
+func sendGetBlocks(addr string, low int32, high int32) error{
 	fmt.Printf("sendGetBlocks(): nodeAddress=%s\n",nodeAddress)
 	payload := gobEncode(GetBlocks{nodeAddress, low, high})
 	request := append(cmdToBytes("getblocks"),payload...)
-	sendData(addr,request)
+	return sendData(addr,request)
 }
 
 //发送自己的版本信息
-func sendVersion(addr string, bc *BlockChain) {
-	bestHeight := bc.GetBestHeight()
+func sendVersion(addr string, bc *BlockChain) error{
+	bestHeight,err := bc.GetBestHeight()
+	if err != nil{
+		return err
+	}
 
 	payload := gobEncode(Version{nodeversion,bestHeight,nodeAddress})
 	request := append(cmdToBytes("version"),payload...)
-	sendData(addr,request)
+	return sendData(addr,request)
 }
 
 //发送命令请求
-func sendData(addr string, data []byte) {
+func sendData(addr string, data []byte) error{
 	con,err := net.Dial("tcp",addr)
 	if err != nil{
 		//连接失败后要把这个地址从公共节点中删除
 		fmt.Printf("%s is not available\n", addr)
-		var updateNodes []string
-		for _,node := range knownNodes{
-			if node != addr{   //addr这个地址连接不通了，故意丢弃addr，只保留其它地址
-				updateNodes = append(updateNodes,node)
-			}
-		}
-		knownNodes = updateNodes   //更新公共节点
+		removeKnownNode(addr)
+		return err
 	}
 	defer con.Close()
 
 	_,err = io.Copy(con,bytes.NewReader(data))  //发送命令
-	checkErr(err)
+	return err
 }
 
 //命令字转成字节切片
@@ -316,12 +475,14 @@ func gobEncode(data interface{}) []byte{
 	var buff bytes.Buffer
 	enc := gob.NewEncoder(&buff)
 	err := enc.Encode(data)
-	checkErr(err)
+	if err != nil{
+		log.Panic(err)  //编码的是本节点自己构造的结构体，失败说明程序有bug
+	}
 
 	return buff.Bytes()
 }
 
-//检查指定地址是否在公共节点列表中
+//检查指定地址是否在公共节点列表中，调用者要持有nodesMutex
 func nodeIsKnow(addr string) bool {
 	for  _,node := range knownNodes{
 		if node == addr{
@@ -331,6 +492,35 @@ func nodeIsKnow(addr string) bool {
 	return false
 }
 
+//公共节点列表的副本，遍历副本时其他协程可以修改列表
+func getKnownNodes() []string{
+	nodesMutex.Lock()
+	defer nodesMutex.Unlock()
+	return append([]string(nil),knownNodes...)
+}
+
+//把可用的外部节点添加到公共节点列表中
+func addKnownNode(addr string){
+	nodesMutex.Lock()
+	defer nodesMutex.Unlock()
+	if !nodeIsKnow(addr){
+		knownNodes = append(knownNodes, addr)
+	}
+}
+
+//连接不通的节点从公共节点列表中删除
+func removeKnownNode(addr string){
+	nodesMutex.Lock()
+	defer nodesMutex.Unlock()
+	var updateNodes []string
+	for _,node := range knownNodes{
+		if node != addr{   //addr这个地址连接不通了，故意丢弃addr，只保留其它地址
+			updateNodes = append(updateNodes,node)
+		}
+	}
+	knownNodes = updateNodes   //更新公共节点
+}
+
 //对象输出字符串形式
 func (ver *Version) toString(){
 	fmt.Printf("Version:%x\n",ver.Version)
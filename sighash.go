@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+)
+
+//签名类型，附加在每个签名的最后一个字节，决定这个签名覆盖交易的哪些部分。
+//和比特币的SIGHASH一样：
+//	ALL          签名覆盖全部输入和全部输出，默认值
+//	NONE         不覆盖任何输出，输出可以由别人任意修改
+//	SINGLE       只覆盖和本输入序号相同的那个输出
+//	ANYONECANPAY 可以和上面三种组合，只覆盖本输入，别人可以继续往交易里添加输入（众筹）
+type SigHashType byte
+
+const (
+	SigHashAll          SigHashType = 0x01
+	SigHashNone         SigHashType = 0x02
+	SigHashSingle       SigHashType = 0x03
+	SigHashAnyoneCanPay SigHashType = 0x80
+
+	sigHashMask = 0x1f //取出ALL/NONE/SINGLE部分的掩码
+)
+
+//去掉ANYONECANPAY标志后的基本类型
+func (t SigHashType) base() SigHashType{
+	return t & sigHashMask
+}
+
+//是否带有ANYONECANPAY标志
+func (t SigHashType) anyoneCanPay() bool{
+	return t&SigHashAnyoneCanPay != 0
+}
+
+//检查签名类型是否合法，只允许三种基本类型和ANYONECANPAY标志
+func (t SigHashType) valid() bool{
+	if t&^(sigHashMask|SigHashAnyoneCanPay) != 0{
+		return false
+	}
+	base := t.base()
+	return base == SigHashAll || base == SigHashNone || base == SigHashSingle
+}
+
+func (t SigHashType) String() string{
+	var name string
+	switch t.base(){
+	case SigHashAll:
+		name = "ALL"
+	case SigHashNone:
+		name = "NONE"
+	case SigHashSingle:
+		name = "SINGLE"
+	default:
+		return fmt.Sprintf("UNKNOWN(0x%02x)",byte(t))
+	}
+	if t.anyoneCanPay(){
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+//解析命令行中的签名类型，例如 ALL、NONE、SINGLE|ANYONECANPAY，不区分大小写
+func ParseSigHashType(s string) (SigHashType,error){
+	var t,base SigHashType
+	for _,part := range strings.Split(strings.ToUpper(s),"|"){
+		//ALL、NONE、SINGLE只能写一个，它们的值按位或起来会变成另一种类型（ALL|NONE就是SINGLE）
+		var next SigHashType
+		switch strings.TrimSpace(part){
+		case "ALL":
+			next = SigHashAll
+		case "NONE":
+			next = SigHashNone
+		case "SINGLE":
+			next = SigHashSingle
+		case "ANYONECANPAY":
+			t |= SigHashAnyoneCanPay
+		default:
+			return 0,fmt.Errorf("unknown sighash type %q, use ALL|NONE|SINGLE with optional |ANYONECANPAY",s)
+		}
+		if next != 0{
+			if base != 0{
+				return 0,fmt.Errorf("invalid sighash type %q, use only one of ALL, NONE and SINGLE",s)
+			}
+			base = next
+			t |= next
+		}
+	}
+	//只写了ANYONECANPAY时默认和ALL组合
+	if t.base() == 0{
+		t |= SigHashAll
+	}
+	if !t.valid(){
+		return 0,fmt.Errorf("invalid sighash type %q",s)
+	}
+	return t,nil
+}
+
+//计算第inID个输入的签名要覆盖的hash值，prevOut是这个输入引用的输出。
+//在交易的副本上按签名类型裁剪输入和输出，再把引用输出的金额和签名类型追加在序列化数据后面一起hash，
+//这样改变签名类型也会让签名失效。覆盖金额和比特币的BIP143一样：离线签名时看不到区块链，
+//如果PSBT中的引用输出金额被改小，签出来的签名对真实的输出无效，不会多付手续费
+func (tx *Transation) SignatureHash(inID int,prevOut TXOutput,hashType SigHashType) ([]byte,error){
+	if inID < 0 || inID >= len(tx.Vin){
+		return nil,fmt.Errorf("%w: input %d out of range",ErrInvalidTransation,inID)
+	}
+	if !hashType.valid(){
+		return nil,fmt.Errorf("%w: invalid sighash type 0x%02x",ErrInvalidTransation,byte(hashType))
+	}
+
+	//副本中所有输入的签名和公钥都是空的，只有要签名的输入填上引用输出的公钥hash
+	txcopy := tx.TrimmedCopy()
+	txcopy.Vin[inID].Pubkey = prevOut.PubkeyHash
+
+	//NONE和SINGLE不覆盖其他输入的序列号，其他输入的所有者可以各自修改
+	if hashType.base() != SigHashAll{
+		for i := range txcopy.Vin{
+			if i != inID{
+				txcopy.Vin[i].Sequence = 0
+			}
+		}
+	}
+
+	switch hashType.base(){
+	case SigHashNone:
+		txcopy.Vout = nil
+	case SigHashSingle:
+		//SINGLE要求有和输入序号相同的输出，前面的输出清空但保留位置，后面的输出去掉
+		if inID >= len(txcopy.Vout){
+			return nil,fmt.Errorf("%w: SIGHASH_SINGLE input %d has no matching output",ErrInvalidTransation,inID)
+		}
+		txcopy.Vout = txcopy.Vout[:inID+1]
+		for i := 0; i < inID; i++{
+			txcopy.Vout[i] = TXOutput{-1,nil}
+		}
+	}
+
+	if hashType.anyoneCanPay(){
+		txcopy.Vin = []TXInput{txcopy.Vin[inID]}
+	}
+
+	txcopy.ID = []byte{}
+	var data bytes.Buffer
+	data.Write(txcopy.hashData())
+	writeInt(&data,int64(prevOut.Value))
+	data.WriteByte(byte(hashType))
+	hash := sha256.Sum256(data.Bytes())
+	return hash[:],nil
+}
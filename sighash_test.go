@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSigHashType(t *testing.T){
+	tests := []struct{
+		in   string
+		want SigHashType
+		name string
+	}{
+		{"ALL",SigHashAll,"ALL"},
+		{"none",SigHashNone,"NONE"},
+		{"SINGLE",SigHashSingle,"SINGLE"},
+		{"ALL|ANYONECANPAY",SigHashAll | SigHashAnyoneCanPay,"ALL|ANYONECANPAY"},
+		{"single | anyonecanpay",SigHashSingle | SigHashAnyoneCanPay,"SINGLE|ANYONECANPAY"},
+		{"ANYONECANPAY",SigHashAll | SigHashAnyoneCanPay,"ALL|ANYONECANPAY"},
+	}
+	for _,tt := range tests{
+		got,err := ParseSigHashType(tt.in)
+		if err != nil{
+			t.Errorf("ParseSigHashType(%q): %v",tt.in,err)
+			continue
+		}
+		if got != tt.want || got.String() != tt.name{
+			t.Errorf("ParseSigHashType(%q) = %s (0x%02x), want %s",tt.in,got,byte(got),tt.name)
+		}
+	}
+	for _,in := range []string{"","ALL|NONE","EVERYTHING"}{
+		if _,err := ParseSigHashType(in); err == nil{
+			t.Errorf("ParseSigHashType(%q) succeeded",in)
+		}
+	}
+}
+
+//两个输入都属于同一个钱包，两个输出付给别人
+func sighashTestTx(t *testing.T) (*Transation,*Wallet,[]TXOutput){
+	t.Helper()
+	wallet,err := NewWallet()
+	if err != nil{
+		t.Fatal(err)
+	}
+	pubkeyhash := HashPubKey(wallet.PublicKey)
+	prevOuts := []TXOutput{{5 * Coin,pubkeyhash},{7 * Coin,pubkeyhash}}
+	tx := &Transation{nil,[]TXInput{
+		{[]byte("prev-0"),0,nil,wallet.PublicKey,SequenceFinal},
+		{[]byte("prev-1"),1,nil,wallet.PublicKey,SequenceFinal},
+	},[]TXOutput{
+		{3 * Coin,[]byte("payee-0")},
+		{8 * Coin,[]byte("payee-1")},
+	}}
+	return tx,wallet,prevOuts
+}
+
+//对第0个输入按hashType签名后修改交易，检查签名是否仍然有效
+func TestSignatureHashTypes(t *testing.T){
+	tests := []struct{
+		name     string
+		hashType SigHashType
+		modify   func(tx *Transation)
+		valid    bool
+	}{
+		{"ALL unchanged",SigHashAll,func(tx *Transation) {},true},
+		{"ALL output changed",SigHashAll,func(tx *Transation) { tx.Vout[1].Value-- },false},
+		{"ALL other sequence changed",SigHashAll,func(tx *Transation) { tx.Vin[1].Sequence = 0 },false},
+		{"ALL input added",SigHashAll,func(tx *Transation){
+			tx.Vin = append(tx.Vin,TXInput{[]byte("prev-2"),0,nil,nil,SequenceFinal})
+		},false},
+		{"NONE outputs changed",SigHashNone,func(tx *Transation) { tx.Vout = tx.Vout[:1]; tx.Vout[0].Value = 1 },true},
+		{"NONE other sequence changed",SigHashNone,func(tx *Transation) { tx.Vin[1].Sequence = 0 },true},
+		{"NONE own sequence changed",SigHashNone,func(tx *Transation) { tx.Vin[0].Sequence = 0 },false},
+		{"SINGLE other output changed",SigHashSingle,func(tx *Transation) { tx.Vout[1].Value-- },true},
+		{"SINGLE output appended",SigHashSingle,func(tx *Transation){
+			tx.Vout = append(tx.Vout,TXOutput{1,[]byte("payee-2")})
+		},true},
+		{"SINGLE matching output changed",SigHashSingle,func(tx *Transation) { tx.Vout[0].Value-- },false},
+		{"ALL|ANYONECANPAY input added",SigHashAll | SigHashAnyoneCanPay,func(tx *Transation){
+			tx.Vin = append(tx.Vin,TXInput{[]byte("prev-2"),0,nil,nil,SequenceFinal})
+		},true},
+		{"ALL|ANYONECANPAY other input removed",SigHashAll | SigHashAnyoneCanPay,func(tx *Transation) { tx.Vin = tx.Vin[:1] },true},
+		{"ALL|ANYONECANPAY output changed",SigHashAll | SigHashAnyoneCanPay,func(tx *Transation) { tx.Vout[1].Value-- },false},
+		{"hash type byte changed",SigHashAll,func(tx *Transation){
+			sig := tx.Vin[0].Signature
+			sig[len(sig)-1] = byte(SigHashNone)
+		},false},
+	}
+	for _,tt := range tests{
+		tx,wallet,prevOuts := sighashTestTx(t)
+		err := tx.SignInput(0,wallet.PrivateKey,prevOuts[0],tt.hashType)
+		if err != nil{
+			t.Fatalf("%s: %v",tt.name,err)
+		}
+		tt.modify(tx)
+		err = tx.VerifyInput(0,prevOuts[0])
+		if tt.valid && err != nil{
+			t.Errorf("%s: signature rejected: %v",tt.name,err)
+		}
+		if !tt.valid && !errors.Is(err,ErrInvalidTransation){
+			t.Errorf("%s: got %v, want ErrInvalidTransation",tt.name,err)
+		}
+	}
+}
+
+//签名覆盖引用输出的金额，金额不对时签名无效
+func TestSignatureHashCommitsToValue(t *testing.T){
+	tx,wallet,prevOuts := sighashTestTx(t)
+	err := tx.SignInput(0,wallet.PrivateKey,prevOuts[0],SigHashAll)
+	if err != nil{
+		t.Fatal(err)
+	}
+	prevOuts[0].Value++
+	if err := tx.VerifyInput(0,prevOuts[0]); !errors.Is(err,ErrInvalidTransation){
+		t.Fatalf("got %v, want ErrInvalidTransation",err)
+	}
+}
+
+//SINGLE的输入没有对应的输出时不能签名
+func TestSignatureHashSingleWithoutOutput(t *testing.T){
+	tx,wallet,prevOuts := sighashTestTx(t)
+	tx.Vout = tx.Vout[:1]
+	err := tx.SignInput(1,wallet.PrivateKey,prevOuts[1],SigHashSingle)
+	if !errors.Is(err,ErrInvalidTransation){
+		t.Fatalf("got %v, want ErrInvalidTransation",err)
+	}
+}
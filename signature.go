@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var errInvalidSignature = errors.New("invalid signature encoding")
+
+//把签名的r、s编码成严格的DER格式：
+//	0x30 总长度 0x02 r的长度 r 0x02 s的长度 s
+//整数是大端、去掉多余的前导0，最高位是1时要补一个0x00，保证被当作正数
+func encodeDERSignature(r,s *big.Int) []byte{
+	rb := derInteger(r)
+	sb := derInteger(s)
+
+	out := make([]byte,0,6+len(rb)+len(sb))
+	out = append(out,0x30,byte(4+len(rb)+len(sb)))
+	out = append(out,0x02,byte(len(rb)))
+	out = append(out,rb...)
+	out = append(out,0x02,byte(len(sb)))
+	out = append(out,sb...)
+	return out
+}
+
+//DER整数的内容部分
+func derInteger(n *big.Int) []byte{
+	b := n.Bytes()
+	if len(b) == 0{
+		return []byte{0x00}
+	}
+	if b[0]&0x80 != 0{
+		b = append([]byte{0x00},b...)
+	}
+	return b
+}
+
+//按严格DER规则解析签名（和比特币BIP66的规则相同），任何多余的字节、非最短编码、负数都拒绝，
+//这样同一个签名只有一种合法编码，别人无法改动签名的字节而不让它失效
+func parseDERSignature(sig []byte) (r,s *big.Int,err error){
+	//最短 0x30 0x06 0x02 0x01 r 0x02 0x01 s，最长是两个33字节的整数
+	if len(sig) < 8 || len(sig) > 72{
+		return nil,nil,fmt.Errorf("%w: length %d",errInvalidSignature,len(sig))
+	}
+	if sig[0] != 0x30{
+		return nil,nil,fmt.Errorf("%w: missing sequence tag",errInvalidSignature)
+	}
+	if int(sig[1]) != len(sig)-2{
+		return nil,nil,fmt.Errorf("%w: wrong sequence length",errInvalidSignature)
+	}
+
+	rest := sig[2:]
+	r,rest,err = parseDERInteger(rest)
+	if err != nil{
+		return nil,nil,err
+	}
+	s,rest,err = parseDERInteger(rest)
+	if err != nil{
+		return nil,nil,err
+	}
+	if len(rest) != 0{
+		return nil,nil,fmt.Errorf("%w: trailing bytes",errInvalidSignature)
+	}
+	return r,s,nil
+}
+
+//解析一个DER整数，返回整数和剩下的数据
+func parseDERInteger(data []byte) (*big.Int,[]byte,error){
+	if len(data) < 2 || data[0] != 0x02{
+		return nil,nil,fmt.Errorf("%w: missing integer tag",errInvalidSignature)
+	}
+	length := int(data[1])
+	if length == 0 || length > 33 || len(data) < 2+length{
+		return nil,nil,fmt.Errorf("%w: wrong integer length",errInvalidSignature)
+	}
+	content := data[2 : 2+length]
+	if content[0]&0x80 != 0{
+		return nil,nil,fmt.Errorf("%w: negative integer",errInvalidSignature)
+	}
+	if length > 1 && content[0] == 0x00 && content[1]&0x80 == 0{
+		return nil,nil,fmt.Errorf("%w: integer has extra leading zero",errInvalidSignature)
+	}
+	return new(big.Int).SetBytes(content),data[2+length:],nil
+}
+
+//s和N-s都能通过验证，统一取较小的那个（low-S），避免签名被别人改成另一个也合法的值
+func normalizeLowS(curve elliptic.Curve,s *big.Int) *big.Int{
+	n := curve.Params().N
+	half := new(big.Int).Rsh(n,1)
+	if s.Cmp(half) > 0{
+		return new(big.Int).Sub(n,s)
+	}
+	return s
+}
+
+//检查s是否已经是low-S
+func isLowS(curve elliptic.Curve,s *big.Int) bool{
+	half := new(big.Int).Rsh(curve.Params().N,1)
+	return s.Cmp(half) <= 0
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func mustHex(t *testing.T,s string) []byte{
+	t.Helper()
+	b,err := hex.DecodeString(s)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return b
+}
+
+//私钥1对"Satoshi Nakamoto"的签名，r的最高位是1，要补0x00
+func TestDERSignatureKnownAnswer(t *testing.T){
+	r := mustHexInt(t,"934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8")
+	s := mustHexInt(t,"2442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5")
+	want := "3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d8" +
+		"02202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"
+
+	der := encodeDERSignature(r,s)
+	if hex.EncodeToString(der) != want{
+		t.Fatalf("encodeDERSignature = %x, want %s",der,want)
+	}
+	r2,s2,err := parseDERSignature(der)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if r2.Cmp(r) != 0 || s2.Cmp(s) != 0{
+		t.Fatalf("parseDERSignature = (%x, %x)",r2,s2)
+	}
+
+	//小整数按最短编码
+	der = encodeDERSignature(big.NewInt(1),big.NewInt(0x80))
+	if hex.EncodeToString(der) != "300702010102020080"{
+		t.Fatalf("small integers encoded as %x",der)
+	}
+}
+
+func TestParseDERSignatureRejects(t *testing.T){
+	tests := []struct{
+		name string
+		sig  string
+	}{
+		{"empty",""},
+		{"wrong sequence tag","3106020101020101"},
+		{"wrong sequence length","3007020101020101"},
+		{"trailing bytes","300602010102010100"},
+		{"wrong integer tag","3006030101020101"},
+		{"zero length integer","30060200020101" + "01"},
+		{"negative r","3006020180020101"},
+		{"negative s","3006020101020180"},
+		{"extra leading zero","300702020001020101"},
+		{"integer longer than data","3006020501020101"},
+	}
+	for _,tt := range tests{
+		_,_,err := parseDERSignature(mustHex(t,tt.sig))
+		if !errors.Is(err,errInvalidSignature){
+			t.Errorf("%s: got %v, want errInvalidSignature",tt.name,err)
+		}
+	}
+}
+
+func TestLowS(t *testing.T){
+	for _,id := range supportedCurves{
+		curve := id.Curve()
+		n := curve.Params().N
+		half := new(big.Int).Rsh(n,1)
+		high := new(big.Int).Add(half,big.NewInt(1))
+
+		if !isLowS(curve,half) || isLowS(curve,high){
+			t.Errorf("%s: isLowS boundary is wrong",id)
+		}
+		if got := normalizeLowS(curve,high); got.Cmp(new(big.Int).Sub(n,high)) != 0 || !isLowS(curve,got){
+			t.Errorf("%s: normalizeLowS(n/2+1) = %x",id,got)
+		}
+		if got := normalizeLowS(curve,half); got.Cmp(half) != 0{
+			t.Errorf("%s: normalizeLowS changed a low s",id)
+		}
+	}
+}
+
+//高S的签名数学上有效，但验证时拒绝
+func TestVerifySignatureRejectsHighS(t *testing.T){
+	wallet,err := NewWallet()
+	if err != nil{
+		t.Fatal(err)
+	}
+	hash := bytes.Repeat([]byte{0x42},32)
+	r,s,err := signHash(&wallet.PrivateKey,hash)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err := verifySignature(wallet.PublicKey,hash,r,s); err != nil{
+		t.Fatal(err)
+	}
+	highS := new(big.Int).Sub(wallet.PrivateKey.Curve.Params().N,s)
+	if err := verifySignature(wallet.PublicKey,hash,r,highS); err == nil{
+		t.Fatal("high-S signature accepted")
+	}
+}
+
+//secp256k1的G、3G的SEC1编码
+func TestPubKeySEC1KnownAnswers(t *testing.T){
+	curve := S256()
+	tests := []struct{
+		k                        int64
+		compressed,uncompressed string
+	}{
+		{1,"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			"0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+				"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"},
+		{3,"02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+			"04f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9" +
+				"388f7b0f632de8140fe337e62a37f3566500a99934c2231b6cb9fd7584b8e672"},
+		{20,"024ce119c96e2fa357200b559b2f7dd5a5f02d5290aff74b03f3e471b273211c97",
+			"044ce119c96e2fa357200b559b2f7dd5a5f02d5290aff74b03f3e471b273211c97" +
+				"12ba26dcb10ec1625da61fa10a844c676162948271d96967450288ee9233dc3a"},
+	}
+	for _,tt := range tests{
+		pub := &ecdsa.PublicKey{Curve: curve}
+		pub.X,pub.Y = curve.ScalarBaseMult(big.NewInt(tt.k).Bytes())
+		for _,c := range []struct{
+			compressed bool
+			want       string
+		}{{true,tt.compressed},{false,tt.uncompressed}}{
+			data := MarshalPubKey(pub,c.compressed)
+			if hex.EncodeToString(data) != c.want{
+				t.Errorf("%dG compressed=%v: %x, want %s",tt.k,c.compressed,data,c.want)
+			}
+			parsed,err := ParsePubKey(curve,data)
+			if err != nil{
+				t.Errorf("%dG compressed=%v: %v",tt.k,c.compressed,err)
+				continue
+			}
+			if parsed.X.Cmp(pub.X) != 0 || parsed.Y.Cmp(pub.Y) != 0{
+				t.Errorf("%dG compressed=%v: parsed a different point",tt.k,c.compressed)
+			}
+		}
+	}
+}
+
+func TestParsePubKeyRejects(t *testing.T){
+	curve := S256()
+	params := curve.Params()
+	offCurve := MarshalPubKey(&ecdsa.PublicKey{Curve: curve,X: params.Gx,Y: new(big.Int).Add(params.Gy,big.NewInt(1))},false)
+
+	//x=5时 x³+7 不是模p的平方数，曲线上没有这样的点
+	noPoint := make([]byte,33)
+	noPoint[0] = pubkeyCompressedEven
+	noPoint[32] = 5
+
+	for name,data := range map[string][]byte{
+		"off-curve uncompressed": offCurve,
+		"x without a point":      noPoint,
+		"too short":              {pubkeyCompressedEven,1},
+		"too long":               make([]byte,66),
+	}{
+		if _,err := ParsePubKey(curve,data); !errors.Is(err,errInvalidPubKey){
+			t.Errorf("%s: got %v, want errInvalidPubKey",name,err)
+		}
+	}
+}
+
+//P256上随机公钥的压缩、非压缩编码都能解析回原来的点，旧的直接拼接格式也能解析
+func TestPubKeyRoundTripP256(t *testing.T){
+	for i := 0; i < 20; i++{
+		priv,err := ecdsa.GenerateKey(elliptic.P256(),rand.Reader)
+		if err != nil{
+			t.Fatal(err)
+		}
+		pub := &priv.PublicKey
+		legacy := append(pub.X.Bytes(),pub.Y.Bytes()...)
+		for _,data := range [][]byte{MarshalPubKey(pub,true),MarshalPubKey(pub,false),legacy}{
+			parsed,err := ParsePubKey(elliptic.P256(),data)
+			if err != nil{
+				t.Fatalf("%x: %v",data,err)
+			}
+			if parsed.X.Cmp(pub.X) != 0 || parsed.Y.Cmp(pub.Y) != 0{
+				t.Fatalf("%x: parsed a different point",data)
+			}
+		}
+	}
+}
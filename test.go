@@ -1,13 +1,23 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+)
 
 //测试创建区块的默克尔根
 func TestCreateMerkleTreeRoot() {
-	tx1 := NewCoinbaseTX("Tom", "")
+	tx1,err := NewCoinbaseTX(minneraddress, "", 0)
+	if err != nil{
+		fmt.Println(err)
+		return
+	}
 
-	txin2  := TXInput{[]byte{}, -1, nil, nil}
-	txout2  := NewTXOutput(10,"Jerry")
+	txin2  := TXInput{[]byte{}, -1, nil, nil, SequenceFinal}
+	txout2,err  := NewTXOutput(10,minneraddress)
+	if err != nil{
+		fmt.Println(err)
+		return
+	}
 	tx2 := Transation{nil,[]TXInput{txin2},[]TXOutput{*txout2}}
 	tx2.ID = tx2.Hash()    // 交易的ID就是hash值
 
@@ -46,7 +56,11 @@ func TestNewSerialize(){
 		0,
 	}
 
-	deBlock := DeserializeBlock(block.Serialize())
+	deBlock,err := DeserializeBlock(block.Serialize())
+	if err != nil{
+		fmt.Println(err)
+		return
+	}
 	//deBlock.ToString()
 
 	fmt.Printf("%d\n",deBlock.Bits)
@@ -77,7 +91,12 @@ func TestPow(){
 
 //测试区块链创建、新增、遍历打印区块数据
 func TestBoltDB(){
-	bc := NewBlockChain("")
+	bc,err := NewBlockChain(minneraddress)
+	if err != nil{
+		fmt.Println(err)
+		return
+	}
+	defer bc.Close()
 	fmt.Printf("bc=",bc)
 	bc.MineBlock([]*Transation{})
 	bc.MineBlock([]*Transation{})
@@ -85,11 +104,10 @@ func TestBoltDB(){
 	bc.PrintBlockChain()
 }
 
-//测试命令行参数
+//测试命令行参数，区块链数据库由命令按需打开
 func TestCliArgs(){
-	bc := NewBlockChain(minneraddress)
-
-	cli := CLI{bc}
+	cli := CLI{}
+	defer cli.Close()
 	cli.Run()
 
 }
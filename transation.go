@@ -3,18 +3,17 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"fmt"
 	"log"
-	"math/big"
 	"strings"
 )
 
-const subsidy = 100   //初始挖矿奖励金额
+const subsidy = 100*Coin   //初始挖矿奖励金额
 
 //定义交易结构体
 type Transation struct{
@@ -29,17 +28,19 @@ type TXInput struct{
 	Voutindex  int      //输出索引
 	Signature  []byte   //解锁脚本
 	Pubkey     []byte   //公钥
+	Sequence   uint32   //序列号，不大于maxRBFSequence表示这笔交易允许被更高手续费的交易替换
 }
 
 //定义输出交易结构体
 type TXOutput struct{
-	Value int           //总量，用聪表示的比特币值
+	Value Amount        //金额，以最小单位计数
 	PubkeyHash  []byte  //公钥的hash
 }
 
-//定义输出交易结构体切片
+//定义输出交易结构体集合，key是输出序号。
+//用映射而不是切片保存，这样删除了已花费的输出后，剩下输出的序号也不会错位。
 type TXOutputs struct{
-	Outputs  []TXOutput
+	Outputs  map[int]TXOutput
 }
 
 //序列化
@@ -47,24 +48,28 @@ func (outs TXOutputs)Serialize() []byte{
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 	err := enc.Encode(outs)
-	checkErr(err)
+	if err != nil{
+		log.Panic(err)
+	}
 	return buf.Bytes()
 }
 
 //反序列化
-func Deserialize(data []byte) TXOutputs{
+func Deserialize(data []byte) (TXOutputs,error){
 	var outs TXOutputs
 	dec := gob.NewDecoder(bytes.NewReader(data))
 	err := dec.Decode(&outs)
-	checkErr(err)
-	return outs
+	return outs,err
 }
 
 //交易输出的上锁，这个公钥的hash值就对应着一个比特币地址，也就是钱包地址
-func (out *TXOutput) Lock(address []byte){
-	decodeAddress  := Base58Decode(address)
-	pubkeyhash := decodeAddress[1:len(decodeAddress)-addressChecksumLen]
+func (out *TXOutput) Lock(address []byte) error{
+	pubkeyhash,err := GetPubKeyHash(string(address))
+	if err != nil{
+		return err
+	}
 	out.PubkeyHash = pubkeyhash
+	return nil
 }
 
 //格式化打印交易完整信息
@@ -76,12 +81,16 @@ func (tx Transation) ToString()  string{
 		lines = append(lines, fmt.Sprintf("   Input: %d",i))
 		lines = append(lines, fmt.Sprintf("       TXID:  %x",input.TXid))
 		lines = append(lines, fmt.Sprintf("       Out:   %d",input.Voutindex))
+		lines = append(lines, fmt.Sprintf("       Sequence:  0x%08x",input.Sequence))
 		lines = append(lines, fmt.Sprintf("       Signature: %x",input.Signature))
+		if len(input.Signature) > 0{
+			lines = append(lines, fmt.Sprintf("       SigHash:   %s",SigHashType(input.Signature[len(input.Signature)-1])))
+		}
 	}
 
 	for i,output :=range tx.Vout{
 		lines = append(lines, fmt.Sprintf("   Output: %d",i))
-		lines = append(lines, fmt.Sprintf("       Value:  %d",output.Value))
+		lines = append(lines, fmt.Sprintf("       Value:  %s",output.Value))
 		lines = append(lines, fmt.Sprintf("       Sctrpt: %x",output.PubkeyHash))
 	}
 
@@ -101,32 +110,125 @@ func (tx *Transation) Serialize() []byte{
 	return encoded.Bytes()
 }
 
+//交易序列化后的字节数，用来计算手续费率
+func (tx *Transation) Size() int{
+	return len(tx.Serialize())
+}
+
+//交易的重量：签名和公钥以外的数据每字节算chainParams.WitnessScaleFactor，签名和公钥每字节算1，
+//即 去掉签名和公钥后的字节数*(WitnessScaleFactor-1) + 完整的字节数。区块和交易的大小上限都按重量计算
+func (tx *Transation) Weight() int{
+	return tx.strippedSize()*(chainParams.WitnessScaleFactor-1) + tx.Size()
+}
+
+//去掉全部签名和公钥后交易序列化的字节数
+func (tx *Transation) strippedSize() int{
+	txcopy := *tx
+	txcopy.Vin = make([]TXInput,len(tx.Vin))
+	for i,vin := range tx.Vin{
+		vin.Signature = nil
+		vin.Pubkey = nil
+		txcopy.Vin[i] = vin
+	}
+	return txcopy.Size()
+}
+
+//还没签名的交易签好名后最多有多大：每个没签名的输入按最长的DER签名加签名类型、最长的未压缩公钥估算
+func (tx *Transation) estimateSignedSize() int{
+	txcopy := *tx
+	txcopy.Vin = make([]TXInput,len(tx.Vin))
+	for i,vin := range tx.Vin{
+		if len(vin.Signature) == 0{
+			vin.Signature = make([]byte,73)
+			vin.Pubkey = make([]byte,65)
+		}
+		txcopy.Vin[i] = vin
+	}
+	return txcopy.Size()
+}
+
 //计算交易的hash值
 func (tx *Transation) Hash() []byte {
 	 txcopy := *tx
 	 txcopy.ID = []byte{}
 
-	 hash := sha256.Sum256(txcopy.Serialize())
+	 hash := sha256.Sum256(txcopy.hashData())
 	 return hash[:]
 }
 
-//根据金额与地址新建一个输出
-func NewTXOutput(value int ,address string) *TXOutput{
+//计算hash和签名用的交易数据，按固定格式逐个字段写入。
+//不能用gob序列化的结果：gob的类型编号是进程内全局分配的，先编码或解码过别的类型（比如区块）时，
+//同一笔交易在不同进程里序列化出来的字节不一样，签名的进程和验证的进程算出的hash就对不上了。
+//兼容性：这是共识规则的改变，旧链中交易的ID和签名是按gob计算的，在这个格式下都对不上，
+//所以旧的链数据不能再用：打开没有chainFormatVersion版本号的数据库会返回ErrChainFormat，
+//只能删除blockchain.db重新建链。还在用gob计算的节点也不接受新交易，所有节点要一起升级
+func (tx *Transation) hashData() []byte{
+	var buf bytes.Buffer
+	writeBytes := func(b []byte){
+		writeInt(&buf,int64(len(b)))
+		buf.Write(b)
+	}
+
+	writeBytes(tx.ID)
+	writeInt(&buf,int64(len(tx.Vin)))
+	for _,vin := range tx.Vin{
+		writeBytes(vin.TXid)
+		writeInt(&buf,int64(vin.Voutindex))
+		writeInt(&buf,int64(vin.Sequence))
+		writeBytes(vin.Signature)
+		writeBytes(vin.Pubkey)
+	}
+	writeInt(&buf,int64(len(tx.Vout)))
+	for _,vout := range tx.Vout{
+		writeInt(&buf,int64(vout.Value))
+		writeBytes(vout.PubkeyHash)
+	}
+	return buf.Bytes()
+}
+
+//按小端8字节写入整数
+func writeInt(buf *bytes.Buffer, n int64){
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:],uint64(n))
+	buf.Write(b[:])
+}
+
+//根据金额与地址新建一个输出，地址不合法返回ErrInvalidAddress
+func NewTXOutput(value Amount ,address string) (*TXOutput,error){
 	txo := TXOutput{value,nil}
 	//txo.PubkeyHash = []byte(address)
-	txo.Lock([]byte(address)) //设置公钥hash
-	return &txo
+	err := txo.Lock([]byte(address)) //设置公钥hash
+	if err != nil{
+		return nil,err
+	}
+	return &txo,nil
 }
 
-//第一笔coinbase交易
-func NewCoinbaseTX(to,data string) *Transation{
-	txin  := TXInput{[]byte{}, -1, nil, []byte(data)}
-	txout := NewTXOutput(subsidy, to)
+//第一笔coinbase交易，奖励是挖矿奖励加上区块中交易的手续费fees。
+//data为空时填入随机数据，否则奖励给同一地址的两笔coinbase交易ID相同，后一笔会覆盖UTXO集中的前一笔
+func NewCoinbaseTX(to,data string, fees Amount) (*Transation,error){
+	if data == ""{
+		randData := make([]byte,20)
+		_,err := rand.Read(randData)
+		if err != nil{
+			return nil,err
+		}
+		data = fmt.Sprintf("%x",randData)
+	}
+	txin  := TXInput{[]byte{}, -1, nil, []byte(data), SequenceFinal}
+	reward,err := subsidy.Add(fees)
+	if err != nil{
+		return nil,err
+	}
+	txout,err := NewTXOutput(reward, to)
+	if err != nil{
+		return nil,err
+	}
 
 	tx := Transation{nil,[]TXInput{txin},[]TXOutput{*txout}}
 	tx.ID = tx.Hash()    // 交易的ID就是hash值
 
-	return &tx
+	return &tx,nil
 }
 
 //交易输出中检验锁定脚本
@@ -151,36 +253,58 @@ func (tx Transation) isCoinBase() bool{
 	return false
 }
 
-//对交易进行签名
-func (tx *Transation) Sign(privkey ecdsa.PrivateKey, prevTXs map[string]Transation) {
-	//coninbase交易不用签名
-	if tx.isCoinBase(){
-		return
+//找出输入引用的那笔输出，引用的交易不在prevTXs里返回ErrTxNotFound，输出序号不存在返回ErrInvalidTransation
+func prevOutput(prevTXs map[string]Transation, vin TXInput) (TXOutput,error){
+	prevTX := prevTXs[hex.EncodeToString(vin.TXid)]
+	if prevTX.ID==nil{
+		return TXOutput{},fmt.Errorf("%w: %x",ErrTxNotFound,vin.TXid)
 	}
-	//合法性检查过程
-	for _,vin := range tx.Vin{
-		if prevTXs[hex.EncodeToString(vin.TXid)].ID ==nil{
-			log.Panic("Error: Vin中引用的交易ID不存在！")
-		}
+	if vin.Voutindex < 0 || vin.Voutindex >= len(prevTX.Vout){
+		return TXOutput{},fmt.Errorf("%w: input references output %d of %x which does not exist",ErrInvalidTransation,vin.Voutindex,vin.TXid)
 	}
+	return prevTX.Vout[vin.Voutindex],nil
+}
 
-	// 创建副本,用于计算签名
-	txcopy := tx.TrimmedCopy()
-	for inID,vin := range txcopy.Vin{
-		prevTX := prevTXs[hex.EncodeToString(vin.TXid)] //拿到前一笔交易的结构体
-
-		txcopy.Vin[inID].Signature = nil
-		txcopy.Vin[inID].Pubkey = prevTX.Vout[vin.Voutindex].PubkeyHash
-		txcopy.ID = txcopy.Hash()
+//对交易的全部输入进行签名，Vin中引用的交易不在prevTXs里时返回ErrTxNotFound。
+//hashType决定签名覆盖交易的哪些部分，一般用SigHashAll
+func (tx *Transation) Sign(privkey ecdsa.PrivateKey, prevTXs map[string]Transation, hashType SigHashType) error{
+	//coninbase交易不用签名
+	if tx.isCoinBase(){
+		return nil
+	}
 
-		r,s,err := ecdsa.Sign(rand.Reader,&privkey, txcopy.ID)
+	for inID,vin := range tx.Vin{
+		prevOut,err := prevOutput(prevTXs,vin) //拿到这个输入引用的输出
+		if err != nil{
+			return fmt.Errorf("Transation.Sign(): %w",err)
+		}
+		err = tx.SignInput(inID,privkey,prevOut,hashType)
 		if err != nil{
-			log.Panic(err)
+			return err
 		}
-		signature := append(r.Bytes(),s.Bytes()...)
-		tx.Vin[inID].Signature = signature
+	}
+	return nil
+}
+
+//对第inID个输入签名，prevOut是这个输入引用的输出。
+//签名是DER编码的r、s再加上一个字节的签名类型，验证时根据这个字节重新计算hash
+func (tx *Transation) SignInput(inID int, privkey ecdsa.PrivateKey, prevOut TXOutput, hashType SigHashType) error{
+	err := checkPrivateKey(&privkey)
+	if err != nil{
+		return err
+	}
+	hash,err := tx.SignatureHash(inID,prevOut,hashType)
+	if err != nil{
+		return err
 	}
 
+	r,s,err := signHash(&privkey,hash)
+	if err != nil{
+		return err
+	}
+	signature := encodeDERSignature(r,s)
+	tx.Vin[inID].Signature = append(signature,byte(hashType))
+	return nil
 }
 
 //复制本交易，返回一个新的副本，这是深拷贝
@@ -189,7 +313,7 @@ func (tx *Transation) TrimmedCopy() Transation {
 	var outputs []TXOutput
 
 	for _,vin := range tx.Vin{
-		newIn :=TXInput{vin.TXid,vin.Voutindex,nil,nil}
+		newIn :=TXInput{vin.TXid,vin.Voutindex,nil,nil,vin.Sequence}
 		inputs = append(inputs,newIn)
 	}
 	for _,vout := range tx.Vout{
@@ -200,114 +324,211 @@ func (tx *Transation) TrimmedCopy() Transation {
 	return txCopy
 }
 
-//检验输入参数中的交易签名
-func (tx Transation) Verify(prevTXs map[string]Transation) bool {
+//检验输入参数中的交易签名，签名错误返回ErrInvalidTransation
+func (tx Transation) Verify(prevTXs map[string]Transation) error {
 	//coinbase交易不用验证，直接通过
 	if tx.isCoinBase(){
-		return true
+		return nil
 	}
 
-	//再次检查tx.Vin中的引用交易ID是否包含在输入数据中，其实没有必要
-	for _,vin :=range tx.Vin{
-		if prevTXs[hex.EncodeToString(vin.TXid)].ID==nil{
-			log.Panic("Error: Transation.Verify() failed!")
-		}
-	}
-
-	//校验交易会破坏这个交易内容，用克隆的交易进行验证。
-	txcopy := tx.TrimmedCopy()
-	curve := elliptic.P256()  //椭圆曲线，用于加解密计算
-
-	//计算交易整体的hash，必须把Vin.Signature清空，不能受之干扰
 	for inID, vin := range tx.Vin{
-		prevTX := prevTXs[hex.EncodeToString(vin.TXid)]
-		txcopy.Vin[inID].Signature = nil
-		txcopy.Vin[inID].Pubkey = prevTX.Vout[vin.Voutindex].PubkeyHash
-		//上面的Vin.Pubkey明明是公钥，为什么用公钥Hash赋值？ 想不明白
-		txcopy.ID = txcopy.Hash()
-
-		//这个Sinature是由ecdsa的Sign函数生成的r、s拼接得到的，这里再把Signature分解成r/s
-		r:=big.Int{}
-		s:=big.Int{}
-		siglen:=len(vin.Signature)
-		r.SetBytes(vin.Signature[:(siglen/2)])
-		s.SetBytes(vin.Signature[(siglen/2):])
-
-		//把vin中的公钥Pubkey拆成两半得到x、y坐标，再恢复公钥数据结构体rawPubkey;
-		//验证签名，实际上就是使用公钥数据结构体对信息的hash串重新计算一遍签名，再和原有签名(r+s)进行比较
-		x:=big.Int{}
-		y:=big.Int{}
-		keylen := len(vin.Pubkey)
-
-		x.SetBytes(vin.Pubkey[:(keylen/2)])
-		y.SetBytes(vin.Pubkey[(keylen/2):])
-
-		rawPubkey := ecdsa.PublicKey{curve,&x,&y}
-		if ecdsa.Verify(&rawPubkey,txcopy.ID, &r,&s) ==false{
-			return false
+		prevOut,err := prevOutput(prevTXs,vin)
+		if err != nil{
+			return fmt.Errorf("Transation.Verify(): %w",err)
+		}
+		err = tx.VerifyInput(inID,prevOut)
+		if err != nil{
+			return err
 		}
-		txcopy.Vin[inID].Pubkey = nil
 	}
-	return true
+	return nil
 }
 
-//根据发送方、接收方、转账金额创建出对应的交易
-func NewUTXOTransation(from,to string,amount int, bc *BlockChain) *Transation{
-	var inputs   []TXInput
-	var outputs  []TXOutput
+//检验第inID个输入的签名，prevOut是这个输入引用的输出
+func (tx *Transation) VerifyInput(inID int, prevOut TXOutput) error{
+	vin := tx.Vin[inID]
 
-	wallets,err := NewWallets()
-	if err !=nil{
-		log.Panic(err)
+	//公钥必须和引用输出锁定的公钥hash一致，否则谁都可以用自己的密钥花别人的钱
+	if !vin.CanBeUnlockedWith(prevOut.PubkeyHash){
+		return fmt.Errorf("%w: input %d public key does not match the output it spends",ErrInvalidTransation,inID)
 	}
-	//根据发送方地址找到对应的钱包，里面包含了公钥和私钥，可用于签名
-	wallet := wallets.GetWallet(from)
 
-	acc,validoutputs :=bc.FindSpendableOutputs2(HashPubKey(wallet.PublicKey),amount)
-	if acc < amount{
-		log.Panic("Error: Not enough funds")
+	//签名的最后一个字节是签名类型，前面是DER编码的r、s
+	if len(vin.Signature) < 2{
+		return fmt.Errorf("%w: input %d is not signed",ErrInvalidTransation,inID)
 	}
+	sig := vin.Signature[:len(vin.Signature)-1]
+	hashType := SigHashType(vin.Signature[len(vin.Signature)-1])
 
-	//遍历输出，得到每笔交易的hash和输出序号
-	for txid,outs := range validoutputs{
-		txID,err :=hex.DecodeString(txid)  //把交易hash值从字符串形式转成字节切片形式
-		if err !=nil{
-			log.Panic(err)
-		}
-
-		//遍历每一个序号, 把这笔输出作为新交易的Vin项。
-		//交易输入需要用户的公钥，只能从钱包集中找到指定的钱包，再得到公钥。
-		for _,out :=range outs{
-			input := TXInput{txID,out,nil,wallet.PublicKey}
-			inputs = append(inputs,input)
-		}
+	//按签名时的签名类型重新计算hash，必须把Vin.Signature清空，不能受之干扰
+	hash,err := tx.SignatureHash(inID,prevOut,hashType)
+	if err != nil{
+		return err
 	}
 
-	//开始填写Vout项，注意这些Vin总金额可能>转账金额，要把剩下的余额还给发送方
-	outputs = append(outputs,*NewTXOutput(amount,to))
-	if acc > amount{
-		outputs = append(outputs,*NewTXOutput(acc-amount,from))
+	//同样的签名已经验证过，不用再做椭圆曲线运算
+	if sigCache.Exists(hash,vin.Signature,vin.Pubkey){
+		return nil
 	}
 
-	//根据Vin和Vout填写交易结构体，注意要调用hash()方法计算这笔交易的hash值
-	tx := Transation{nil,inputs,outputs}
-	tx.ID = tx.Hash()
+	//从严格DER编码中解析出r/s
+	r,s,err := parseDERSignature(sig)
+	if err != nil{
+		return fmt.Errorf("%w: input %d: %v",ErrInvalidTransation,inID,err)
+	}
 
-	//用私钥对交易进行签名
-	bc.SignTransation(&tx, wallet.PrivateKey)
-	return &tx
+	//公钥中没有曲线信息，在secp256k1和P256上分别解析公钥并验证，s必须是low-S
+	err = verifySignature(vin.Pubkey,hash,r,s)
+	if err != nil{
+		return fmt.Errorf("%w: input %d: %v",ErrInvalidTransation,inID,err)
+	}
+	sigCache.Add(hash,vin.Signature,vin.Pubkey)
+	return nil
 }
 
+//转账时的可选参数
+type SendOptions struct{
+	Selector CoinSelector   //选币策略，为空时用DefaultCoinSelector
+	HashType SigHashType    //签名类型，为0时用SigHashAll
+	FeeRate  Amount         //手续费率，每1000字节的手续费，为0时用最低转发费率
+	Replaceable bool        //是否允许以后用bumpFee提高手续费替换这笔交易
+}
 
+//根据发送方、接收方、转账金额创建出对应的交易，手续费按opts.FeeRate和交易大小计算。
+//发送方的找零地址上的余额也可以花，找零付给密钥池中新的找零地址。
+//发送方不在钱包中返回ErrUnknownAddress，余额不足（包括手续费）返回ErrInsufficientFunds，
+//金额加手续费超过MaxMoney返回ErrInvalidAmount
+func NewUTXOTransation(from,to string,amount Amount, opts SendOptions, bc *BlockChain) (*Transation,error){
+	wallets,err := NewWallets()
+	if err !=nil{
+		return nil,err
+	}
+	defer wallets.Close()
+	//根据发送方地址找到对应的钱包，里面包含了公钥和私钥，可用于签名
+	wallet,err := wallets.GetWallet(from)
+	if err !=nil{
+		return nil,err
+	}
+	if wallet.Locked(){
+		return nil,ErrWalletLocked
+	}
 
+	//找出发送方和它的找零地址所有可花费的输出（包括交易池中还没确认的找零）
+	selector := opts.Selector
+	if selector == nil{
+		selector = DefaultCoinSelector
+	}
+	pool := Mempool{bc}
+	var utxos []UTXO
+	for _,address := range wallets.AccountAddresses(from){
+		accountWallet,err := wallets.GetWallet(address)
+		if err != nil{
+			return nil,err
+		}
+		spendable,err := pool.FindSpendableUTXOs(HashPubKey(accountWallet.PublicKey))
+		if err != nil{
+			return nil,err
+		}
+		utxos = append(utxos,spendable...)
+	}
+	hashType := opts.HashType
+	if hashType == 0{
+		hashType = SigHashAll
+	}
+	feeRate := opts.FeeRate
+	if feeRate == 0{
+		feeRate = mempoolPolicy.MinRelayFeeRate
+	}
 
+	change,err := wallets.GetChangeAddress(from)
+	if err != nil{
+		return nil,err
+	}
 
+	//手续费按签名后交易的实际大小计算，而大小又取决于选中几个输入，
+	//所以先按当前估计的手续费选币、签名，不够再按算出来的手续费重新来一次
+	var fee Amount
+	for{
+		tx,err := newSignedTransation(wallets,to,change,amount,fee,costOfChange(feeRate),utxos,selector,hashType,inputSequence(opts.Replaceable))
+		if err != nil{
+			return nil,err
+		}
+		need := feeForSize(feeRate,tx.Size())
+		if fee < need{
+			fee = need
+			continue
+		}
+		//用到了找零地址才保存钱包，没用到的找零地址还在文件中的密钥池里
+		if len(tx.Vout) > 1{
+			err = wallets.SaveToFile2()
+			if err != nil{
+				return nil,err
+			}
+		}
+		return tx,nil
+	}
+}
 
+//按选币策略挑出够 转账金额+手续费 的一组输出，创建交易并用钱包集中的私钥签名，剩下的余额找零给change，
+//不到minChange时不找零
+func newSignedTransation(wallets *Wallets, to,change string, amount,fee,minChange Amount, utxos []UTXO, selector CoinSelector, hashType SigHashType, sequence uint32) (*Transation,error){
+	var inputs   []TXInput
+	var outputs  []TXOutput
+	var prevOuts []TXOutput
 
+	//转账金额加手续费用检查过的加法，超出MaxMoney时返回ErrInvalidAmount
+	target,err := amount.Add(fee)
+	if err != nil{
+		return nil,err
+	}
+	selected,acc,err := selector.Select(utxos,target)
+	if err != nil{
+		return nil,err
+	}
 
+	//每一笔选中的输出作为新交易的Vin项，按选币策略给出的顺序排列。
+	//交易输入需要公钥，输出可能属于发送方的不同地址，从钱包集中找到各自的钱包，再得到公钥。
+	keys := make(map[string]*Wallet)
+	for _,wallet := range wallets.Store{
+		keys[string(HashPubKey(wallet.PublicKey))] = wallet
+	}
+	for _,utxo := range selected{
+		wallet,ok := keys[string(utxo.Output.PubkeyHash)]
+		if !ok{
+			return nil,fmt.Errorf("%w: output %x:%d",ErrUnknownAddress,utxo.TXid,utxo.Voutindex)
+		}
+		input := TXInput{utxo.TXid,utxo.Voutindex,nil,wallet.PublicKey,sequence}
+		inputs = append(inputs,input)
+		prevOuts = append(prevOuts,utxo.Output)
+	}
 
+	//开始填写Vout项，注意这些Vin总金额可能>转账金额+手续费，要把剩下的余额还给发送方
+	output,err := NewTXOutput(amount,to)
+	if err != nil{
+		return nil,err
+	}
+	outputs = append(outputs,*output)
+	changeValue,err := acc.Sub(target)
+	if err != nil{
+		return nil,err
+	}
+	//不到minChange的余额不值得找零，留给矿工
+	if changeValue > minChange{
+		changeOutput,err := NewTXOutput(changeValue,change)
+		if err != nil{
+			return nil,err
+		}
+		outputs = append(outputs,*changeOutput)
+	}
 
+	//根据Vin和Vout填写交易结构体，注意要调用hash()方法计算这笔交易的hash值
+	tx := Transation{nil,inputs,outputs}
+	tx.ID = tx.Hash()
 
-
-
-
+	//用各个输入所属地址的私钥签名
+	_,err = signWithWallets(&tx,prevOuts,wallets,hashType)
+	if err != nil{
+		return nil,err
+	}
+	return &tx,nil
+}
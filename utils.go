@@ -42,9 +42,3 @@ func ReverseBytes(data []byte){
 	}
 }
 
-//简化的错误检查方法
-func checkErr(err error) {
-	if err != nil {
-		log.Panic(err)
-	}
-}
@@ -2,8 +2,9 @@ package main
 
 import (
 	"encoding/hex"
+	"fmt"
 	"github.com/boltdb/bolt-master"
-	"log"
+	"sort"
 )
 type UTXOSet struct{
 	bchain * BlockChain
@@ -12,42 +13,45 @@ type UTXOSet struct{
 const utxoBucket = "chainset"
 
 //重置数据库的桶, 创建区块链时会调用
-func (u UTXOSet) Reindex(){
+func (u UTXOSet) Reindex() error{
 	db:=u.bchain.db
 	bucketName :=[]byte(utxoBucket)
 
-	err := db.Update(func(tx *bolt.Tx) error{
+	UTXO,err := u.bchain.FindAllUTXO()
+	if err != nil{
+		return err
+	}
+
+	//删除旧桶、建立新桶、写入UTXO放在同一个事务里，中途出错不会留下半个UTXO集
+	return db.Update(func(tx *bolt.Tx) error{
 		err2 := tx.DeleteBucket(bucketName)
 		//当数据库文件不存在时删除出错，允许这种情况
 		if err2 != nil && err2 != bolt.ErrBucketNotFound{
-			log.Panic(err2)
+			return err2
 		}
 
-		_,err3 := tx.CreateBucket(bucketName)
-		checkErr(err3)
-		return nil
-	})
-
-	checkErr(err)
-
-	UTXO := u.bchain.FindAllUTXO()
-	err4 := db.Update(func(tx *bolt.Tx) error{
-		b:=tx.Bucket(bucketName)
+		b,err3 := tx.CreateBucket(bucketName)
+		if err3 != nil{
+			return err3
+		}
 
 		for txID,outs := range UTXO{
 			key,err5 := hex.DecodeString(txID)
-			checkErr(err5)
+			if err5 != nil{
+				return err5
+			}
 			err6 := b.Put(key,outs.Serialize())  //存储的是映射，数据要求是序列化后的字节
-			checkErr(err6)
+			if err6 != nil{
+				return err6
+			}
 		}
 
 		return nil
 	})
-	checkErr(err4)
 }
 
 //在数据桶中查找指定公钥hash的用户UTXO
-func (u UTXOSet) FindUTXObyPubkeyHash(pubkeyhash []byte) []TXOutput{
+func (u UTXOSet) FindUTXObyPubkeyHash(pubkeyhash []byte) ([]TXOutput,error){
 	var UTXOs []TXOutput
 
 	db  := u.bchain.db
@@ -56,7 +60,10 @@ func (u UTXOSet) FindUTXObyPubkeyHash(pubkeyhash []byte) []TXOutput{
 		c := b.Cursor()   //理解为桶内部的迭代器
 
 		for k,v :=c.First(); k!=nil;k,v=c.Next(){
-			outs := Deserialize(v)
+			outs,err := Deserialize(v)
+			if err != nil{
+				return err
+			}
 			for _,out := range outs.Outputs{
 				if out.CanBeUnlockedWith(pubkeyhash){
 					UTXOs = append(UTXOs,out)
@@ -65,56 +72,132 @@ func (u UTXOSet) FindUTXObyPubkeyHash(pubkeyhash []byte) []TXOutput{
 		}
 		return nil
 	})
-	checkErr(err)
-	return UTXOs
+	return UTXOs,err
+}
+
+//在数据桶中查找指定公钥hash可以花费的UTXO，带上交易hash和输出序号，用于选币。
+//桶中的key是有序的，同一交易内再按输出序号排序，所以每次返回的顺序都一样。
+func (u UTXOSet) FindSpendableUTXOs(pubkeyhash []byte) ([]UTXO,error){
+	var UTXOs []UTXO
+
+	db  := u.bchain.db
+	err := db.View(func(tx *bolt.Tx) error{
+		b := tx.Bucket([]byte(utxoBucket))
+		c := b.Cursor()
+
+		for k,v :=c.First(); k!=nil;k,v=c.Next(){
+			outs,err := Deserialize(v)
+			if err != nil{
+				return err
+			}
+			var indexes []int
+			for outIdx,out := range outs.Outputs{
+				if out.CanBeUnlockedWith(pubkeyhash){
+					indexes = append(indexes,outIdx)
+				}
+			}
+			sort.Ints(indexes)
+
+			for _,outIdx := range indexes{
+				txID := append([]byte{},k...)  //k只在事务内有效，必须复制出来
+				UTXOs = append(UTXOs,UTXO{txID,outIdx,outs.Outputs[outIdx]})
+			}
+		}
+		return nil
+	})
+	return UTXOs,err
+}
+
+//在数据桶中查找指定交易的第index个输出，已经花费或者不存在返回ErrOutputSpent
+func (u UTXOSet) FindOutput(txid []byte, index int) (TXOutput,error){
+	var output TXOutput
+	db  := u.bchain.db
+	err := db.View(func(tx *bolt.Tx) error{
+		b := tx.Bucket([]byte(utxoBucket))
+		outsbytes := b.Get(txid)
+		if outsbytes == nil{
+			return fmt.Errorf("%w: %x:%d",ErrOutputSpent,txid,index)
+		}
+		outs,err := Deserialize(outsbytes)
+		if err != nil{
+			return err
+		}
+		out,ok := outs.Outputs[index]
+		if !ok{
+			return fmt.Errorf("%w: %x:%d",ErrOutputSpent,txid,index)
+		}
+		output = out
+		return nil
+	})
+	return output,err
+}
+
+//找出交易每个输入引用的输出，和Vin一一对应，有输出已经花费或者不存在时返回ErrOutputSpent
+func (u UTXOSet) FindPrevOutputs(tx *Transation) ([]TXOutput,error){
+	var prevOuts []TXOutput
+	for _,vin := range tx.Vin{
+		out,err := u.FindOutput(vin.TXid,vin.Voutindex)
+		if err != nil{
+			return nil,err
+		}
+		prevOuts = append(prevOuts,out)
+	}
+	return prevOuts,nil
 }
 
 /*当链上增加一个区块时更新数据库桶中的UTXO，更新策略:
 把新区块引用的输出从桶中删除
 把新区块的输出添加到桶中 */
-func (u UTXOSet) update(block *Block){
+func (u UTXOSet) update(block *Block) error{
 	db :=u.bchain.db
-	err:=db.Update(func(tx *bolt.Tx)error{
+	return db.Update(func(tx *bolt.Tx)error{
 		b:= tx.Bucket([]byte(utxoBucket))
 
 		for _,transation := range block.Transations{
 			if transation.isCoinBase() == false{
 				for _,vin := range transation.Vin{
-					updateouts := TXOutputs{}   //这里是个新的集合，用来装载删除了某笔输出的剩下的其他输出
+					updateouts := TXOutputs{make(map[int]TXOutput)}   //这里是个新的集合，用来装载删除了某笔输出的剩下的其他输出
 					outsbytes :=b.Get(vin.TXid) //在桶中找到引用的交易数据
-					outs := Deserialize(outsbytes) //数据反序列化，恢复成对象
+					if outsbytes == nil{
+						return fmt.Errorf("UTXOSet.update(): %w: %x",ErrTxNotFound,vin.TXid)
+					}
+					outs,err := Deserialize(outsbytes) //数据反序列化，恢复成对象
+					if err != nil{
+						return err
+					}
 
 					for outIdx,out := range outs.Outputs{
 						// 这笔交易的多个输出中，跳过Vin引用的输出序号，其他序号的输出都要添加到新集合中
 						if outIdx != vin.Voutindex{
-							updateouts.Outputs = append(updateouts.Outputs,out)
+							updateouts.Outputs[outIdx] = out
 						}
 					}
 
 					//到了这里表示肯定有一笔交易新删除了一个输出，万一这笔交易的所有输出都删除了，
 					// 那么这个交易就没有用了，要从桶中删除
 					if len(updateouts.Outputs)==0{
-						err := b.Delete(vin.TXid)
-						checkErr(err)
+						err = b.Delete(vin.TXid)
 					}else{
 						//这笔交易还有未使用的输出，用新集合替换就集合
-						err := b.Put(vin.TXid, updateouts.Serialize())
-						checkErr(err)
+						err = b.Put(vin.TXid, updateouts.Serialize())
+					}
+					if err != nil{
+						return err
 					}
 				}
 			}
 
-			newOutputs := TXOutputs{}
-			for _,out := range transation.Vout{
-				newOutputs.Outputs = append(newOutputs.Outputs, out)
+			newOutputs := TXOutputs{make(map[int]TXOutput)}
+			for outIdx,out := range transation.Vout{
+				newOutputs.Outputs[outIdx] = out
 			}
 			err:= b.Put(transation.ID, newOutputs.Serialize())
-			checkErr(err)
+			if err != nil{
+				return err
+			}
 		}
 		return nil
 	})
-
-	checkErr(err)
 }
 
 
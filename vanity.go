@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//靓号地址：不停地随机生成私钥，直到地址以指定的前缀开头。
+//地址是Base58编码，前缀每多一个字符，平均要试的私钥数大约乘以58，不区分大小写时少一些
+type VanityOptions struct{
+	Prefix     string
+	IgnoreCase bool
+	Threads    int
+	Curve      CurveID
+}
+
+//搜索的进度回调，大约每秒调用一次，返回false时停止搜索
+type VanityProgress func(tried uint64,elapsed time.Duration) bool
+
+//检查前缀：版本号0x00的地址都以'1'开头，其余字符要在Base58字母表中
+func checkVanityPrefix(prefix string) error{
+	if !strings.HasPrefix(prefix,"1"){
+		return fmt.Errorf("vanity prefix %q must start with \"1\"",prefix)
+	}
+	for i := 0; i < len(prefix); i++{
+		if bytes.IndexByte(b58Alphabet,prefix[i]) < 0{
+			return fmt.Errorf("vanity prefix %q: %q is not a Base58 character (0, O, I and l are not used)",prefix,prefix[i])
+		}
+	}
+	return nil
+}
+
+//平均要试多少个私钥才能找到以prefix开头的地址，也就是随机地址匹配前缀的概率的倒数。
+//地址是 '1'×前导0字节数 + 25字节数值的Base58，版本号0x00占一个'1'。
+//前缀中多出的'1'表示公钥hash开头有这么多个0字节，剩下的字符在对应的数值范围中按区间计数
+func VanityDifficulty(prefix string,ignoreCase bool) (float64,error){
+	err := checkVanityPrefix(prefix)
+	if err != nil{
+		return 0,err
+	}
+	rest := prefix[1:]
+	zeros := len(rest) - len(strings.TrimLeft(rest,"1"))
+	rest = rest[zeros:]
+	if zeros >= pubKeyHashLen{
+		return 0,fmt.Errorf("vanity prefix %q is impossible",prefix)
+	}
+	//公钥hash+校验和共24字节，开头zeros个字节是0，接下来的一个字节不是0
+	bits := uint(8 * (pubKeyHashLen + addressChecksumLen - zeros))
+	low := new(big.Int).Lsh(big.NewInt(1),bits-8)
+	high := new(big.Int).Lsh(big.NewInt(1),bits)
+	//前缀全是'1'时，开头有更多0字节的地址也匹配
+	if rest == ""{
+		low.SetInt64(0)
+	}
+
+	variants := []string{rest}
+	if ignoreCase{
+		variants = caseVariants(rest)
+	}
+	count := new(big.Int)
+	for _,v := range variants{
+		count.Add(count,base58PrefixCount(v,low,high))
+	}
+	if count.Sign() == 0{
+		return 0,fmt.Errorf("vanity prefix %q is impossible",prefix)
+	}
+	total := new(big.Float).SetInt(new(big.Int).Lsh(big.NewInt(1),8*(pubKeyHashLen+addressChecksumLen)))
+	difficulty,_ := total.Quo(total,new(big.Float).SetInt(count)).Float64()
+	return difficulty,nil
+}
+
+//不区分大小写时前缀的全部写法，字母表中没有的写法去掉
+func caseVariants(s string) []string{
+	variants := []string{""}
+	for i := 0; i < len(s); i++{
+		cases := []string{strings.ToLower(s[i : i+1])}
+		if upper := strings.ToUpper(s[i : i+1]); upper != cases[0]{
+			cases = append(cases,upper)
+		}
+		var next []string
+		for _,c := range cases{
+			if bytes.IndexByte(b58Alphabet,c[0]) < 0{
+				continue
+			}
+			for _,v := range variants{
+				next = append(next,v+c)
+			}
+		}
+		variants = next
+	}
+	return variants
+}
+
+//[low,high)中Base58编码以prefix开头的整数个数
+func base58PrefixCount(prefix string,low,high *big.Int) *big.Int{
+	base := big.NewInt(58)
+	value := new(big.Int)
+	for i := 0; i < len(prefix); i++{
+		value.Mul(value,base)
+		value.Add(value,big.NewInt(int64(bytes.IndexByte(b58Alphabet,prefix[i]))))
+	}
+	count := new(big.Int)
+	if prefix == ""{
+		return count.Sub(high,low)
+	}
+	//Base58编码比prefix多k位、以prefix开头的数在 [value, value+1) × 58^k 中，prefix不以'1'开头
+	scale := big.NewInt(1)
+	for scale.Cmp(high) <= 0{
+		from := new(big.Int).Mul(value,scale)
+		to := new(big.Int).Add(from,scale)
+		if from.Cmp(low) < 0{
+			from.Set(low)
+		}
+		if to.Cmp(high) > 0{
+			to.Set(high)
+		}
+		if to.Cmp(from) > 0{
+			count.Add(count,to.Sub(to,from))
+		}
+		scale.Mul(scale,base)
+	}
+	return count
+}
+
+//地址是否以prefix开头
+func vanityMatch(address,prefix string,ignoreCase bool) bool{
+	if len(address) < len(prefix){
+		return false
+	}
+	if ignoreCase{
+		return strings.EqualFold(address[:len(prefix)],prefix)
+	}
+	return address[:len(prefix)] == prefix
+}
+
+//用opts.Threads个goroutine生成私钥，直到地址匹配前缀，返回找到的钱包和总共试过的私钥数。
+//progress返回false时停止并返回错误
+func FindVanityAddress(opts VanityOptions,progress VanityProgress) (*Wallet,uint64,error){
+	err := checkVanityPrefix(opts.Prefix)
+	if err != nil{
+		return nil,0,err
+	}
+	if opts.Threads <= 0{
+		return nil,0,fmt.Errorf("threads must be positive")
+	}
+
+	var tried uint64
+	found := make(chan *Wallet,1)
+	failed := make(chan error,1)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Threads; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			for{
+				select{
+				case <-done:
+					return
+				default:
+				}
+				private,public,err := newKeyPair(opts.Curve)
+				if err != nil{
+					select{
+					case failed <- err:
+					default:
+					}
+					return
+				}
+				atomic.AddUint64(&tried,1)
+				wallet := &Wallet{PrivateKey: private,PublicKey: public}
+				if vanityMatch(string(wallet.GetAddress()),opts.Prefix,opts.IgnoreCase){
+					select{
+					case found <- wallet:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+	defer func(){
+		close(done)
+		wg.Wait()
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for{
+		select{
+		case wallet := <-found:
+			return wallet,atomic.LoadUint64(&tried),nil
+		case err := <-failed:
+			return nil,atomic.LoadUint64(&tried),err
+		case <-ticker.C:
+			if progress != nil && !progress(atomic.LoadUint64(&tried),time.Since(start)){
+				n := atomic.LoadUint64(&tried)
+				return nil,n,fmt.Errorf("vanity search stopped after %d keys",n)
+			}
+		}
+	}
+}
+
+//把找到的靓号地址加入钱包集，加密的钱包集要先解锁
+func (ws *Wallets) AddVanityWallet(wallet *Wallet) (string,error){
+	err := ws.protectNewWallet(wallet)
+	if err != nil{
+		return "",err
+	}
+	address := fmt.Sprintf("%s",wallet.GetAddress())
+	ws.Store[address] = wallet
+	return address,nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+//签名缓存：保存已经验证通过的 (签名hash, 签名, 公钥) 组合。
+//交易在进入交易池或者打包前已经验证过一次，区块到达时同样的签名就不用再做一次椭圆曲线运算
+type SigCache struct{
+	mu         sync.RWMutex
+	entries    map[[sha256.Size]byte]struct{}
+	maxEntries int
+}
+
+//默认的签名缓存大小
+const defaultSigCacheSize = 50000
+
+//全局签名缓存，VerifyInput验证通过的签名都会放进来
+var sigCache = NewSigCache(defaultSigCacheSize)
+
+//新建签名缓存，maxEntries<=0表示不缓存
+func NewSigCache(maxEntries int) *SigCache{
+	return &SigCache{entries: make(map[[sha256.Size]byte]struct{}),maxEntries: maxEntries}
+}
+
+//缓存的键：签名hash、签名和公钥一起hash，任何一项不同都不会命中
+func sigCacheKey(sighash,signature,pubkey []byte) [sha256.Size]byte{
+	data := make([]byte,0,len(sighash)+len(signature)+len(pubkey)+2)
+	data = append(data,sighash...)
+	data = append(data,byte(len(signature)))
+	data = append(data,signature...)
+	data = append(data,byte(len(pubkey)))
+	data = append(data,pubkey...)
+	return sha256.Sum256(data)
+}
+
+//检查签名是否验证过
+func (c *SigCache) Exists(sighash,signature,pubkey []byte) bool{
+	if c == nil || c.maxEntries <= 0{
+		return false
+	}
+	key := sigCacheKey(sighash,signature,pubkey)
+	c.mu.RLock()
+	_,ok := c.entries[key]
+	c.mu.RUnlock()
+	return ok
+}
+
+//记录一个验证通过的签名。缓存满了随机淘汰一条（map的遍历顺序是随机的）
+func (c *SigCache) Add(sighash,signature,pubkey []byte){
+	if c == nil || c.maxEntries <= 0{
+		return
+	}
+	key := sigCacheKey(sighash,signature,pubkey)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _,ok := c.entries[key]; ok{
+		return
+	}
+	if len(c.entries) >= c.maxEntries{
+		for k := range c.entries{
+			delete(c.entries,k)
+			break
+		}
+	}
+	c.entries[key] = struct{}{}
+}
+
+//缓存中的条目数
+func (c *SigCache) Len() int{
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+//一次签名检查：交易的第inID个输入，prevOut是它引用的输出
+type sigCheck struct{
+	tx      *Transation
+	inID    int
+	prevOut TXOutput
+}
+
+//并行验证签名的worker数量，默认等于CPU个数
+var verifyWorkers = runtime.NumCPU()
+
+//把签名检查分给最多workers个goroutine并行验证，任何一个失败就取消其余的检查，返回第一个错误
+func verifySigChecks(checks []sigCheck,workers int) error{
+	if workers < 1{
+		workers = 1
+	}
+	if workers > len(checks){
+		workers = len(checks)
+	}
+	if workers <= 1{
+		for _,check := range checks{
+			err := check.tx.VerifyInput(check.inID,check.prevOut)
+			if err != nil{
+				return fmt.Errorf("transation %x: %w",check.tx.ID,err)
+			}
+		}
+		return nil
+	}
+
+	ctx,cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jobs := make(chan sigCheck)
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			for check := range jobs{
+				if ctx.Err() != nil{
+					continue
+				}
+				err := check.tx.VerifyInput(check.inID,check.prevOut)
+				if err != nil{
+					once.Do(func(){
+						firstErr = fmt.Errorf("transation %x: %w",check.tx.ID,err)
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	//已经有检查失败时不再分派新的任务
+	for _,check := range checks{
+		select{
+		case jobs <- check:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil{
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return firstErr
+}
+
+//查找交易输入引用的输出，输出不存在或者已经花费时返回ErrOutputSpent
+type outputSource func(txid []byte,index int) (TXOutput,error)
+
+//从一组未花费输出中查找，FindAllUTXO和findUTXOFrom的结果用
+func utxoMapSource(utxo map[string]TXOutputs) outputSource{
+	return func(txid []byte,index int) (TXOutput,error){
+		out,ok := utxo[hex.EncodeToString(txid)].Outputs[index]
+		if !ok{
+			return TXOutput{},fmt.Errorf("%w: %s",ErrOutputSpent,outpointKey(txid,index))
+		}
+		return out,nil
+	}
+}
+
+//区块交易引用的输出从哪里查找：接在最新区块后面时查UTXO集，
+//在分叉上时从它的前一个区块开始遍历，算出那条链上的未花费输出
+func (bc *BlockChain) blockOutputSource(prevBlockHash []byte) (outputSource,error){
+	if bytes.Equal(prevBlockHash,bc.tip){
+		return UTXOSet{bc}.FindOutput,nil
+	}
+	utxo,err := bc.findUTXOFrom(prevBlockHash)
+	if err != nil{
+		return nil,err
+	}
+	return utxoMapSource(utxo),nil
+}
+
+//收集一组交易中所有输入的签名检查。交易ID必须和内容相符，
+//引用的输出必须在source中未花费，或者是同一组中排在前面的交易的输出。
+//同时检查金额：输出金额必须为正，总额不能超过引用输出的总额，同一个输出在这组交易中只能花费一次，
+//coinbase交易的输出总额不能超过挖矿奖励加上这组交易的手续费
+func collectSigChecks(txs []*Transation,source outputSource) ([]sigCheck,error){
+	var checks []sigCheck
+	inGroup := make(map[string]Transation)
+	spent := make(map[string]bool)
+	var fees Amount
+	var coinbases []*Transation
+
+	for _,tx := range txs{
+		err := tx.checkID()
+		if err != nil{
+			return nil,err
+		}
+		if tx.isCoinBase(){
+			coinbases = append(coinbases,tx)
+		}else{
+			var prevOuts []TXOutput
+			for inID,vin := range tx.Vin{
+				outpoint := outpointKey(vin.TXid,vin.Voutindex)
+				if spent[outpoint]{
+					return nil,fmt.Errorf("transation %x: %w: output %s is spent twice",tx.ID,ErrInvalidTransation,outpoint)
+				}
+				spent[outpoint] = true
+
+				//先找同一组中前面的交易，再找链上的未花费输出
+				var prevOut TXOutput
+				var err error
+				if prevTX,ok := inGroup[hex.EncodeToString(vin.TXid)]; ok{
+					prevOut,err = prevOutput(map[string]Transation{hex.EncodeToString(vin.TXid): prevTX},vin)
+				}else{
+					prevOut,err = source(vin.TXid,vin.Voutindex)
+				}
+				if err != nil{
+					return nil,fmt.Errorf("transation %x: %w",tx.ID,err)
+				}
+				checks = append(checks,sigCheck{tx,inID,prevOut})
+				prevOuts = append(prevOuts,prevOut)
+			}
+
+			fee,err := checkTransationAmounts(tx,prevOuts)
+			if err != nil{
+				return nil,fmt.Errorf("transation %x: %w",tx.ID,err)
+			}
+			fees,err = fees.Add(fee)
+			if err != nil{
+				return nil,fmt.Errorf("transation %x: %w",tx.ID,err)
+			}
+		}
+		inGroup[hex.EncodeToString(tx.ID)] = *tx
+	}
+
+	maxReward,err := subsidy.Add(fees)
+	if err != nil{
+		return nil,err
+	}
+	var reward Amount
+	for _,coinbase := range coinbases{
+		for _,out := range coinbase.Vout{
+			reward,err = reward.Add(out.Value)
+			if err != nil{
+				return nil,fmt.Errorf("coinbase %x: %w: %v",coinbase.ID,ErrInvalidTransation,err)
+			}
+		}
+	}
+	if reward > maxReward{
+		return nil,fmt.Errorf("%w: coinbase pays %s, subsidy plus fees is %s",ErrInvalidTransation,reward,maxReward)
+	}
+	return checks,nil
+}
+
+//检查交易金额：输出金额必须为正，每个金额和输入、输出的总额都不能超过MaxMoney，
+//输出总额不能超过引用输出的总额，prevOuts和Vin一一对应。返回手续费，即两个总额的差
+func checkTransationAmounts(tx *Transation,prevOuts []TXOutput) (Amount,error){
+	var inSum Amount
+	for _,prevOut := range prevOuts{
+		var err error
+		inSum,err = inSum.Add(prevOut.Value)
+		if err != nil{
+			return 0,fmt.Errorf("%w: inputs: %v",ErrInvalidTransation,err)
+		}
+	}
+	var outSum Amount
+	for _,out := range tx.Vout{
+		if out.Value <= 0{
+			return 0,fmt.Errorf("%w: output value %s is not positive",ErrInvalidTransation,out.Value)
+		}
+		var err error
+		outSum,err = outSum.Add(out.Value)
+		if err != nil{
+			return 0,fmt.Errorf("%w: outputs: %v",ErrInvalidTransation,err)
+		}
+	}
+	fee,err := inSum.Sub(outSum)
+	if err != nil{
+		return 0,fmt.Errorf("%w: outputs %s exceed inputs %s",ErrInvalidTransation,outSum,inSum)
+	}
+	return fee,nil
+}
+
+//验证接在最新区块后面的一组交易：引用的输出必须在UTXO集中，签名检查分给CPU个数的worker并行执行
+func (bc *BlockChain) VerifyTransations(txs []*Transation) error{
+	return verifyTransations(txs,UTXOSet{bc}.FindOutput)
+}
+
+func verifyTransations(txs []*Transation,source outputSource) error{
+	checks,err := collectSigChecks(txs,source)
+	if err != nil{
+		return err
+	}
+	return verifySigChecks(checks,verifyWorkers)
+}
+
+//验证区块的大小限制和区块中所有交易的签名，超出限制、签名错误、
+//引用的输出在区块所在的链上不存在或已经花费时返回ErrInvalidBlock
+func (bc *BlockChain) VerifyBlock(block *Block) error{
+	err := checkBlockLimits(block.Transations)
+	if err != nil{
+		return fmt.Errorf("%w: %x: %v",ErrInvalidBlock,block.Hash,err)
+	}
+	source,err := bc.blockOutputSource(block.PrevBlockHash)
+	if err != nil{
+		return fmt.Errorf("%w: %x: %v",ErrInvalidBlock,block.Hash,err)
+	}
+	err = verifyTransations(block.Transations,source)
+	if err != nil{
+		return fmt.Errorf("%w: %x: %v",ErrInvalidBlock,block.Hash,err)
+	}
+	return nil
+}
+
+//检查区块的共识限制：总重量不超过chainParams.MaxBlockWeight。
+//这个检查很快，先于签名验证执行
+func checkBlockLimits(txs []*Transation) error{
+	if weight := blockWeight(txs); weight > chainParams.MaxBlockWeight{
+		return fmt.Errorf("block weight %d exceeds the limit %d",weight,chainParams.MaxBlockWeight)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+//大区块：benchBlockTxs笔交易，每笔花费benchBlockInputs个虚构的输出
+const (
+	benchBlockTxs    = 500
+	benchBlockInputs = 4
+)
+
+//构造一个大区块全部输入的签名检查，签名检查直接使用虚构的输出，不需要区块链数据库
+func benchSigChecks(b *testing.B) []sigCheck{
+	b.Helper()
+	wallet,err := NewWallet()
+	if err != nil{
+		b.Fatal(err)
+	}
+	pubkeyhash := HashPubKey(wallet.PublicKey)
+
+	var checks []sigCheck
+	for i := 0; i < benchBlockTxs; i++{
+		tx := &Transation{}
+		var prevOuts []TXOutput
+		for j := 0; j < benchBlockInputs; j++{
+			prevID := sha256.Sum256([]byte(fmt.Sprintf("prev-%d-%d",i,j)))
+			tx.Vin = append(tx.Vin,TXInput{prevID[:],0,nil,wallet.PublicKey,SequenceFinal})
+			prevOuts = append(prevOuts,TXOutput{10,pubkeyhash})
+		}
+		tx.Vout = []TXOutput{{10 * benchBlockInputs,pubkeyhash}}
+		tx.ID = tx.Hash()
+		for j,prevOut := range prevOuts{
+			err = tx.SignInput(j,wallet.PrivateKey,prevOut,SigHashAll)
+			if err != nil{
+				b.Fatal(err)
+			}
+			checks = append(checks,sigCheck{tx,j,prevOut})
+		}
+	}
+	return checks
+}
+
+//比较单个goroutine和CPU个数的worker验证同一个大区块，以及签名缓存全部命中时的速度
+func BenchmarkVerifyBlock(b *testing.B){
+	checks := benchSigChecks(b)
+	saved := sigCache
+	defer func() { sigCache = saved }()
+
+	benchmarks := []struct{
+		name    string
+		workers int
+		cached  bool
+	}{
+		{"serial",1,false},
+		{"parallel",runtime.NumCPU(),false},
+		{"serial-cached",1,true},
+		{"parallel-cached",runtime.NumCPU(),true},
+	}
+	for _,bm := range benchmarks{
+		b.Run(bm.name,func(b *testing.B){
+			sigCache = NewSigCache(0)
+			if bm.cached{
+				//交易在进入交易池时已经验证过，缓存中有全部签名
+				sigCache = NewSigCache(len(checks))
+				err := verifySigChecks(checks,bm.workers)
+				if err != nil{
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++{
+				err := verifySigChecks(checks,bm.workers)
+				if err != nil{
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(checks)*b.N)/b.Elapsed().Seconds(),"sigs/s")
+		})
+	}
+}
+
+//签名错误时并行验证返回错误，不会因为别的worker取消而漏掉
+func TestVerifySigChecksFailure(t *testing.T){
+	saved := sigCache
+	sigCache = NewSigCache(0)
+	defer func() { sigCache = saved }()
+
+	wallet,err := NewWallet()
+	if err != nil{
+		t.Fatal(err)
+	}
+	prevOut := TXOutput{10,HashPubKey(wallet.PublicKey)}
+	var checks []sigCheck
+	for i := 0; i < 8; i++{
+		prevID := sha256.Sum256([]byte(fmt.Sprintf("prev-%d",i)))
+		tx := &Transation{Vin: []TXInput{{prevID[:],0,nil,wallet.PublicKey,SequenceFinal}},Vout: []TXOutput{prevOut}}
+		tx.ID = tx.Hash()
+		err = tx.SignInput(0,wallet.PrivateKey,prevOut,SigHashAll)
+		if err != nil{
+			t.Fatal(err)
+		}
+		checks = append(checks,sigCheck{tx,0,prevOut})
+	}
+	for _,workers := range []int{1,4}{
+		if err := verifySigChecks(checks,workers); err != nil{
+			t.Fatalf("workers=%d: %v",workers,err)
+		}
+	}
+
+	checks[5].tx.Vout[0].Value++
+	for _,workers := range []int{1,4}{
+		if err := verifySigChecks(checks,workers); err == nil{
+			t.Fatalf("workers=%d: tampered transation verified",workers)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"bytes"
 	"crypto/ecdsa"
-	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/gob"
 	"fmt"
+	"math/big"
 	"golang.org/x/crypto/ripemd160"
 )
 
@@ -17,13 +18,97 @@ const addressChecksumLen = 4 //定义checksum长度为四个字节
 type Wallet struct{
 	PrivateKey  ecdsa.PrivateKey
 	PublicKey  []byte
+	encryptedKey []byte  //钱包集加密后，用主密钥加密的私钥；钱包锁定时PrivateKey.D为nil
+	hdPath []uint32  //HD钱包派生出的地址的派生路径，随机生成的地址为nil
 }
 
-//创建钱包对象,返回指针
-func NewWallet() *Wallet{
-	private,public := newKeyPair()
-	wallet := Wallet{private, public}
-	return &wallet
+//创建钱包对象,返回指针，使用默认曲线DefaultCurve
+func NewWallet() (*Wallet,error){
+	return NewWalletOnCurve(DefaultCurve)
+}
+
+//在指定的曲线上创建钱包对象
+func NewWalletOnCurve(curve CurveID) (*Wallet,error){
+	private,public,err := newKeyPair(curve)
+	if err != nil{
+		return nil,err
+	}
+	wallet := Wallet{PrivateKey: private, PublicKey: public}
+	return &wallet,nil
+}
+
+//钱包使用的曲线
+func (w *Wallet) Curve() CurveID{
+	return curveIDOf(w.PrivateKey.Curve)
+}
+
+//钱包序列化时保存的数据。ecdsa.PrivateKey中的曲线是接口，新版本的Go不能再用gob直接序列化，
+//所以只保存曲线编号、私钥D和编码后的公钥，读取时再重新计算出公钥点。
+//钱包集加密后不保存D，只保存加密的私钥EncryptedKey，公钥点从PublicKey解析出来
+type walletData struct{
+	Curve      CurveID
+	D          []byte
+	PublicKey  []byte
+	EncryptedKey []byte
+	HDPath     []uint32
+}
+
+//实现gob.GobEncoder
+func (w *Wallet) GobEncode() ([]byte,error){
+	id := w.Curve()
+	if id == 0{
+		return nil,fmt.Errorf("%w: unsupported curve",ErrWalletFile)
+	}
+	data := walletData{id,nil,w.PublicKey,w.encryptedKey,w.hdPath}
+	if w.encryptedKey == nil{
+		if w.PrivateKey.D == nil{
+			return nil,fmt.Errorf("%w: wallet has no private key",ErrWalletFile)
+		}
+		data.D = w.PrivateKey.D.Bytes()
+	}
+
+	var content bytes.Buffer
+	err := gob.NewEncoder(&content).Encode(data)
+	if err != nil{
+		return nil,err
+	}
+	return content.Bytes(),nil
+}
+
+//实现gob.GobDecoder
+func (w *Wallet) GobDecode(b []byte) error{
+	var data walletData
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data)
+	if err != nil{
+		return err
+	}
+	curve := data.Curve.Curve()
+	if curve == nil{
+		return fmt.Errorf("%w: unknown curve %d",ErrWalletFile,data.Curve)
+	}
+
+	//加密的钱包读出来是锁定的，只有公钥
+	if data.EncryptedKey != nil{
+		pub,err := ParsePubKey(curve,data.PublicKey)
+		if err != nil{
+			return fmt.Errorf("%w: %v",ErrWalletFile,err)
+		}
+		w.PrivateKey = ecdsa.PrivateKey{PublicKey: *pub}
+		w.PublicKey = data.PublicKey
+		w.encryptedKey = data.EncryptedKey
+		w.hdPath = data.HDPath
+		return nil
+	}
+
+	d := new(big.Int).SetBytes(data.D)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0{
+		return fmt.Errorf("%w: invalid private key",ErrWalletFile)
+	}
+	x,y := curve.ScalarBaseMult(data.D)
+	w.PrivateKey = ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: x, Y: y}, D: d}
+	w.PublicKey = data.PublicKey
+	w.hdPath = data.HDPath
+	return nil
 }
 
 //获取钱包地址，根据公钥计算出比特币地址。
@@ -33,7 +118,7 @@ func (w *Wallet) GetAddress() []byte  {
 	ripemd160Hash := HashPubKey(w.PublicKey)
 
 	//将version+Pub Key hash
-	version_ripemd160Hash := append([]byte{version},ripemd160Hash...)
+	version_ripemd160Hash := append([]byte{chainParams.PubKeyHashAddrID},ripemd160Hash...)
 
 	//调用CheckSum方法返回前四个字节的checksum
 	checkSumBytes := CheckSum(version_ripemd160Hash)
@@ -49,22 +134,25 @@ func (w *Wallet) GetAddress() []byte  {
 
 //===============================================
 
-//生成私钥和公钥
-func newKeyPair() (ecdsa.PrivateKey,[]byte){
+//在指定的曲线上生成私钥和公钥
+func newKeyPair(id CurveID) (ecdsa.PrivateKey,[]byte,error){
 
-	//生成椭圆曲线,  secp256r1 曲线。 比特币当中的曲线是secp256k1
-	curve :=elliptic.P256()
+	//椭圆曲线，比特币当中的曲线是secp256k1，早期钱包用的是secp256r1（P256）
+	curve := id.Curve()
+	if curve == nil{
+		return ecdsa.PrivateKey{},nil,fmt.Errorf("unsupported curve %s",id)
+	}
 
 	private,err :=ecdsa.GenerateKey(curve,rand.Reader)
 
 	if err !=nil{
-
-		fmt.Println("error")
+		return ecdsa.PrivateKey{},nil,err
 	}
 
-	//拼接x和y坐标，就是公钥
-	pubkey :=append(private.PublicKey.X.Bytes(),private.PublicKey.Y.Bytes()...)
-	return *private,pubkey
+	//公钥用SEC1压缩格式编码，固定33字节。
+	//早期的钱包直接拼接x和y坐标，这些钱包的公钥保持原样，地址不会变
+	pubkey := MarshalPubKey(&private.PublicKey,true)
+	return *private,pubkey,nil
 
 }
 
@@ -95,28 +183,17 @@ func HashPubKey(publicKey []byte) []byte {
 }
 
 
-//判断地址是否有效
+//判断地址是否有效，要知道哪里不对用DecodeAddress
 func IsValidAdress(adress []byte) bool {
-	//将地址进行base58反编码，生成的其实是version+Pub Key hash+ checksum这25个字节
-	version_public_checksumBytes := Base58Decode(adress)
-
-	//[25-4:],就是21个字节往后的数（22,23,24,25一共4个字节）
-	checkSumBytes := version_public_checksumBytes[len(version_public_checksumBytes) - addressChecksumLen:]
-	//[:25-4],就是前21个字节（1～21,一共21个字节）
-	version_ripemd160 := version_public_checksumBytes[:len(version_public_checksumBytes) - addressChecksumLen]
-	//取version+public+checksum的字节数组的前21个字节进行两次256哈希运算，取结果值的前4个字节
-	checkBytes := CheckSum(version_ripemd160)
-	//将checksum比较，如果一致则说明地址有效，返回true
-	if bytes.Compare(checkSumBytes,checkBytes) == 0 {
-		return true
-	}
-
-	return false
+	_,err := DecodeAddress(string(adress),chainParams)
+	return err == nil
 }
 
-//根据字符串形式的地址--->公钥hash
-func GetPubKeyHash(address string) []byte{
-	decodeAddress := Base58Decode([]byte(address))
-	pubkeyhash := decodeAddress[1:len(decodeAddress)-addressChecksumLen]
-	return pubkeyhash
+//根据字符串形式的地址--->公钥hash，地址校验不通过返回ErrInvalidAddress
+func GetPubKeyHash(address string) ([]byte,error){
+	addr,err := DecodeAddress(address,chainParams)
+	if err != nil{
+		return nil,err
+	}
+	return addr.PubKeyHash,nil
 }
\ No newline at end of file
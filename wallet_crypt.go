@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//加密钱包：每个私钥用随机生成的主密钥做AES-256-GCM加密，主密钥再用口令经scrypt派生出的密钥加密。
+//修改口令只需要重新加密主密钥。钱包文件中只保存加密后的私钥，读出来的钱包是锁定的，
+//解锁后才能签名。主密钥和解密的私钥只在内存中，不写入任何文件
+type WalletEncryption struct{
+	Salt      []byte //scrypt的盐
+	ScryptN   int    //scrypt的参数
+	ScryptR   int
+	ScryptP   int
+	MasterKey []byte //口令派生的密钥加密后的主密钥：nonce+密文
+}
+
+const (
+	walletKeyLen       = 32        //主密钥和口令派生密钥的长度，AES-256
+	walletUnlockSuffix = ".unlock" //旧版本保存主密钥的解锁文件，读钱包时删除
+)
+
+//本进程中用UnlockFor解锁的钱包文件，key是钱包文件的绝对路径。主密钥只在内存中，
+//超时后定时器把它清除。长时间运行的进程（比如节点）在超时之前打开这个钱包文件时直接解锁，
+//已经打开的钱包集在Close时锁定
+var walletUnlocks = struct{
+	sync.Mutex
+	held map[string]*walletUnlock
+}{held: make(map[string]*walletUnlock)}
+
+type walletUnlock struct{
+	masterKey []byte
+	timer     *time.Timer
+}
+
+//用新口令加密主密钥，每次都用新的盐
+func newWalletEncryption(passphrase string,masterKey []byte) (*WalletEncryption,error){
+	salt := make([]byte,16)
+	_,err := rand.Read(salt)
+	if err != nil{
+		return nil,err
+	}
+	enc := &WalletEncryption{Salt: salt,ScryptN: 1 << 15,ScryptR: 8,ScryptP: 1}
+	key,err := enc.passphraseKey(passphrase)
+	if err != nil{
+		return nil,err
+	}
+	enc.MasterKey,err = sealAESGCM(key,masterKey,nil)
+	if err != nil{
+		return nil,err
+	}
+	return enc,nil
+}
+
+//由口令派生出加密主密钥用的密钥
+func (enc *WalletEncryption) passphraseKey(passphrase string) ([]byte,error){
+	return scrypt.Key([]byte(passphrase),enc.Salt,enc.ScryptN,enc.ScryptR,enc.ScryptP,walletKeyLen)
+}
+
+//用口令解密主密钥，口令错误返回ErrWrongPassphrase
+func (enc *WalletEncryption) decryptMasterKey(passphrase string) ([]byte,error){
+	key,err := enc.passphraseKey(passphrase)
+	if err != nil{
+		return nil,err
+	}
+	masterKey,err := openAESGCM(key,enc.MasterKey,nil)
+	if err != nil{
+		return nil,ErrWrongPassphrase
+	}
+	return masterKey,nil
+}
+
+//AES-GCM加密，返回 nonce+密文。aad是不加密但参与认证的数据
+func sealAESGCM(key,plaintext,aad []byte) ([]byte,error){
+	block,err := aes.NewCipher(key)
+	if err != nil{
+		return nil,err
+	}
+	gcm,err := cipher.NewGCM(block)
+	if err != nil{
+		return nil,err
+	}
+	nonce := make([]byte,gcm.NonceSize())
+	_,err = rand.Read(nonce)
+	if err != nil{
+		return nil,err
+	}
+	return gcm.Seal(nonce,nonce,plaintext,aad),nil
+}
+
+//AES-GCM解密 nonce+密文，密钥不对或数据被改过时返回错误
+func openAESGCM(key,sealed,aad []byte) ([]byte,error){
+	block,err := aes.NewCipher(key)
+	if err != nil{
+		return nil,err
+	}
+	gcm,err := cipher.NewGCM(block)
+	if err != nil{
+		return nil,err
+	}
+	if len(sealed) < gcm.NonceSize(){
+		return nil,fmt.Errorf("ciphertext too short")
+	}
+	return gcm.Open(nil,sealed[:gcm.NonceSize()],sealed[gcm.NonceSize():],aad)
+}
+
+//用主密钥加密钱包的私钥，公钥作为认证数据，加密的私钥不能挪到别的钱包上用
+func (w *Wallet) encryptKey(masterKey []byte) error{
+	sealed,err := sealAESGCM(masterKey,w.PrivateKey.D.Bytes(),w.PublicKey)
+	if err != nil{
+		return err
+	}
+	w.encryptedKey = sealed
+	return nil
+}
+
+//用主密钥解密钱包的私钥，解出的私钥必须和公钥对得上
+func (w *Wallet) decryptKey(masterKey []byte) error{
+	plain,err := openAESGCM(masterKey,w.encryptedKey,w.PublicKey)
+	if err != nil{
+		return fmt.Errorf("%w: cannot decrypt key: %v",ErrWalletFile,err)
+	}
+	curve := w.PrivateKey.Curve
+	d := new(big.Int).SetBytes(plain)
+	x,y := curve.ScalarBaseMult(plain)
+	if d.Sign() == 0 || x.Cmp(w.PrivateKey.X) != 0 || y.Cmp(w.PrivateKey.Y) != 0{
+		return fmt.Errorf("%w: decrypted key does not match the public key",ErrWalletFile)
+	}
+	w.PrivateKey.D = d
+	return nil
+}
+
+//钱包是否锁定：私钥加密了，还没有解密到内存中
+func (w *Wallet) Locked() bool{
+	return w.PrivateKey.D == nil
+}
+
+//钱包集是否加密了
+func (ws *Wallets) IsEncrypted() bool{
+	return ws.Encryption != nil
+}
+
+//钱包集是否锁定，锁定时不能签名，也不能创建新地址
+func (ws *Wallets) IsLocked() bool{
+	return ws.Encryption != nil && ws.masterKey == nil
+}
+
+//用口令加密钱包集并写入文件，加密后钱包是锁定的。已经加密过返回ErrWalletEncrypted
+func (ws *Wallets) Encrypt(passphrase string) error{
+	if ws.IsEncrypted(){
+		return ErrWalletEncrypted
+	}
+	if passphrase == ""{
+		return fmt.Errorf("%w: passphrase is empty",ErrWrongPassphrase)
+	}
+	masterKey := make([]byte,walletKeyLen)
+	_,err := rand.Read(masterKey)
+	if err != nil{
+		return err
+	}
+	enc,err := newWalletEncryption(passphrase,masterKey)
+	if err != nil{
+		return err
+	}
+	for _,wallet := range ws.Store{
+		err = wallet.encryptKey(masterKey)
+		if err != nil{
+			return err
+		}
+	}
+	if ws.HDChain != nil{
+		err = ws.HDChain.encryptSeed(masterKey)
+		if err != nil{
+			return err
+		}
+	}
+	ws.Encryption = enc
+	err = ws.SaveToFile2()
+	if err != nil{
+		return err
+	}
+	ws.Lock()
+	//以前的备份中是明文私钥
+	return ws.reencryptBackups(nil)
+}
+
+//用口令解锁钱包集，只在本进程的内存中有效。口令错误返回ErrWrongPassphrase
+func (ws *Wallets) Unlock(passphrase string) error{
+	if !ws.IsEncrypted(){
+		return ErrNotEncrypted
+	}
+	masterKey,err := ws.Encryption.decryptMasterKey(passphrase)
+	if err != nil{
+		return err
+	}
+	return ws.unlockWithMasterKey(masterKey)
+}
+
+//用主密钥解密全部私钥
+func (ws *Wallets) unlockWithMasterKey(masterKey []byte) error{
+	for _,wallet := range ws.Store{
+		err := wallet.decryptKey(masterKey)
+		if err != nil{
+			ws.Lock()
+			return err
+		}
+	}
+	if ws.HDChain != nil{
+		err := ws.HDChain.decryptSeed(masterKey)
+		if err != nil{
+			ws.Lock()
+			return err
+		}
+	}
+	ws.masterKey = masterKey
+	return nil
+}
+
+//锁定钱包集，清除内存中的主密钥和私钥
+func (ws *Wallets) Lock(){
+	if !ws.IsEncrypted(){
+		return
+	}
+	for _,wallet := range ws.Store{
+		if wallet.PrivateKey.D != nil{
+			wallet.PrivateKey.D.SetInt64(0)
+			wallet.PrivateKey.D = nil
+		}
+	}
+	if ws.HDChain != nil{
+		ws.HDChain.lock()
+	}
+	for i := range ws.masterKey{
+		ws.masterKey[i] = 0
+	}
+	ws.masterKey = nil
+}
+
+//修改口令：用旧口令解出主密钥，再用新口令加密后写入文件，私钥的密文不变
+func (ws *Wallets) ChangePassphrase(oldPassphrase,newPassphrase string) error{
+	if !ws.IsEncrypted(){
+		return ErrNotEncrypted
+	}
+	if newPassphrase == ""{
+		return fmt.Errorf("%w: passphrase is empty",ErrWrongPassphrase)
+	}
+	masterKey,err := ws.Encryption.decryptMasterKey(oldPassphrase)
+	if err != nil{
+		return err
+	}
+	enc,err := newWalletEncryption(newPassphrase,masterKey)
+	if err != nil{
+		return err
+	}
+	old := ws.Encryption
+	ws.Encryption = enc
+	err = ws.SaveToFile2()
+	if err != nil{
+		ws.Encryption = old
+		return err
+	}
+	//以前的备份用旧口令也能打开
+	return ws.reencryptBackups(old)
+}
+
+//钱包集加密后新建的私钥也要加密，锁定时返回ErrWalletLocked
+func (ws *Wallets) protectNewWallet(wallet *Wallet) error{
+	if !ws.IsEncrypted(){
+		return nil
+	}
+	if ws.IsLocked(){
+		return ErrWalletLocked
+	}
+	return wallet.encryptKey(ws.masterKey)
+}
+
+//用口令解锁钱包集timeout这么长时间：主密钥保存在本进程的内存中，超时之前本进程再打开这个钱包文件时不用再输入口令
+func (ws *Wallets) UnlockFor(passphrase string,timeout time.Duration) error{
+	if timeout <= 0{
+		return fmt.Errorf("timeout must be positive")
+	}
+	err := ws.Unlock(passphrase)
+	if err != nil{
+		return err
+	}
+	key,err := filepath.Abs(ws.path())
+	if err != nil{
+		return err
+	}
+	unlock := &walletUnlock{masterKey: append([]byte{},ws.masterKey...)}
+	walletUnlocks.Lock()
+	defer walletUnlocks.Unlock()
+	forgetUnlock(key)
+	unlock.timer = time.AfterFunc(timeout,func(){
+		walletUnlocks.Lock()
+		defer walletUnlocks.Unlock()
+		if walletUnlocks.held[key] == unlock{
+			forgetUnlock(key)
+		}
+	})
+	walletUnlocks.held[key] = unlock
+	return nil
+}
+
+//清除内存中保存的主密钥，调用时要持有walletUnlocks的锁
+func forgetUnlock(key string){
+	unlock,ok := walletUnlocks.held[key]
+	if !ok{
+		return
+	}
+	unlock.timer.Stop()
+	for i := range unlock.masterKey{
+		unlock.masterKey[i] = 0
+	}
+	delete(walletUnlocks.held,key)
+}
+
+//刚读出来的加密钱包集：本进程中UnlockFor还没有过期就用内存中的主密钥解锁。
+//旧版本在钱包文件旁边保存的解锁文件中有明文的主密钥，发现了就删除
+func (ws *Wallets) loadUnlock() error{
+	err := os.Remove(ws.path() + walletUnlockSuffix)
+	if err != nil && !os.IsNotExist(err){
+		return err
+	}
+	key,err := filepath.Abs(ws.path())
+	if err != nil{
+		return err
+	}
+	walletUnlocks.Lock()
+	defer walletUnlocks.Unlock()
+	unlock,ok := walletUnlocks.held[key]
+	if !ok{
+		return nil
+	}
+	err = ws.unlockWithMasterKey(append([]byte{},unlock.masterKey...))
+	if err != nil{
+		//钱包文件换过了，主密钥对不上
+		forgetUnlock(key)
+	}
+	return nil
+}
+
+//签名前检查私钥是否可用
+func checkPrivateKey(key *ecdsa.PrivateKey) error{
+	if key.D == nil{
+		return ErrWalletLocked
+	}
+	return nil
+}
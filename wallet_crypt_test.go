@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+//测试结束时清除本进程内存中保存的主密钥
+func forgetTestUnlocks(t *testing.T){
+	t.Cleanup(func(){
+		walletUnlocks.Lock()
+		defer walletUnlocks.Unlock()
+		for key := range walletUnlocks.held{
+			forgetUnlock(key)
+		}
+	})
+}
+
+//加密后钱包文件中没有明文私钥，读出来是锁定的，锁定时不能签名，解锁后可以
+func TestWalletEncryption(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	forgetTestUnlocks(t)
+	b,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	secret := ws.Store[addr].PrivateKey.D.Bytes()
+
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if err := ws.Encrypt("pw"); !errors.Is(err,ErrWalletEncrypted){
+		t.Errorf("encrypting twice: err = %v, want ErrWalletEncrypted",err)
+	}
+	data,err := os.ReadFile(walletFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if bytes.Contains(data,secret){
+		t.Error("wallet file still contains the plaintext private key")
+	}
+	if st,_ := os.Stat(walletFile); st.Mode().Perm() != 0600{
+		t.Errorf("wallet file mode = %v, want 0600",st.Mode().Perm())
+	}
+
+	locked,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	if !locked.IsLocked() || len(locked.GetAllAddress()) != 2 || locked.Store[addr].PrivateKey.X == nil{
+		t.Fatal("encrypted wallet is not loaded locked with its public keys")
+	}
+	if _,err := NewUTXOTransation(addr,b,Coin,SendOptions{},bc); !errors.Is(err,ErrWalletLocked){
+		t.Errorf("send from a locked wallet: err = %v, want ErrWalletLocked",err)
+	}
+	if _,err := locked.CreateWallet(CurveP256); !errors.Is(err,ErrWalletLocked){
+		t.Errorf("create in a locked wallet: err = %v, want ErrWalletLocked",err)
+	}
+	if err := locked.UnlockFor("bad",time.Minute); !errors.Is(err,ErrWrongPassphrase){
+		t.Errorf("wrong passphrase: err = %v, want ErrWrongPassphrase",err)
+	}
+	if err := locked.UnlockFor("pw",time.Minute); err != nil{
+		t.Fatal(err)
+	}
+	if !bytes.Equal(locked.Store[addr].PrivateKey.D.Bytes(),secret){
+		t.Error("unlocked private key differs from the original")
+	}
+	if _,err := os.Stat(walletFile + walletUnlockSuffix); !os.IsNotExist(err){
+		t.Error("UnlockFor wrote an unlock file")
+	}
+	locked.Close()
+	if locked.Store[addr].PrivateKey.D != nil{
+		t.Error("Close kept the private key in memory")
+	}
+
+	//解锁没有过期，本进程再打开钱包文件时是解锁的
+	if _,err := NewUTXOTransation(addr,b,Coin,SendOptions{},bc); err != nil{
+		t.Errorf("send while unlocked: %v",err)
+	}
+}
+
+func TestChangePassphrase(t *testing.T){
+	_,ws,_ := newTestChain(t)
+	forgetTestUnlocks(t)
+	if err := ws.ChangePassphrase("","pw"); !errors.Is(err,ErrNotEncrypted){
+		t.Errorf("unencrypted wallet: err = %v, want ErrNotEncrypted",err)
+	}
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if err := ws.ChangePassphrase("bad","pw2"); !errors.Is(err,ErrWrongPassphrase){
+		t.Errorf("wrong old passphrase: err = %v, want ErrWrongPassphrase",err)
+	}
+	if err := ws.ChangePassphrase("pw",""); !errors.Is(err,ErrWrongPassphrase){
+		t.Errorf("empty new passphrase: err = %v, want ErrWrongPassphrase",err)
+	}
+	if err := ws.ChangePassphrase("pw","pw2"); err != nil{
+		t.Fatal(err)
+	}
+
+	reloaded,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if err := reloaded.Unlock("pw"); !errors.Is(err,ErrWrongPassphrase){
+		t.Errorf("old passphrase: err = %v, want ErrWrongPassphrase",err)
+	}
+	if err := reloaded.Unlock("pw2"); err != nil{
+		t.Errorf("new passphrase: %v",err)
+	}
+}
+
+//UnlockFor超时后主密钥从内存中清除，再打开钱包文件是锁定的；旧版本的解锁文件读钱包时删除
+func TestUnlockForExpires(t *testing.T){
+	_,ws,_ := newTestChain(t)
+	forgetTestUnlocks(t)
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if err := ws.UnlockFor("pw",0); err == nil{
+		t.Error("UnlockFor accepted a zero timeout")
+	}
+	if err := ws.UnlockFor("pw",200*time.Millisecond); err != nil{
+		t.Fatal(err)
+	}
+	ws.Close()
+
+	unlocked,_ := NewWallets()
+	if unlocked.IsLocked(){
+		t.Error("wallet is locked before the timeout")
+	}
+	unlocked.Close()
+
+	time.Sleep(400 * time.Millisecond)
+	if err := os.WriteFile(walletFile+walletUnlockSuffix,[]byte("old"),0600); err != nil{
+		t.Fatal(err)
+	}
+	expired,_ := NewWallets()
+	defer expired.Close()
+	if !expired.IsLocked(){
+		t.Error("wallet is still unlocked after the timeout")
+	}
+	if _,err := os.Stat(walletFile + walletUnlockSuffix); !os.IsNotExist(err){
+		t.Error("legacy unlock file was not removed")
+	}
+}
+
+//walletPassphrase解锁后在本进程中执行输入的命令，walletLock锁定钱包并结束
+func TestWalletPassphraseSession(t *testing.T){
+	bc,ws,addr := newTestChain(t)
+	forgetTestUnlocks(t)
+	b,_ := ws.CreateWallet(DefaultCurve)
+	if err := ws.SaveToFile2(); err != nil{
+		t.Fatal(err)
+	}
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	t.Setenv("NODE_ID","3999")
+	args,reader := os.Args,stdinReader
+	t.Cleanup(func(){
+		os.Args,stdinReader = args,reader
+	})
+
+	cli := CLI{bc}
+	stdinReader = bufio.NewReader(strings.NewReader("\nwalletPassphrase\nsend -from " + addr + " -to " + b + " -amount 1 -mine\nwalletLock\nsend -from x\n"))
+	if err := cli.walletPassphrase("pw",time.Minute); err != nil{
+		t.Fatal(err)
+	}
+	if got,_ := cli.GetBalance(b); got != Coin{
+		t.Errorf("balance of b = %s after the send in the session, want 1",got)
+	}
+	after,_ := NewWallets()
+	defer after.Close()
+	if !after.IsLocked(){
+		t.Error("wallet is still unlocked after walletLock")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+//钱包文件的保存、加锁和备份。
+//保存时先写到同一目录下的临时文件并fsync，再改名覆盖原文件，写到一半崩溃时原文件还是完整的；
+//覆盖前把原来的内容复制到备份目录，只保留最近walletBackupKeep份，加密的钱包集不备份加密以前的明文；
+//打开钱包时对 钱包文件.lock 加排它锁，直到Close，另一个进程要等它关闭才能打开同一个钱包
+const (
+	walletLockSuffix  = ".lock"
+	walletLockTimeout = 3 * time.Second //等待别的进程关闭钱包的最长时间
+	walletBackupDir   = "wallet_backups"
+	walletBackupKeep  = 10
+)
+
+//把data写到filename：先写临时文件并fsync，再改名，最后fsync目录让改名也落盘
+func writeFileAtomic(filename string,data []byte,perm os.FileMode) error{
+	dir := filepath.Dir(filename)
+	tmp,err := ioutil.TempFile(dir,filepath.Base(filename)+".tmp")
+	if err != nil{
+		return err
+	}
+	//改名成功后临时文件已经不存在，Remove失败可以忽略
+	defer os.Remove(tmp.Name())
+
+	_,err = tmp.Write(data)
+	if err == nil{
+		err = tmp.Chmod(perm)
+	}
+	if err == nil{
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil{
+		err = closeErr
+	}
+	if err != nil{
+		return err
+	}
+	err = os.Rename(tmp.Name(),filename)
+	if err != nil{
+		return err
+	}
+	return syncDir(dir)
+}
+
+//本进程已经加锁的钱包文件，key是绝对路径。同一个进程多次打开同一个钱包共用一把锁，全部Close后才释放
+var walletLocks = struct{
+	sync.Mutex
+	held map[string]*walletFileLock
+}{held: make(map[string]*walletFileLock)}
+
+type walletFileLock struct{
+	file *os.File
+	refs int
+}
+
+//给钱包文件加排它锁，返回释放时用的key。别的进程持有锁时最多等walletLockTimeout，然后返回ErrWalletInUse
+func acquireWalletLock(path string) (string,error){
+	key,err := filepath.Abs(path)
+	if err != nil{
+		return "",err
+	}
+	walletLocks.Lock()
+	defer walletLocks.Unlock()
+	if lock,ok := walletLocks.held[key]; ok{
+		lock.refs++
+		return key,nil
+	}
+
+	file,err := os.OpenFile(key+walletLockSuffix,os.O_RDWR|os.O_CREATE,0600)
+	if err != nil{
+		return "",err
+	}
+	deadline := time.Now().Add(walletLockTimeout)
+	for{
+		locked,err := tryLockFile(file)
+		if err != nil{
+			file.Close()
+			return "",err
+		}
+		if locked{
+			break
+		}
+		if time.Now().After(deadline){
+			file.Close()
+			return "",fmt.Errorf("%w: %s",ErrWalletInUse,path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	walletLocks.held[key] = &walletFileLock{file: file,refs: 1}
+	return key,nil
+}
+
+//释放acquireWalletLock加的锁，锁文件留着，删掉它会和正在等锁的进程冲突
+func releaseWalletLock(key string) error{
+	walletLocks.Lock()
+	defer walletLocks.Unlock()
+	lock,ok := walletLocks.held[key]
+	if !ok{
+		return nil
+	}
+	lock.refs--
+	if lock.refs > 0{
+		return nil
+	}
+	delete(walletLocks.held,key)
+	err := unlockFile(lock.file)
+	closeErr := lock.file.Close()
+	if err == nil{
+		err = closeErr
+	}
+	return err
+}
+
+//关闭钱包集，释放文件锁，加密的钱包集清除内存中的私钥。关闭后不要再保存
+func (ws *Wallets) Close() error{
+	ws.Lock()
+	if ws.lockKey == ""{
+		return nil
+	}
+	err := releaseWalletLock(ws.lockKey)
+	ws.lockKey = ""
+	return err
+}
+
+//覆盖钱包文件之前，把原来的内容复制到备份目录，文件名带上时间，只保留最近walletBackupKeep份。
+//正在加密的钱包集，原来的文件中是明文私钥，不备份
+func (ws *Wallets) rotateBackup() error{
+	old,err := ioutil.ReadFile(ws.path())
+	if os.IsNotExist(err){
+		return nil
+	}
+	if err != nil{
+		return err
+	}
+	if ws.IsEncrypted() && !walletFileEncrypted(old){
+		return nil
+	}
+
+	dir := ws.backupDir()
+	err = os.MkdirAll(dir,0700)
+	if err != nil{
+		return err
+	}
+	name := filepath.Join(dir,filepath.Base(ws.path())+"."+time.Now().Format("20060102-150405.000000")+".bak")
+	err = writeFileAtomic(name,old,0600)
+	if err != nil{
+		return err
+	}
+
+	backups,err := ws.backupFiles()
+	if err != nil{
+		return err
+	}
+	for len(backups) > walletBackupKeep{
+		err = os.Remove(backups[0])
+		if err != nil{
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+//钱包文件的备份目录
+func (ws *Wallets) backupDir() string{
+	return filepath.Join(filepath.Dir(ws.path()),walletBackupDir)
+}
+
+//这个钱包文件的全部备份，按时间从早到晚
+func (ws *Wallets) backupFiles() ([]string,error){
+	backups,err := filepath.Glob(filepath.Join(ws.backupDir(),filepath.Base(ws.path())+".*.bak"))
+	if err != nil{
+		return nil,err
+	}
+	//时间格式按字典序就是时间顺序
+	sort.Strings(backups)
+	return backups,nil
+}
+
+//钱包文件的内容是不是加密的钱包集
+func walletFileEncrypted(content []byte) bool{
+	var saved Wallets
+	err := gob.NewDecoder(bytes.NewReader(content)).Decode(&saved)
+	return err == nil && saved.Encryption != nil
+}
+
+//加密钱包集或者修改口令以后处理旧的备份：里面是明文私钥，或者主密钥是用旧口令加密的。
+//和old加密参数相同的备份换成新的加密参数（私钥的密文不变），其它的删除；old为nil时全部删除
+func (ws *Wallets) reencryptBackups(old *WalletEncryption) error{
+	backups,err := ws.backupFiles()
+	if err != nil{
+		return err
+	}
+	for _,name := range backups{
+		content,err := ioutil.ReadFile(name)
+		if err != nil{
+			return err
+		}
+		var backup Wallets
+		err = gob.NewDecoder(bytes.NewReader(content)).Decode(&backup)
+		if err != nil || old == nil || !sameEncryption(backup.Encryption,old){
+			err = os.Remove(name)
+			if err != nil{
+				return err
+			}
+			continue
+		}
+		backup.Encryption = ws.Encryption
+		var updated bytes.Buffer
+		err = gob.NewEncoder(&updated).Encode(&backup)
+		if err != nil{
+			return err
+		}
+		err = writeFileAtomic(name,updated.Bytes(),0600)
+		if err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+//两个加密参数是不是同一个口令加密的同一个主密钥
+func sameEncryption(a,b *WalletEncryption) bool{
+	return a != nil && b != nil && bytes.Equal(a.Salt,b.Salt) && bytes.Equal(a.MasterKey,b.MasterKey)
+}
+
+//把钱包文件复制到dest，dest是目录时复制到目录下的同名文件，返回备份文件的路径。
+//复制的是文件中保存的内容，加密的钱包集在文件还没有加密时（加密没有保存成功）不备份
+func (ws *Wallets) BackupWallet(dest string) (string,error){
+	if st,err := os.Stat(dest); err == nil && st.IsDir(){
+		dest = filepath.Join(dest,filepath.Base(ws.path()))
+	}
+	src,err := filepath.Abs(ws.path())
+	if err != nil{
+		return "",err
+	}
+	target,err := filepath.Abs(dest)
+	if err != nil{
+		return "",err
+	}
+	if src == target{
+		return "",fmt.Errorf("backup destination %s is the wallet file itself",dest)
+	}
+	content,err := ioutil.ReadFile(src)
+	if err != nil{
+		return "",fmt.Errorf("%w: %v",ErrWalletFile,err)
+	}
+	if ws.IsEncrypted() && !walletFileEncrypted(content){
+		return "",fmt.Errorf("%w: wallet file is not encrypted yet",ErrWalletFile)
+	}
+	err = writeFileAtomic(target,content,0600)
+	if err != nil{
+		return "",err
+	}
+	return target,nil
+}
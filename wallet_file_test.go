@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//目录下有没有写到一半留下的临时文件
+func checkNoTempFiles(t *testing.T,dir string){
+	t.Helper()
+	entries,err := os.ReadDir(dir)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for _,entry := range entries{
+		if strings.Contains(entry.Name(),".tmp"){
+			t.Errorf("temporary file %s left behind",entry.Name())
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T){
+	dir := t.TempDir()
+	name := filepath.Join(dir,"wallet.dat")
+	if err := writeFileAtomic(name,[]byte("first"),0600); err != nil{
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name,[]byte("second"),0600); err != nil{
+		t.Fatal(err)
+	}
+	data,_ := os.ReadFile(name)
+	if string(data) != "second"{
+		t.Errorf("content = %q, want second",data)
+	}
+	if st,_ := os.Stat(name); st.Mode().Perm() != 0600{
+		t.Errorf("mode = %v, want 0600",st.Mode().Perm())
+	}
+
+	//改名失败时原来的目标不变，临时文件删掉
+	target := filepath.Join(dir,"busy")
+	if err := os.Mkdir(target,0700); err != nil{
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(target,[]byte("x"),0600); err == nil{
+		t.Error("writeFileAtomic replaced a directory")
+	}
+	if st,err := os.Stat(target); err != nil || !st.IsDir(){
+		t.Errorf("target changed after a failed write: %v",err)
+	}
+	checkNoTempFiles(t,dir)
+}
+
+//每次保存把原来的文件复制到备份目录，只保留最近walletBackupKeep份
+func TestWalletBackupRotation(t *testing.T){
+	chdirTemp(t)
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if st,_ := os.Stat(walletFile); st.Mode().Perm() != 0600{
+		t.Errorf("wallet file mode = %v, want 0600",st.Mode().Perm())
+	}
+	backups,_ := ws.backupFiles()
+	if len(backups) != 0{
+		t.Fatalf("new wallet has backups %v",backups)
+	}
+
+	var saved [][]byte
+	for i := 0; i < walletBackupKeep+3; i++{
+		content,_ := os.ReadFile(walletFile)
+		saved = append(saved,content)
+		if _,err := ws.GetNewAddress(); err != nil{
+			t.Fatal(err)
+		}
+		if err := ws.SaveToFile2(); err != nil{
+			t.Fatal(err)
+		}
+	}
+	backups,_ = ws.backupFiles()
+	if len(backups) != walletBackupKeep{
+		t.Fatalf("%d backups, want %d",len(backups),walletBackupKeep)
+	}
+	//最新的备份是最后一次保存之前的文件
+	latest,_ := os.ReadFile(backups[len(backups)-1])
+	if string(latest) != string(saved[len(saved)-1]){
+		t.Error("latest backup is not the previous wallet file")
+	}
+	oldest,_ := os.ReadFile(backups[0])
+	if string(oldest) != string(saved[len(saved)-walletBackupKeep]){
+		t.Error("oldest kept backup is not the expected one")
+	}
+	checkNoTempFiles(t,".")
+}
+
+//同一个进程可以多次打开钱包，别的进程持有锁时返回ErrWalletInUse
+func TestWalletFileLock(t *testing.T){
+	chdirTemp(t)
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	again,err := NewWallets()
+	if err != nil{
+		t.Fatalf("reopening in the same process: %v",err)
+	}
+	again.Close()
+
+	//另外打开锁文件，相当于另一个进程
+	other,err := os.OpenFile(walletFile+walletLockSuffix,os.O_RDWR,0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if locked,err := tryLockFile(other); locked || err != nil{
+		t.Fatalf("lock is free while the wallet is open: %v, %v",locked,err)
+	}
+	ws.Close()
+	if locked,err := tryLockFile(other); !locked || err != nil{
+		t.Fatalf("lock is still held after Close: %v, %v",locked,err)
+	}
+	if _,err := NewWallets(); !errors.Is(err,ErrWalletInUse){
+		t.Errorf("opening a locked wallet: err = %v, want ErrWalletInUse",err)
+	}
+	unlockFile(other)
+}
+
+func TestBackupWallet(t *testing.T){
+	chdirTemp(t)
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := os.Mkdir("out",0700); err != nil{
+		t.Fatal(err)
+	}
+	path,err := ws.BackupWallet("out")
+	if err != nil || filepath.Base(path) != walletFile{
+		t.Fatalf("BackupWallet(out) = %s, %v",path,err)
+	}
+	path,err = ws.BackupWallet("copy.dat")
+	if err != nil{
+		t.Fatal(err)
+	}
+	copied,_ := os.ReadFile(path)
+	original,_ := os.ReadFile(walletFile)
+	if string(copied) != string(original){
+		t.Error("backup content differs from the wallet file")
+	}
+	if _,err := ws.BackupWallet("./" + walletFile); err == nil{
+		t.Error("BackupWallet overwrote the wallet file itself")
+	}
+}
+
+//加密后删除明文的备份；修改口令后旧的备份用新口令打开
+func TestBackupsAfterEncrypt(t *testing.T){
+	chdirTemp(t)
+	forgetTestUnlocks(t)
+	ws,err := NewWallets()
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i := 0; i < 3; i++{
+		if _,err := ws.GetNewAddress(); err != nil{
+			t.Fatal(err)
+		}
+		if err := ws.SaveToFile2(); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if backups,_ := ws.backupFiles(); len(backups) != 0{
+		t.Fatalf("plaintext backups kept after Encrypt: %v",backups)
+	}
+
+	if err := ws.SetLabel(ws.GetAllAddress()[0],"x"); err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++{
+		if err := ws.SaveToFile2(); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if err := ws.ChangePassphrase("pw","pw2"); err != nil{
+		t.Fatal(err)
+	}
+	backups,_ := ws.backupFiles()
+	if len(backups) != 3{
+		t.Fatalf("%d backups after ChangePassphrase, want 3",len(backups))
+	}
+	for _,name := range backups{
+		backup,err := openWallets(name)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if err := backup.Unlock("pw"); !errors.Is(err,ErrWrongPassphrase){
+			t.Errorf("%s opens with the old passphrase: %v",name,err)
+		}
+		if err := backup.Unlock("pw2"); err != nil{
+			t.Errorf("%s does not open with the new passphrase: %v",name,err)
+		}
+		backup.Close()
+	}
+
+	path,err := ws.BackupWallet("copy.dat")
+	if err != nil{
+		t.Fatal(err)
+	}
+	if content,_ := os.ReadFile(path); !walletFileEncrypted(content){
+		t.Error("backup of an encrypted wallet is not encrypted")
+	}
+}
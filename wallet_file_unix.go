@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+//非阻塞地加排它锁，别的进程持有锁时返回false
+func tryLockFile(file *os.File) (bool,error){
+	err := syscall.Flock(int(file.Fd()),syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK{
+		return false,nil
+	}
+	return err == nil,err
+}
+
+func unlockFile(file *os.File) error{
+	return syscall.Flock(int(file.Fd()),syscall.LOCK_UN)
+}
+
+//fsync目录，让目录中的改名落盘
+func syncDir(dir string) error{
+	d,err := os.Open(dir)
+	if err != nil{
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+//标准库syscall中没有LockFileEx，和bolt一样从kernel32.dll中取
+var (
+	modkernel32      = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x00000001
+	lockfileExclusiveLock   = 0x00000002
+	errLockViolation        = syscall.Errno(0x21)
+)
+
+//非阻塞地加排它锁，别的进程持有锁时返回false
+func tryLockFile(file *os.File) (bool,error){
+	var ol syscall.Overlapped
+	r,_,err := procLockFileEx.Call(file.Fd(),lockfileExclusiveLock|lockfileFailImmediately,0,1,0,uintptr(unsafe.Pointer(&ol)))
+	if r != 0{
+		return true,nil
+	}
+	if err == errLockViolation{
+		return false,nil
+	}
+	return false,err
+}
+
+func unlockFile(file *os.File) error{
+	var ol syscall.Overlapped
+	r,_,err := procUnlockFileEx.Call(file.Fd(),0,1,0,uintptr(unsafe.Pointer(&ol)))
+	if r == 0{
+		return err
+	}
+	return nil
+}
+
+//Windows上不能打开目录做fsync，改名由文件系统保证
+func syncDir(dir string) error{
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+//钱包的交易记录：用到交易记录的命令打开钱包时同步到最新区块，把和本钱包地址（包括只读地址）有关的交易记下来。
+//区块链不读写钱包文件。HistoryTip是已经处理到的区块，它还在主链上时只处理它后面的区块，
+//否则（链重组、钱包文件是新建的、导入了新地址）从创世区块开始重建，被挤掉的分叉上的记录也就去掉了
+type WalletTx struct{
+	TxID         []byte
+	BlockHash    []byte
+	Height       int32
+	Index        int    //在区块中的序号
+	Time         uint32 //区块时间戳
+	Received     Amount //付给本钱包地址的金额
+	Sent         Amount //本钱包地址花掉的输入金额
+	Fee          Amount //手续费，输入全都属于本钱包时才知道，否则为0
+	Counterparty string //对方地址：收款时是付款人，付款时是第一个不属于本钱包的收款人；coinbase为空
+	Coinbase     bool
+	WatchOnly    bool       //只涉及只读地址
+	Outputs      []TXOutput //交易的全部输出，之后花费它们时用来计算金额
+	Spends       []UTXO     //花掉的本钱包的输出，用来找出钱包的未花费输出
+}
+
+//交易类别：generate挖矿奖励，receive收款，send付款，self转给自己
+func (wtx *WalletTx) Category() string{
+	switch{
+	case wtx.Coinbase:
+		return "generate"
+	case wtx.Sent == 0:
+		return "receive"
+	case wtx.Received+wtx.Fee == wtx.Sent:
+		return "self"
+	default:
+		return "send"
+	}
+}
+
+//交易的金额：收款为正，付款为负数且不包括手续费，转给自己是0
+func (wtx *WalletTx) Amount() Amount{
+	return wtx.Received - wtx.Sent + wtx.Fee
+}
+
+//确认数，bestHeight是当前最高区块的高度
+func (wtx *WalletTx) Confirmations(bestHeight int32) int32{
+	return bestHeight - wtx.Height + 1
+}
+
+//按区块高度和区块中的顺序排列的交易记录
+func (ws *Wallets) ListTransactions() []*WalletTx{
+	var txs []*WalletTx
+	for _,wtx := range ws.History{
+		txs = append(txs,wtx)
+	}
+	sort.Slice(txs,func(i,j int) bool{
+		if txs[i].Height != txs[j].Height{
+			return txs[i].Height < txs[j].Height
+		}
+		return txs[i].Index < txs[j].Index
+	})
+	return txs
+}
+
+//给地址加标签，地址可以不在钱包中，例如经常付款的对方。label为空时删除标签
+func (ws *Wallets) SetLabel(address,label string) error{
+	_,err := GetPubKeyHash(address)
+	if err != nil{
+		return err
+	}
+	if label == ""{
+		delete(ws.Labels,address)
+		return nil
+	}
+	if ws.Labels == nil{
+		ws.Labels = make(map[string]string)
+	}
+	ws.Labels[address] = label
+	return nil
+}
+
+//给交易记录加备注，note为空时删除备注。交易不在记录中返回ErrTxNotFound
+func (ws *Wallets) SetNote(txid,note string) error{
+	if _,ok := ws.History[txid]; !ok{
+		return fmt.Errorf("%w: %s is not a wallet transation",ErrTxNotFound,txid)
+	}
+	if note == ""{
+		delete(ws.Notes,txid)
+		return nil
+	}
+	if ws.Notes == nil{
+		ws.Notes = make(map[string]string)
+	}
+	ws.Notes[txid] = note
+	return nil
+}
+
+//钱包中地址的公钥hash --> 是否只读
+func (ws *Wallets) ownedPubKeyHashes() map[string]bool{
+	owned := make(map[string]bool)
+	for _,wallet := range ws.Store{
+		owned[string(HashPubKey(wallet.PublicKey))] = false
+	}
+	for _,watch := range ws.WatchOnly{
+		owned[string(watch.PubkeyHash)] = true
+	}
+	return owned
+}
+
+//钱包中加入了新地址，之前的区块可能有它的交易，下次同步时重建交易记录
+func (ws *Wallets) resetHistory(){
+	ws.HistoryTip = nil
+}
+
+//把交易记录同步到区块链的最新区块，记录有变化时返回true
+func (ws *Wallets) SyncHistory(bc *BlockChain) (bool,error){
+	//早期的交易记录没有Spends，重建一次
+	for _,wtx := range ws.History{
+		if wtx.Sent > 0 && wtx.Spends == nil{
+			ws.resetHistory()
+			break
+		}
+	}
+	if ws.HistoryTip != nil && bytes.Equal(ws.HistoryTip,bc.tip){
+		return false,nil
+	}
+
+	//从最新区块往回走到HistoryTip，走到创世区块也没遇到时从头重新生成，备注和标签保留
+	var blocks []*Block
+	found := false
+	bci := bc.iterator()
+	for{
+		block,err := bci.Next()
+		if err != nil{
+			return false,err
+		}
+		if ws.HistoryTip != nil && bytes.Equal(block.Hash,ws.HistoryTip){
+			found = true
+			break
+		}
+		blocks = append(blocks,block)
+		if len(block.PrevBlockHash) == 0{
+			break
+		}
+	}
+	if !found{
+		ws.History = make(map[string]*WalletTx)
+	}
+	owned := ws.ownedPubKeyHashes()
+	for i := len(blocks) - 1; i >= 0; i--{
+		err := ws.recordBlock(bc,blocks[i],owned)
+		if err != nil{
+			return false,err
+		}
+	}
+	ws.HistoryTip = blocks[0].Hash
+	return true,nil
+}
+
+//记录区块中和本钱包有关的交易
+func (ws *Wallets) recordBlock(bc *BlockChain,block *Block,owned map[string]bool) error{
+	if ws.History == nil{
+		ws.History = make(map[string]*WalletTx)
+	}
+	for index,tx := range block.Transations{
+		wtx := &WalletTx{TxID: tx.ID,BlockHash: block.Hash,Height: block.Height,Index: index,
+			Time: block.Time,Coinbase: tx.isCoinBase(),WatchOnly: true,Outputs: tx.Vout}
+		mine := false
+		allInputsMine := !wtx.Coinbase
+		var totalOut Amount
+		for _,out := range tx.Vout{
+			totalOut += out.Value
+			watchOnly,ok := owned[string(out.PubkeyHash)]
+			if !ok{
+				continue
+			}
+			mine = true
+			wtx.WatchOnly = wtx.WatchOnly && watchOnly
+			wtx.Received += out.Value
+		}
+		if !wtx.Coinbase{
+			for _,in := range tx.Vin{
+				watchOnly,ok := owned[string(HashPubKey(in.Pubkey))]
+				if !ok{
+					allInputsMine = false
+					continue
+				}
+				prevOut,err := ws.historyOutput(bc,in)
+				if err != nil{
+					return err
+				}
+				mine = true
+				wtx.WatchOnly = wtx.WatchOnly && watchOnly
+				wtx.Sent += prevOut.Value
+				wtx.Spends = append(wtx.Spends,UTXO{TXid: in.TXid,Voutindex: in.Voutindex,Output: prevOut})
+			}
+		}
+		if !mine{
+			continue
+		}
+		if allInputsMine{
+			wtx.Fee = wtx.Sent - totalOut
+		}
+		wtx.Counterparty = counterparty(tx,wtx.Sent > 0,owned)
+		ws.History[hex.EncodeToString(tx.ID)] = wtx
+	}
+	return nil
+}
+
+//输入花费的输出：先在交易记录中找，找不到再到链上找
+func (ws *Wallets) historyOutput(bc *BlockChain,in TXInput) (TXOutput,error){
+	if prev,ok := ws.History[hex.EncodeToString(in.TXid)]; ok && in.Voutindex >= 0 && in.Voutindex < len(prev.Outputs){
+		return prev.Outputs[in.Voutindex],nil
+	}
+	prevTx,err := bc.FindTransationById(in.TXid)
+	if err != nil{
+		return TXOutput{},err
+	}
+	return prevOutput(map[string]Transation{hex.EncodeToString(prevTx.ID): prevTx},in)
+}
+
+//交易的对方地址：付款时是第一个不属于本钱包的收款人，收款时是第一个输入的签名人
+func counterparty(tx *Transation,sending bool,owned map[string]bool) string{
+	if tx.isCoinBase(){
+		return ""
+	}
+	if sending{
+		for _,out := range tx.Vout{
+			if _,ok := owned[string(out.PubkeyHash)]; !ok{
+				return pubKeyHashToAddress(out.PubkeyHash)
+			}
+		}
+		return ""
+	}
+	return pubKeyHashToAddress(HashPubKey(tx.Vin[0].Pubkey))
+}
+
+//公钥hash --> Base58地址
+func pubKeyHashToAddress(pubkeyhash []byte) string{
+	return NewAddress(pubkeyhash,chainParams).String()
+}
@@ -2,98 +2,178 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/gob"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"math/big"
 	"os"
 )
 
-const walletFile = "wallet.dat"
+const defaultWalletFile = "wallet.dat"
+
+//命令使用的钱包文件，命令行的全局参数 -wallet 可以选择其他已加载的钱包，见SelectWallet
+var walletFile = defaultWalletFile
 
 //定义钱包集，里面通过map存储了多个钱包
 type Wallets struct{
 	Store map[string]*Wallet  //这里的Store变量必须首字母大写，这样才能在序列化时被输出。
+	Encryption *WalletEncryption  //钱包集的加密参数，nil表示私钥没有加密
+	HDChain *HDChain  //HD钱包的种子和派生进度，nil表示早期的钱包文件，地址都是随机生成的
+	WatchOnly map[string]*WatchOnlyAddress  //只读地址，没有私钥
+	History map[string]*WalletTx  //和本钱包有关的交易记录，key是交易ID的16进制字符串
+	HistoryTip []byte  //交易记录已经处理到的区块hash
+	Labels map[string]string  //地址的标签
+	Notes map[string]string  //交易的备注，key是交易ID的16进制字符串
+	KeyPool []string  //预先生成、还没有交给用户的收款地址
+	ChangePool []string  //预先生成、还没有用过的找零地址
+	KeyPoolSize int  //密钥池大小，0表示DefaultKeyPoolSize
+	Change map[string]string  //找零地址 --> 它所属的发送地址（账户）
+	masterKey []byte  //解锁后的主密钥，锁定时为nil，不写入文件
+	file string  //钱包集对应的文件，为空时是walletFile
+	lockKey string  //加了锁的钱包文件，Close时释放，见acquireWalletLock
 }
 
 
-//读取文件建立钱包集
+//读取文件建立钱包集，使用当前选择的钱包文件walletFile
 func NewWallets() (*Wallets,error){
-	wallets := Wallets{}
+	return openWallets(walletFile)
+}
+
+//读取指定的钱包文件建立钱包集，钱包文件加锁直到Close
+func openWallets(file string) (*Wallets,error){
+	lockKey,err := acquireWalletLock(file)
+	if err != nil{
+		return nil,err
+	}
+	wallets := &Wallets{file: file, lockKey: lockKey}
 	wallets.Store = make(map[string]*Wallet)
 
-	//改造: 如果发现钱包文件存在就读取文件内容，恢复钱包地址；不存在就创建文件，并新建地址。
-	_,err := os.Stat(walletFile)
+	//改造: 如果发现钱包文件存在就读取文件内容，恢复钱包地址；不存在就创建HD钱包文件，并新建地址。
+	_,err = os.Stat(file)
 	if os.IsNotExist(err){  //检查文件是否存在
-		fmt.Printf("钱包文件（%s）不存在，创建钱包文件...\n",walletFile)
-		wallets.CreateWallet()
-		wallets.SaveToFile2()  //钱包集重新写入文件
-		err=nil   //必须清空错误信息
+		fmt.Printf("钱包文件（%s）不存在，创建钱包文件...\n",file)
+		var mnemonic string
+		wallets,mnemonic,err = NewHDWallets()
+		if err != nil{
+			releaseWalletLock(lockKey)
+			return nil,err
+		}
+		wallets.file = file
+		wallets.lockKey = lockKey
+		err = wallets.SaveToFile2()  //钱包集重新写入文件
+		if err == nil{
+			fmt.Printf("钱包的助记词（请抄写下来妥善保管，丢失后无法恢复，泄露后币会被盗）：\n%s\n",mnemonic)
+		}
 	}else{
 		err = wallets.LoadFromFile()
 	}
+	if err != nil{
+		wallets.Close()
+		return nil,err
+	}
 
+	return wallets,nil
+}
 
-	return &wallets,err
+//在指定的曲线上创建钱包，返回字符串形式的钱包地址
+func (ws *Wallets) CreateWallet(curve CurveID) (string,error){
+	//HD钱包的secp256k1地址由种子派生，助记词能恢复出来，从密钥池中取
+	if ws.HDChain != nil && curve == CurveSecp256k1{
+		return ws.GetNewAddress()
+	}
+	return ws.newRandomAddress(curve)
 }
 
-//创建钱包，返回字符串形式的钱包地址
-func (ws *Wallets) CreateWallet() string{
-	wallet := NewWallet()
+//在指定的曲线上随机生成私钥，加入钱包集
+func (ws *Wallets) newRandomAddress(curve CurveID) (string,error){
+	wallet,err := NewWalletOnCurve(curve)
+	if err != nil{
+		return "",err
+	}
+	//加密的钱包集要先解锁，新私钥也要加密保存
+	err = ws.protectNewWallet(wallet)
+	if err != nil{
+		return "",err
+	}
 	address := fmt.Sprintf("%s",wallet.GetAddress())
 	ws.Store[address] = wallet
-	return address
+	return address,nil
 }
 
-//根据地址获取钱包
-func (ws *Wallets) GetWallet(address string) Wallet{
-	//注意这里可能会犯错误。 如果在钱包集ws中找不到指定的钱包地址，就会出现空指针ws.Store[address]是nil，接着*ws.Store[address]就会出错了。
+//根据地址获取钱包，钱包集中没有这个地址时返回ErrUnknownAddress，只读地址返回ErrWatchOnly
+func (ws *Wallets) GetWallet(address string) (Wallet,error){
+	if ws.IsWatchOnly(address){
+		return Wallet{},fmt.Errorf("%w: %s has no private key",ErrWatchOnly,address)
+	}
+	//如果在钱包集ws中找不到指定的钱包地址，ws.Store[address]是nil，不能直接取值。
 	//容易出现矿工的钱包地址没在钱包集中情况。
-	//fmt.Printf("ws.Store[address]=",ws.Store[address])
-	//fmt.Println("")
-	return *ws.Store[address]
+	wallet,ok := ws.Store[address]
+	if !ok{
+		return Wallet{},fmt.Errorf("%w: %s",ErrUnknownAddress,address)
+	}
+	return *wallet,nil
 }
 
-//获取钱包集中的所有地址,返回字符串数组
+//钱包集对应的文件
+func (ws *Wallets) path() string{
+	if ws.file == ""{
+		return walletFile
+	}
+	return ws.file
+}
+
+//获取钱包集中的所有有私钥的地址,返回字符串数组，只读地址见GetWatchOnlyAddress
 func (ws *Wallets) GetAllAddress() []string{
 	var alladdress []string
 	for address,_ := range ws.Store{
+		//密钥池中还没交出去的地址和找零地址不列出
+		if ws.inKeyPool(address) || ws.IsChange(address){
+			continue
+		}
 		alladdress = append(alladdress,address)
 	}
 	return alladdress
 }
 
 // Encode via Gob to file
-func (ws *Wallets) SaveToFile() {
-	file, err := os.Create(walletFile)
+func (ws *Wallets) SaveToFile() error{
+	file, err := os.Create(ws.path())
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
+	defer file.Close()
 
-	gob.Register(elliptic.P256())  //注册钱包地址中用的椭圆曲线
 	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(ws)
-	if err != nil {
-		log.Panic(err)
-	}
-	file.Close()
+	return encoder.Encode(ws)
 }
 
-//把ws序列化后写入文件保存
-func (ws *Wallets) SaveToFile2() {
+//把ws序列化后写入文件保存，文件中有私钥，只允许本用户读写。
+//先写临时文件再改名，原来的内容留一份备份，见writeFileAtomic和rotateBackup
+func (ws *Wallets) SaveToFile2() error{
+	//新建或恢复的钱包集没有经过openWallets，第一次保存时加锁
+	if ws.lockKey == ""{
+		lockKey,err := acquireWalletLock(ws.path())
+		if err != nil{
+			return err
+		}
+		ws.lockKey = lockKey
+	}
+
 	var content bytes.Buffer
 
-	gob.Register(elliptic.P256())  //注册钱包地址中用的椭圆曲线
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(ws)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	err = ioutil.WriteFile(walletFile,content.Bytes(),0777)
+	err = ws.rotateBackup()
 	if err != nil {
-		log.Panic(err)
+		return fmt.Errorf("wallet backup failed, wallet not saved: %w",err)
 	}
+	//新文件的权限是0600，早期版本创建的0777文件被替换掉
+	return writeFileAtomic(ws.path(),content.Bytes(),0600)
 }
 
 //读取文件内容，反序列化成钱包集, 要求这个文件必须存在
@@ -105,23 +185,98 @@ func (ws *Wallets) LoadFromFile() error{
 	//	return err
 	//}
 
-	fileContent,err := ioutil.ReadFile(walletFile)
+	fileContent,err := ioutil.ReadFile(ws.path())
 	if err !=nil{
-		log.Panic(err)
-		return err
+		return fmt.Errorf("%w: %v",ErrWalletFile,err)
 	}
 
 	var wallets Wallets  //接受反序列化的临时变量
-	gob.Register(elliptic.P256())
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&wallets)
 	if err !=nil{
-		log.Panic(err)
-		return err
+		//不是新格式，再按早期直接序列化ecdsa.PrivateKey的格式读取，下次保存时会写成新格式
+		store,legacyErr := decodeLegacyWallets(fileContent)
+		if legacyErr != nil{
+			return fmt.Errorf("%w: %v",ErrWalletFile,err)
+		}
+		wallets.Store = store
 	}
 
 	ws.Store = wallets.Store  //把当前对象的store替换掉
+	ws.Encryption = wallets.Encryption
+	ws.HDChain = wallets.HDChain
+	ws.WatchOnly = wallets.WatchOnly
+	ws.History = wallets.History
+	ws.HistoryTip = wallets.HistoryTip
+	ws.Labels = wallets.Labels
+	ws.Notes = wallets.Notes
+	ws.KeyPool = wallets.KeyPool
+	ws.ChangePool = wallets.ChangePool
+	ws.KeyPoolSize = wallets.KeyPoolSize
+	ws.Change = wallets.Change
+
+	//加密的钱包读出来是锁定的，本进程中UnlockFor解锁后还没过期就直接解锁
+	if ws.IsEncrypted(){
+		return ws.loadUnlock()
+	}
 	return nil
 }
 
+//早期的钱包文件用gob直接序列化了ecdsa.PrivateKey，曲线字段是注册过的elliptic.P256()，
+//类型名是crypto/elliptic.p256Curve，里面只有一个*CurveParams字段。
+//新版本的Go里这个类型已经不能序列化了，这里用结构相同的类型把旧数据读出来
+type legacyCurve struct{
+	CurveParams *elliptic.CurveParams
+}
+
+type legacyPublicKey struct{
+	Curve  interface{}
+	X, Y   *big.Int
+}
+
+type legacyPrivateKey struct{
+	PublicKey  legacyPublicKey
+	D          *big.Int
+}
+
+type legacyWallet struct{
+	PrivateKey  legacyPrivateKey
+	PublicKey   []byte
+}
+
+type legacyWallets struct{
+	Store map[string]*legacyWallet
+}
+
+//读取早期格式的钱包文件，早期钱包都在P256曲线上
+func decodeLegacyWallets(content []byte) (map[string]*Wallet,error){
+	gob.RegisterName("crypto/elliptic.p256Curve",legacyCurve{})
+
+	var legacy legacyWallets
+	err := gob.NewDecoder(bytes.NewReader(content)).Decode(&legacy)
+	if err != nil{
+		return nil,err
+	}
+
+	curve := elliptic.P256()
+	store := make(map[string]*Wallet)
+	for address,lw := range legacy.Store{
+		key := lw.PrivateKey
+		if key.D == nil || key.PublicKey.X == nil || key.PublicKey.Y == nil{
+			return nil,fmt.Errorf("wallet %s has no key",address)
+		}
+		if c,ok := key.PublicKey.Curve.(legacyCurve); !ok || c.CurveParams == nil || c.CurveParams.Name != curve.Params().Name{
+			return nil,fmt.Errorf("wallet %s uses an unsupported curve",address)
+		}
+		if !isOnCurve(curve,key.PublicKey.X,key.PublicKey.Y){
+			return nil,fmt.Errorf("wallet %s public key is not on the curve",address)
+		}
+		store[address] = &Wallet{
+			PrivateKey: ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve, X: key.PublicKey.X, Y: key.PublicKey.Y}, D: key.D},
+			PublicKey:  lw.PublicKey,
+		}
+	}
+	return store,nil
+}
+
 
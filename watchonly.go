@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+//只读地址：钱包中只有地址或者公钥，没有私钥。可以查看余额，不能花费，
+//用于在联网的机器上监控私钥保存在别处的地址
+type WatchOnlyAddress struct{
+	PubkeyHash []byte
+	PublicKey  []byte //importPubkey导入时才有，importAddress导入时为nil
+}
+
+//导入只读地址。钱包中已经有这个地址的私钥时返回错误，已经导入过时什么也不做
+func (ws *Wallets) ImportAddress(address string) error{
+	pubkeyhash,err := GetPubKeyHash(address)
+	if err != nil{
+		return err
+	}
+	if _,ok := ws.Store[address]; ok{
+		return fmt.Errorf("address %s already has a private key in the wallet",address)
+	}
+	if _,ok := ws.WatchOnly[address]; ok{
+		return nil
+	}
+	ws.addWatchOnly(address,&WatchOnlyAddress{PubkeyHash: pubkeyhash})
+	return nil
+}
+
+//导入公钥作为只读地址，返回公钥对应的地址。公钥可以是压缩或者不压缩格式，曲线是secp256k1或P256
+func (ws *Wallets) ImportPubKey(pubkey []byte) (string,error){
+	valid := false
+	for _,id := range supportedCurves{
+		if _,err := ParsePubKey(id.Curve(),pubkey); err == nil{
+			valid = true
+			break
+		}
+	}
+	if !valid{
+		return "",fmt.Errorf("%w: %x",errInvalidPubKey,pubkey)
+	}
+	address := fmt.Sprintf("%s",(&Wallet{PublicKey: pubkey}).GetAddress())
+	if _,ok := ws.Store[address]; ok{
+		return "",fmt.Errorf("address %s already has a private key in the wallet",address)
+	}
+	//之前只导入了地址的，补上公钥
+	ws.addWatchOnly(address,&WatchOnlyAddress{PubkeyHash: HashPubKey(pubkey),PublicKey: pubkey})
+	return address,nil
+}
+
+func (ws *Wallets) addWatchOnly(address string,watch *WatchOnlyAddress){
+	if ws.WatchOnly == nil{
+		ws.WatchOnly = make(map[string]*WatchOnlyAddress)
+	}
+	ws.WatchOnly[address] = watch
+	ws.resetHistory()
+}
+
+//地址是否是钱包中的只读地址
+func (ws *Wallets) IsWatchOnly(address string) bool{
+	_,ok := ws.WatchOnly[address]
+	return ok
+}
+
+//获取钱包集中的所有只读地址，按字符串排序
+func (ws *Wallets) GetWatchOnlyAddress() []string{
+	var addresses []string
+	for address := range ws.WatchOnly{
+		addresses = append(addresses,address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
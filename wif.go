@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+)
+
+//WIF（wallet import format）私钥格式：版本号 + 32字节私钥 + 可选的压缩标记 + 4字节校验和，再Base58编码。
+//有压缩标记表示地址由压缩公钥计算，没有标记时secp256k1是非压缩公钥，
+//P256是早期钱包直接拼接x、y的公钥，这样导入后地址和原来的一样
+const (
+	wifVersion     = byte(0x80) //比特币主网的私钥版本号，secp256k1
+	wifP256Version = byte(0x81) //本链早期钱包的P256私钥，比特币没有这个版本号
+	wifCompressed  = byte(0x01)
+	wifKeyLen      = 32
+)
+
+//把钱包的私钥编码成WIF字符串，钱包锁定时返回ErrWalletLocked
+func EncodeWIF(w *Wallet) (string,error){
+	if w.Locked(){
+		return "",ErrWalletLocked
+	}
+	var ver byte
+	switch w.Curve(){
+	case CurveSecp256k1:
+		ver = wifVersion
+	case CurveP256:
+		ver = wifP256Version
+	default:
+		return "",fmt.Errorf("%w: unsupported curve",ErrInvalidKey)
+	}
+
+	payload := make([]byte,1+wifKeyLen,2+wifKeyLen+addressChecksumLen)
+	payload[0] = ver
+	w.PrivateKey.D.FillBytes(payload[1:])
+	switch{
+	case bytes.Equal(w.PublicKey,MarshalPubKey(&w.PrivateKey.PublicKey,true)):
+		payload = append(payload,wifCompressed)
+	case bytes.Equal(w.PublicKey,wifUncompressedPubKey(&w.PrivateKey.PublicKey)):
+	default:
+		return "",fmt.Errorf("%w: public key encoding cannot be expressed in WIF",ErrInvalidKey)
+	}
+	payload = append(payload,CheckSum(payload)...)
+	return string(Base58Encode(payload)),nil
+}
+
+//解析WIF字符串，返回包含私钥和公钥的钱包
+func DecodeWIF(s string) (*Wallet,error){
+	data,err := Base58Decode([]byte(s))
+	if err != nil{
+		return nil,fmt.Errorf("%w: %v",ErrInvalidKey,err)
+	}
+	if len(data) != 1+wifKeyLen+addressChecksumLen && len(data) != 2+wifKeyLen+addressChecksumLen{
+		return nil,fmt.Errorf("%w: WIF has wrong length",ErrInvalidKey)
+	}
+	payload := data[:len(data)-addressChecksumLen]
+	if !bytes.Equal(CheckSum(payload),data[len(data)-addressChecksumLen:]){
+		return nil,fmt.Errorf("%w: WIF checksum mismatch",ErrInvalidKey)
+	}
+
+	var id CurveID
+	switch payload[0]{
+	case wifVersion:
+		id = CurveSecp256k1
+	case wifP256Version:
+		id = CurveP256
+	default:
+		return nil,fmt.Errorf("%w: unknown WIF version 0x%02x",ErrInvalidKey,payload[0])
+	}
+	compressed := len(payload) == 2+wifKeyLen
+	if compressed && payload[1+wifKeyLen] != wifCompressed{
+		return nil,fmt.Errorf("%w: bad WIF compression flag",ErrInvalidKey)
+	}
+
+	curve := id.Curve()
+	key := payload[1 : 1+wifKeyLen]
+	d := new(big.Int).SetBytes(key)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0{
+		return nil,fmt.Errorf("%w: private key out of range",ErrInvalidKey)
+	}
+	x,y := curve.ScalarBaseMult(key)
+	private := ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: curve,X: x,Y: y},D: d}
+
+	pubkey := wifUncompressedPubKey(&private.PublicKey)
+	if compressed{
+		pubkey = MarshalPubKey(&private.PublicKey,true)
+	}
+	return &Wallet{PrivateKey: private,PublicKey: pubkey},nil
+}
+
+//没有压缩标记时公钥的编码：secp256k1是SEC1非压缩格式，P256是早期钱包的 X.Bytes()+Y.Bytes()
+func wifUncompressedPubKey(pub *ecdsa.PublicKey) []byte{
+	if curveIDOf(pub.Curve) == CurveP256{
+		return append(pub.X.Bytes(),pub.Y.Bytes()...)
+	}
+	return MarshalPubKey(pub,false)
+}
+
+//导入WIF私钥，返回对应的地址。钱包中已经有这个私钥时什么也不做，
+//之前是只读地址的变成可以花费的地址。加密的钱包集要先解锁
+func (ws *Wallets) ImportPrivKey(wif string) (string,error){
+	wallet,err := DecodeWIF(wif)
+	if err != nil{
+		return "",err
+	}
+	address := fmt.Sprintf("%s",wallet.GetAddress())
+	if _,ok := ws.Store[address]; ok{
+		return address,nil
+	}
+	err = ws.protectNewWallet(wallet)
+	if err != nil{
+		return "",err
+	}
+	delete(ws.WatchOnly,address)
+	ws.Store[address] = wallet
+	ws.resetHistory()
+	return address,nil
+}
+
+//导出地址的WIF私钥，只读地址返回ErrWatchOnly，锁定时返回ErrWalletLocked
+func (ws *Wallets) DumpPrivKey(address string) (string,error){
+	wallet,err := ws.GetWallet(address)
+	if err != nil{
+		return "",err
+	}
+	return EncodeWIF(&wallet)
+}
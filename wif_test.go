@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+//比特币wiki上的WIF例子，同一个私钥的非压缩和压缩两种格式
+func TestWIFKnownAnswers(t *testing.T){
+	key := mustHexInt(t,"0C28FCA386C7A227600B2FE50B7CAE11EC86D3BF1FBE471BE89827E19D72AA1D")
+	tests := []struct{
+		wif,address string
+		pubLen       int
+	}{
+		{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ","1GAehh7TsJAHuUAeKZcXf5CnwuGuGgyX2S",65},
+		{"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617","1LoVGDgRs9hTfTNJNuXKSpywcbdvwRXpmK",33},
+	}
+	for _,tt := range tests{
+		w,err := DecodeWIF(tt.wif)
+		if err != nil{
+			t.Fatalf("DecodeWIF(%s): %v",tt.wif,err)
+		}
+		if w.PrivateKey.D.Cmp(key) != 0 || len(w.PublicKey) != tt.pubLen || w.Curve() != CurveSecp256k1{
+			t.Errorf("DecodeWIF(%s) = key %x with %d byte public key",tt.wif,w.PrivateKey.D,len(w.PublicKey))
+		}
+		if got := string(w.GetAddress()); got != tt.address{
+			t.Errorf("address of %s = %s, want %s",tt.wif,got,tt.address)
+		}
+		if got,err := EncodeWIF(w); err != nil || got != tt.wif{
+			t.Errorf("EncodeWIF = %s, %v, want %s",got,err,tt.wif)
+		}
+	}
+}
+
+func TestDecodeWIFRejects(t *testing.T){
+	tests := []string{
+		"",
+		"abc",
+		"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98618", //校验和不对
+		"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP9861",  //长度不对
+		"1GAehh7TsJAHuUAeKZcXf5CnwuGuGgyX2S",                   //地址不是私钥
+		"0OIl",                                                 //不是Base58字符
+	}
+	for _,s := range tests{
+		if _,err := DecodeWIF(s); !errors.Is(err,ErrInvalidKey){
+			t.Errorf("DecodeWIF(%q): err = %v, want ErrInvalidKey",s,err)
+		}
+	}
+
+	//私钥为0或不小于n
+	for _,key := range [][]byte{make([]byte,32),S256().Params().N.Bytes()}{
+		payload := append([]byte{wifVersion},key...)
+		s := string(Base58Encode(append(payload,CheckSum(payload)...)))
+		if _,err := DecodeWIF(s); !errors.Is(err,ErrInvalidKey){
+			t.Errorf("key %x: err = %v, want ErrInvalidKey",key,err)
+		}
+	}
+}
+
+//P256私钥用单独的版本号，早期钱包拼接x、y的公钥导入后地址不变
+func TestWIFP256(t *testing.T){
+	w,err := NewWalletOnCurve(CurveP256)
+	if err != nil{
+		t.Fatal(err)
+	}
+	pub := w.PrivateKey.PublicKey
+	legacy := &Wallet{PrivateKey: w.PrivateKey,PublicKey: append(pub.X.Bytes(),pub.Y.Bytes()...)}
+	for _,wallet := range []*Wallet{w,legacy}{
+		s,err := EncodeWIF(wallet)
+		if err != nil{
+			t.Fatal(err)
+		}
+		back,err := DecodeWIF(s)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if back.Curve() != CurveP256 || string(back.GetAddress()) != string(wallet.GetAddress()){
+			t.Errorf("P256 WIF %s decodes to address %s, want %s",s,back.GetAddress(),wallet.GetAddress())
+		}
+	}
+}
+
+//导入私钥后只读地址变成可以花费的地址，加密的钱包锁定时不能导入和导出
+func TestImportDumpPrivKey(t *testing.T){
+	_,ws,addr := newTestChain(t)
+	forgetTestUnlocks(t)
+	other,_ := NewWalletOnCurve(DefaultCurve)
+	otherAddr := string(other.GetAddress())
+	if err := ws.ImportAddress(otherAddr); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.DumpPrivKey(otherAddr); !errors.Is(err,ErrWatchOnly){
+		t.Errorf("dump watch-only address: err = %v, want ErrWatchOnly",err)
+	}
+	wif,_ := EncodeWIF(other)
+	if got,err := ws.ImportPrivKey(wif); err != nil || got != otherAddr{
+		t.Fatalf("ImportPrivKey = %s, %v, want %s",got,err,otherAddr)
+	}
+	if ws.IsWatchOnly(otherAddr) || ws.Store[otherAddr] == nil{
+		t.Error("imported address is still watch-only")
+	}
+	dumped,err := ws.DumpPrivKey(otherAddr)
+	if err != nil || dumped != wif{
+		t.Errorf("DumpPrivKey = %s, %v, want %s",dumped,err,wif)
+	}
+
+	if err := ws.Encrypt("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.DumpPrivKey(addr); !errors.Is(err,ErrWalletLocked){
+		t.Errorf("dump from a locked wallet: err = %v, want ErrWalletLocked",err)
+	}
+	third,_ := NewWalletOnCurve(DefaultCurve)
+	wif,_ = EncodeWIF(third)
+	if _,err := ws.ImportPrivKey(wif); !errors.Is(err,ErrWalletLocked){
+		t.Errorf("import into a locked wallet: err = %v, want ErrWalletLocked",err)
+	}
+	if err := ws.Unlock("pw"); err != nil{
+		t.Fatal(err)
+	}
+	if _,err := ws.ImportPrivKey(wif); err != nil{
+		t.Fatal(err)
+	}
+	if ws.Store[string(third.GetAddress())].encryptedKey == nil{
+		t.Error("key imported into an encrypted wallet is not encrypted")
+	}
+}